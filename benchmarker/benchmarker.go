@@ -1,30 +1,51 @@
 package benchmarker
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/workloads"
 )
 
 type StepResult struct {
 	Command  string
 	Duration time.Duration
+	Metrics  []workloads.Measurement
 }
 
 type IterationResult struct {
 	Duration time.Duration
 	Steps    []StepResult
 	Error    *EncodableError
+	Stage    string
 }
 
+// stages of an experiment reported apart from its iterations
+const (
+	SetupStage    = "setup"
+	TeardownStage = "teardown"
+)
+
 func Time(experiment func() error) (result time.Duration, err error) {
 	t0 := time.Now()
-	err = experiment()
+	err = recovered(experiment)
 	t1 := time.Now()
 	return t1.Sub(t0), err
 }
 
+// recovered runs the experiment, returning a panic in it as an error so that
+// it fails the iteration rather than the whole run
+func recovered(experiment func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return experiment()
+}
+
 func Counted(out chan<- int, fn func(context.Context)) func(context.Context) {
 	return func(workloadCtx context.Context) {
 		out <- 1
@@ -40,6 +61,21 @@ func TimedWithWorker(out chan<- IterationResult, worker Worker, experiment strin
 	}
 }
 
+// TimedStage runs a setup or teardown workload, reporting its result for
+// the stage rather than as an iteration, and whether it succeeded
+func TimedStage(out chan<- IterationResult, worker Worker, stage string, experiment string) func(context.Context) bool {
+	return func(workloadCtx context.Context) bool {
+		if experiment == "" {
+			return true
+		}
+
+		result := worker.Time(experiment, workloadCtx)
+		result.Stage = stage
+		out <- result
+		return result.Error == nil
+	}
+}
+
 func Once(fn func(context.Context)) <-chan func(context.Context) {
 	return Repeat(1, fn)
 }
@@ -58,7 +94,7 @@ func RepeatEveryUntil(repeatInterval int, runTime int, fn func(context.Context),
 				select {
 				case <-ticker.C:
 					repeats++
-					if repeats*repeatInterval > runTime {
+					if repeats*repeatInterval > runTime || quitting(quit) {
 						ticker.Stop()
 						return
 					}
@@ -74,16 +110,40 @@ func RepeatEveryUntil(repeatInterval int, runTime int, fn func(context.Context),
 }
 
 func Repeat(n int, fn func(context.Context)) <-chan func(context.Context) {
+	return RepeatUntil(n, fn, nil)
+}
+
+// RepeatUntil is Repeat, stopping early once quit is closed; a repetition
+// taken just as quit closes does not call fn
+func RepeatUntil(n int, fn func(context.Context), quit <-chan bool) <-chan func(context.Context) {
 	ch := make(chan func(context.Context))
+	unlessQuitting := func(ctx context.Context) {
+		if !quitting(quit) {
+			fn(ctx)
+		}
+	}
 	go func() {
 		defer close(ch)
 		for i := 0; i < n; i++ {
-			ch <- fn
+			select {
+			case ch <- unlessQuitting:
+			case <-quit:
+				return
+			}
 		}
 	}()
 	return ch
 }
 
+func quitting(quit <-chan bool) bool {
+	select {
+	case <-quit:
+		return true
+	default:
+		return false
+	}
+}
+
 func Execute(tasks <-chan func(context.Context), workloadCtx context.Context) {
 	for task := range tasks {
 		task(workloadCtx)
@@ -91,22 +151,42 @@ func Execute(tasks <-chan func(context.Context), workloadCtx context.Context) {
 }
 
 func ExecuteConcurrently(schedule <-chan int, tasks <-chan func(context.Context), workloadCtx context.Context) {
+	ExecuteConcurrentlyWithSetup(schedule, tasks, nil, nil, workloadCtx)
+}
+
+// ExecuteConcurrentlyWithSetup runs setup in each worker's context before it
+// takes any tasks and teardown after its last one; a worker whose setup fails
+// takes no tasks, and tasks left when every worker has finished are dropped
+func ExecuteConcurrentlyWithSetup(schedule <-chan int, tasks <-chan func(context.Context), setup func(context.Context) bool, teardown func(context.Context), workloadCtx context.Context) {
 	var wg sync.WaitGroup
 	indexCounter := 0
+	workerCounter := 0
 
 	for increment := range schedule {
 
 		for i := 0; i < increment; i++ {
 			wg.Add(1)
+			workerCtx := workloadCtx.Clone()
+			workerCtx.PutInt("workerIndex", workerCounter)
+			workerCounter++
 			go func(t <-chan func(context.Context), ctx context.Context) {
 				defer wg.Done()
+				if setup != nil && !setup(ctx) {
+					return
+				}
+				if teardown != nil {
+					defer teardown(ctx)
+				}
 				for task := range t {
 					ctx.PutInt("iterationIndex", indexCounter)
 					indexCounter++
 					task(ctx)
 				}
-			}(tasks, workloadCtx.Clone())
+			}(tasks, workerCtx)
 		}
 	}
 	wg.Wait()
+
+	for _ = range tasks {
+	}
 }
@@ -1,6 +1,7 @@
 package benchmarker
 
 import (
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/context"
@@ -18,6 +19,12 @@ var _ = Describe("Benchmarker", func() {
 			time, _ := Time(func() error { time.Sleep(2 * time.Second); return nil })
 			Ω(time.Seconds()).Should(BeNumerically("~", 2, 0.5))
 		})
+
+		It("returns a panic as an error", func() {
+			_, err := Time(func() error { panic("boom") })
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("boom"))
+		})
 	})
 
 	Describe("TimedWithWorker", func() {
@@ -59,6 +66,16 @@ var _ = Describe("Benchmarker", func() {
 			Execute(Repeat(3, func(context.Context) { called = called + 1 }), workloadCtx)
 			Ω(called).Should(Equal(3))
 		})
+
+		It("stops repeating once quit is closed", func() {
+			quit := make(chan bool)
+			called := 0
+			Execute(RepeatUntil(3, func(context.Context) {
+				called = called + 1
+				close(quit)
+			}, quit), workloadCtx)
+			Ω(called).Should(Equal(1))
+		})
 	})
 
 	Describe("RepeatEveryUntil", func() {
@@ -219,6 +236,111 @@ var _ = Describe("Benchmarker", func() {
 				ExecuteConcurrently(schedule, tasks, workloadCtx)
 				Ω(executedInOrder).Should(BeNumerically("~", 5, 1))
 			})
+
+			It("Gives each worker a stable workerIndex for all of its tasks", func() {
+				schedule := make(chan int)
+				tasks := make(chan func(context.Context))
+				var mutex sync.Mutex
+				seen := make(map[int]int)
+				go func() {
+					defer close(tasks)
+					for i := 0; i < 6; i++ {
+						tasks <- func(ctx context.Context) {
+							index, _ := ctx.GetInt("workerIndex")
+							mutex.Lock()
+							seen[index]++
+							mutex.Unlock()
+							time.Sleep(10 * time.Millisecond)
+						}
+					}
+				}()
+				go func() {
+					defer close(schedule)
+					schedule <- 1
+					schedule <- 1
+				}()
+				ExecuteConcurrently(schedule, tasks, workloadCtx)
+				Ω(seen).Should(HaveLen(2))
+				Ω(seen).Should(HaveKey(0))
+				Ω(seen).Should(HaveKey(1))
+			})
+		})
+	})
+
+	Describe("#ExecuteConcurrentlyWithSetup", func() {
+		var (
+			schedule chan int
+			tasks    chan func(context.Context)
+			mutex    sync.Mutex
+			events   []string
+		)
+
+		record := func(event string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, event)
+		}
+
+		BeforeEach(func() {
+			schedule = make(chan int)
+			tasks = make(chan func(context.Context))
+			events = make([]string, 0)
+			go func() {
+				defer close(tasks)
+				for i := 0; i < 2; i++ {
+					tasks <- func(ctx context.Context) {
+						token, _ := ctx.GetString("token")
+						record("task with " + token)
+					}
+				}
+			}()
+			go func() {
+				defer close(schedule)
+				schedule <- 1
+			}()
+		})
+
+		It("runs setup in the worker's context before its tasks and teardown after them", func() {
+			ExecuteConcurrentlyWithSetup(schedule, tasks, func(ctx context.Context) bool {
+				record("setup")
+				ctx.PutString("token", "TOKEN")
+				return true
+			}, func(ctx context.Context) {
+				record("teardown")
+			}, workloadCtx)
+
+			Ω(events).Should(Equal([]string{"setup", "task with TOKEN", "task with TOKEN", "teardown"}))
+			_, exists := workloadCtx.GetString("token")
+			Ω(exists).Should(BeFalse())
+		})
+
+		It("runs no tasks and no teardown in a worker whose setup failed", func() {
+			ExecuteConcurrentlyWithSetup(schedule, tasks, func(ctx context.Context) bool {
+				record("setup")
+				return false
+			}, func(ctx context.Context) {
+				record("teardown")
+			}, workloadCtx)
+
+			Ω(events).Should(Equal([]string{"setup"}))
+		})
+	})
+
+	Describe("#TimedStage", func() {
+		It("reports the result of the workload for its stage", func() {
+			out := make(chan IterationResult, 1)
+			ok := TimedStage(out, &DummyWorker{}, SetupStage, "three")(workloadCtx)
+			Ω(ok).Should(BeTrue())
+
+			result := <-out
+			Ω(result.Stage).Should(Equal(SetupStage))
+			Ω(result.Duration).Should(Equal(3 * time.Second))
+		})
+
+		It("does nothing without a workload", func() {
+			out := make(chan IterationResult)
+			ok := TimedStage(out, &DummyWorker{}, TeardownStage, "")(workloadCtx)
+			Ω(ok).Should(BeTrue())
 		})
 	})
 })
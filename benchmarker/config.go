@@ -2,6 +2,7 @@ package benchmarker
 
 import (
 	"io"
+	"strings"
 
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/redis"
@@ -10,10 +11,14 @@ import (
 
 var params = struct {
 	startMasterAndSlave bool
+	slaveLabels         string
+	allowExec           bool
 }{}
 
 func DescribeParameters(config config.Config) {
 	config.BoolVar(&params.startMasterAndSlave, "use-redis-worker", false, "Runs in master mode, sending work to perform to a redis queue")
+	config.BoolVar(&params.allowExec, "allow-exec", false, "Allows exec:<command> workload steps, which run any command on this machine (and, as a redis slave, for any master)")
+	config.StringVar(&params.slaveLabels, "slave-labels", "", "a comma-separated list of labels for this instance's redis slave, experiments requesting any of these labels can run tasks on it")
 }
 
 func WithConfiguredWorkerAndSlaves(fn func(worker Worker) error) error {
@@ -47,11 +52,21 @@ var LocalWorkerFactory = func() *LocalWorker {
 }
 
 var RedisWorkerFactory = func(conn redis.Conn) Worker {
-	return NewRedisWorker(conn)
+	return NewRedisWorkerInNamespace(conn, redis.ConfiguredNamespace(), DefaultTimeout)
 }
 
 var SlaveFactory = func(conn redis.Conn, delegate Worker) io.Closer {
-	return StartSlave(conn, delegate)
+	return StartSlaveInNamespace(conn, redis.ConfiguredNamespace(), delegate, ParseLabels(params.slaveLabels)...)
+}
+
+func ParseLabels(labels string) []string {
+	parsed := make([]string, 0)
+	for _, label := range strings.Split(labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			parsed = append(parsed, label)
+		}
+	}
+	return parsed
 }
 
 var WorkloadListFactory = func() WorkloadDescriber {
@@ -35,7 +35,7 @@ var _ = Describe("Config", func() {
 		}
 
 		redisWorker = NewLocalWorker()
-		redisWorker.AddWorkloadStep(workloads.WorkloadStep{"redis", nil, "b"})
+		redisWorker.AddWorkloadStep(workloads.WorkloadStep{"redis", nil, "b", nil})
 		redisWorkerConn = &dummyConn{"redisConn"}
 		RedisWorkerFactory = func(conn redis.Conn) Worker {
 			redisWorkerConn = conn
@@ -158,6 +158,16 @@ var _ = Describe("Config", func() {
 	})
 })
 
+var _ = Describe("ParseLabels", func() {
+	It("splits a comma-separated list of labels, ignoring whitespace and empty entries", func() {
+		Ω(ParseLabels(" inside, ,outside,")).Should(Equal([]string{"inside", "outside"}))
+	})
+
+	It("returns no labels for an empty string", func() {
+		Ω(ParseLabels("")).Should(BeEmpty())
+	})
+})
+
 type dummyConn struct{ name string }
 
 func (dummyConn) Do(cmd string, args ...interface{}) (interface{}, error) {
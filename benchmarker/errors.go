@@ -23,5 +23,5 @@ func (e *EncodableError) MarshalJSON() ([]byte, error) {
 }
 
 func (e *EncodableError) UnmarshalJSON(data []byte) error {
-	return json.Unmarshal(data, e.Message)
+	return json.Unmarshal(data, &e.Message)
 }
@@ -1,7 +1,6 @@
 package benchmarker
 
 import (
-	"strings"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/context"
@@ -17,16 +16,41 @@ func NewLocalWorker() *LocalWorker {
 }
 
 func (self *LocalWorker) Time(experiment string, workloadCtx context.Context) (result IterationResult) {
-	experiments := strings.Split(experiment, ",")
 	var start = time.Now()
-	for _, e := range experiments {
-		stepTime, err := Time(func() error { return self.Experiments[e].Fn(workloadCtx) })
-		result.Steps = append(result.Steps, StepResult{e, stepTime})
-		if err != nil {
-			result.Error = encodeError(err)
-			break
-		}
+	calls, err := workloads.ParseWorkload(experiment)
+	if err == nil {
+		err = self.run(calls, workloadCtx, &result)
+	}
+	if err != nil {
+		result.Error = encodeError(err)
 	}
 	result.Duration = time.Now().Sub(start)
 	return
 }
+
+func (self *LocalWorker) run(calls []workloads.StepCall, workloadCtx context.Context, result *IterationResult) error {
+	for _, call := range calls {
+		if call.Name == workloads.RandomStep {
+			if err := self.run(call.Choose(), workloadCtx, result); err != nil {
+				return err
+			}
+			continue
+		}
+
+		workloads.TakePhases(workloadCtx)
+		workloads.TakeMetrics(workloadCtx)
+		step, stepCall, ok := self.stepFor(call)
+		if !ok {
+			return unknownStep(stepCall)
+		}
+		stepTime, err := Time(func() error { return step.Run(stepCall, workloadCtx) })
+		result.Steps = append(result.Steps, StepResult{call.Text, stepTime, workloads.TakeMetrics(workloadCtx)})
+		for _, phase := range workloads.TakePhases(workloadCtx) {
+			result.Steps = append(result.Steps, StepResult{call.Text + "/" + phase.Name, phase.Duration, nil})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -36,6 +36,27 @@ var _ = Describe("LocalWorker", func() {
 			Ω(result.Error).Should(HaveOccurred())
 		})
 
+		It("Runs exec steps as commands", func() {
+			params.allowExec = true
+			defer func() { params.allowExec = false }()
+
+			worker := NewLocalWorker()
+			result := worker.Time("exec:true", workloadCtx)
+			Ω(result.Error).Should(BeNil())
+			Ω(result.Steps[0].Command).Should(Equal("exec:true"))
+
+			result = worker.Time("exec:false", workloadCtx)
+			Ω(result.Error).ShouldNot(BeNil())
+		})
+
+		It("Does not run exec steps unless they are allowed", func() {
+			worker := NewLocalWorker()
+			result := worker.Time("exec:true", workloadCtx)
+			Ω(result.Error).ShouldNot(BeNil())
+			Ω(result.Error.Error()).Should(ContainSubstring("-allow-exec"))
+			Ω(result.Steps).Should(BeEmpty())
+		})
+
 		It("Passes context to each step", func() {
 			var workloadContext context.Context
 			worker := NewLocalWorker()
@@ -102,4 +123,153 @@ var _ = Describe("LocalWorker", func() {
 			Ω(result.Duration.Seconds()).Should(BeNumerically("~", 1, 0.1))
 		})
 	})
+
+	Describe("When a step times its phases", func() {
+		var result IterationResult
+
+		BeforeEach(func() {
+			worker := NewLocalWorker()
+			worker.AddWorkloadStep(StepWithContext("composite", func(ctx context.Context) error {
+				TimePhase(ctx, "first", func() error { time.Sleep(100 * time.Millisecond); return nil })
+				return TimePhase(ctx, "second", func() error { time.Sleep(200 * time.Millisecond); return nil })
+			}, ""))
+			worker.AddWorkloadStep(Step("plain", func() error { return nil }, ""))
+			result = worker.Time("composite,plain", context.New())
+		})
+
+		It("Records each phase as a command after the step", func() {
+			Ω(result.Steps).Should(HaveLen(4))
+			Ω(result.Steps[0].Command).Should(Equal("composite"))
+			Ω(result.Steps[1].Command).Should(Equal("composite/first"))
+			Ω(result.Steps[2].Command).Should(Equal("composite/second"))
+			Ω(result.Steps[3].Command).Should(Equal("plain"))
+		})
+
+		It("Times each phase seperately", func() {
+			Ω(result.Steps[1].Duration.Seconds()).Should(BeNumerically("~", 0.1, 0.05))
+			Ω(result.Steps[2].Duration.Seconds()).Should(BeNumerically("~", 0.2, 0.05))
+		})
+	})
+
+	Describe("When a step reports metrics", func() {
+		It("Records them with the step", func() {
+			worker := NewLocalWorker()
+			worker.AddWorkloadStep(StepWithContext("measure", func(ctx context.Context) error {
+				Gauge(ctx, "loss-rate", 0.25)
+				return nil
+			}, ""))
+			worker.AddWorkloadStep(Step("plain", func() error { return nil }, ""))
+			result := worker.Time("measure,plain", context.New())
+			Ω(result.Steps[0].Metrics).Should(Equal([]Measurement{{"loss-rate", GaugeMetric, 0.25}}))
+			Ω(result.Steps[1].Metrics).Should(BeEmpty())
+		})
+	})
+
+	Describe("When a step is given arguments", func() {
+		var (
+			worker *LocalWorker
+			ctx    context.Context
+			seen   []string
+		)
+
+		BeforeEach(func() {
+			seen = make([]string, 0)
+			ctx = context.New()
+			ctx.PutString("memory", "64M")
+			worker = NewLocalWorker()
+			worker.AddWorkloadStep(StepWithContext("push", func(ctx context.Context) error {
+				memory, _ := ctx.GetString("memory")
+				seen = append(seen, memory)
+				return nil
+			}, "").WithParameters(Parameter{"memory", "memory", "", false}))
+		})
+
+		It("Passes the arguments to the step and records it by its full text", func() {
+			result := worker.Time("push(memory=256M),push", ctx)
+			Ω(result.Error).Should(BeNil())
+			Ω(seen).Should(Equal([]string{"256M", "64M"}))
+			Ω(result.Steps[0].Command).Should(Equal("push(memory=256M)"))
+			Ω(result.Steps[1].Command).Should(Equal("push"))
+		})
+
+		It("Validates the arguments", func() {
+			ok, _ := worker.Validate("push(memory=256M)")
+			Ω(ok).Should(BeTrue())
+			ok, err := worker.Validate("push(disk=1G)")
+			Ω(ok).Should(BeFalse())
+			Ω(err.Error()).Should(ContainSubstring("disk"))
+		})
+
+		It("Returns an error for a malformed workload", func() {
+			result := worker.Time("push(memory=256M", ctx)
+			Ω(result.Error).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("When a step chooses between random flows", func() {
+		var worker *LocalWorker
+
+		BeforeEach(func() {
+			worker = NewLocalWorker()
+			worker.AddWorkloadStep(Step("foo", func() error { return nil }, ""))
+			worker.AddWorkloadStep(Step("bar", func() error { return nil }, ""))
+		})
+
+		It("Runs and records the steps of the chosen flow", func() {
+			result := worker.Time("foo,random(1:bar,foo)", workloadCtx)
+			Ω(result.Error).Should(BeNil())
+			Ω(result.Steps).Should(HaveLen(3))
+			Ω(result.Steps[1].Command).Should(Equal("bar"))
+			Ω(result.Steps[2].Command).Should(Equal("foo"))
+		})
+
+		It("Validates the steps of every flow", func() {
+			ok, _ := worker.Validate("random(1:foo|2:bar)")
+			Ω(ok).Should(BeTrue())
+			ok, err := worker.Validate("random(1:foo|2:baz)")
+			Ω(ok).Should(BeFalse())
+			Ω(err.Error()).Should(ContainSubstring("baz"))
+		})
+	})
+
+	Describe("When a step is wrapped in faults", func() {
+		var (
+			worker *LocalWorker
+			ran    int
+		)
+
+		BeforeEach(func() {
+			ran = 0
+			worker = NewLocalWorker()
+			worker.AddWorkloadStep(Step("foo", func() error { ran++; return nil }, ""))
+		})
+
+		It("Runs the wrapped step and records it by its full text", func() {
+			result := worker.Time("faulty(foo,delay=100ms),foo", workloadCtx)
+			Ω(result.Error).Should(BeNil())
+			Ω(ran).Should(Equal(2))
+			Ω(result.Steps[0].Command).Should(Equal("faulty(foo,delay=100ms)"))
+			Ω(result.Steps[0].Duration.Seconds()).Should(BeNumerically("~", 0.1, 0.05))
+		})
+
+		It("Records injected errors and panics as errors of the step", func() {
+			result := worker.Time("faulty(foo,error=100%),foo", workloadCtx)
+			Ω(result.Error).ShouldNot(BeNil())
+			Ω(result.Steps).Should(HaveLen(1))
+
+			result = worker.Time("faulty(foo,panic=100%),foo", workloadCtx)
+			Ω(result.Error).ShouldNot(BeNil())
+			Ω(result.Error.Error()).Should(ContainSubstring("panic"))
+			Ω(result.Steps).Should(HaveLen(1))
+			Ω(ran).Should(Equal(0))
+		})
+
+		It("Validates the wrapped step", func() {
+			ok, _ := worker.Validate("faulty(foo,error=10%)")
+			Ω(ok).Should(BeTrue())
+			ok, err := worker.Validate("faulty(baz,error=10%)")
+			Ω(ok).Should(BeFalse())
+			Ω(err.Error()).Should(ContainSubstring("baz"))
+		})
+	})
 })
@@ -2,6 +2,9 @@ package benchmarker
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/logs"
@@ -13,6 +16,7 @@ import (
 type rw struct {
 	defaultWorker
 	conn             redis.Conn
+	namespace        redis.Namespace
 	timeoutInSeconds int
 }
 
@@ -22,21 +26,38 @@ type redisMessage struct {
 	WorkloadContext context.Context
 }
 
+// redisReply is the result of a task run by a slave, with the ledger entries
+// of the resources it created or deleted, which the master records, and the
+// context the task left behind, which the master merges into its own
+type redisReply struct {
+	IterationResult
+	Ledger          []workloads.LedgerEntry
+	WorkloadContext json.RawMessage
+}
+
 const DefaultTimeout = 60 * 5
 
+// how long a slave blocks on its task queues before refreshing the list of active experiments
+const SlavePollIntervalInSeconds = 1
+
 func NewRedisWorker(conn redis.Conn) Worker {
 	return NewRedisWorkerWithTimeout(conn, DefaultTimeout)
 }
 
 func NewRedisWorkerWithTimeout(conn redis.Conn, timeoutInSeconds int) Worker {
-	return &rw{defaultWorker{make(map[string]workloads.WorkloadStep)}, conn, timeoutInSeconds}
+	return NewRedisWorkerInNamespace(conn, "", timeoutInSeconds)
+}
+
+func NewRedisWorkerInNamespace(conn redis.Conn, namespace redis.Namespace, timeoutInSeconds int) Worker {
+	return &rw{defaultWorker{make(map[string]workloads.WorkloadStep)}, conn, namespace, timeoutInSeconds}
 }
 
 func (rw rw) Time(workload string, workloadCtx context.Context) (result IterationResult) {
 	guid, _ := uuid.NewV4()
+	replyTo := rw.namespace.Key("replies-" + guid.String())
 	redisMsg := redisMessage{
 		Workload:        workload,
-		Reply:           "replies-" + guid.String(),
+		Reply:           replyTo,
 		WorkloadContext: workloadCtx,
 	}
 
@@ -45,57 +66,134 @@ func (rw rw) Time(workload string, workloadCtx context.Context) (result Iteratio
 	jsonRedisMsg, err = json.Marshal(redisMsg)
 
 	if err != nil {
-		return IterationResult{0, []StepResult{}, encodeError(err)}
+		return IterationResult{0, []StepResult{}, encodeError(err), ""}
 	}
 
-	rw.conn.Do("RPUSH", "tasks", string(jsonRedisMsg))
+	labels := labelsFor(workloadCtx)
+	experimentGuid, _ := workloadCtx.GetString("experimentGuid")
+	queue := rw.namespace.Key(taskQueue(strings.Join(labels, ","), experimentGuid))
+	rw.conn.Do("RPUSH", queue, string(jsonRedisMsg))
+	if experimentGuid != "" && len(labels) == 0 {
+		rw.conn.Do("ZADD", rw.namespace.Key(queueRegistry("")), time.Now().Unix(), queue)
+	}
+	for _, label := range labels {
+		rw.conn.Do("ZADD", rw.namespace.Key(queueRegistry(label)), time.Now().Unix(), queue)
+	}
 
-	reply, err := redis.Strings(rw.conn.Do("BLPOP", "replies-"+guid.String(), rw.timeoutInSeconds))
+	reply, err := redis.Strings(rw.conn.Do("BLPOP", replyTo, rw.timeoutInSeconds))
 
 	if err != nil {
-		return IterationResult{0, []StepResult{}, encodeError(err)}
-	} else {
-		json.Unmarshal([]byte(reply[1]), &result)
-		return
+		return IterationResult{0, []StepResult{}, encodeError(err), ""}
+	}
+
+	var decoded redisReply
+	json.Unmarshal([]byte(reply[1]), &decoded)
+	workloads.RecordLedgerEntries(workloadCtx, decoded.Ledger)
+	if len(decoded.WorkloadContext) > 0 {
+		workloadCtx.UnmarshalJSON(decoded.WorkloadContext)
+	}
+	return decoded.IterationResult
+}
+
+// labelsFor lists the labels an experiment's tasks may run on, sorted so
+// that every worker of the experiment pushes its tasks to the same queue. The
+// queue is registered under each of the labels, so that it is served by every
+// slave with any of them and no task waits for a label without slaves
+func labelsFor(workloadCtx context.Context) []string {
+	labels, _ := workloadCtx.GetString("labels")
+	seen := make(map[string]bool)
+	unique := make([]string, 0)
+	for _, label := range ParseLabels(labels) {
+		if !seen[label] {
+			seen[label] = true
+			unique = append(unique, label)
+		}
+	}
+
+	sort.Strings(unique)
+	return unique
+}
+
+func taskQueue(label string, experimentGuid string) string {
+	queue := "tasks"
+	if label != "" {
+		queue += ":" + label
+	}
+	if experimentGuid != "" {
+		queue += "." + experimentGuid
+	}
+	return queue
+}
+
+func queueRegistry(label string) string {
+	if label == "" {
+		return "queues"
 	}
+	return "queues:" + label
 }
 
 type slave struct {
-	guid string
-	conn redis.Conn
+	guid      string
+	conn      redis.Conn
+	namespace redis.Namespace
 }
 
-func StartSlave(conn redis.Conn, delegate Worker) slave {
+func StartSlave(conn redis.Conn, delegate Worker, labels ...string) slave {
+	return StartSlaveInNamespace(conn, "", delegate, labels...)
+}
+
+func StartSlaveInNamespace(conn redis.Conn, namespace redis.Namespace, delegate Worker, labels ...string) slave {
 	guid, _ := uuid.NewV4()
-	go slaveLoop(conn, delegate, guid.String())
-	return slave{guid.String(), conn}
+	go slaveLoop(conn, namespace, delegate, guid.String(), labels)
+	return slave{guid.String(), conn, namespace}
 }
 
 func (slave slave) Close() error {
-	_, err := slave.conn.Do("RPUSH", "stop-"+slave.guid, true)
+	_, err := slave.conn.Do("RPUSH", slave.namespace.Key("stop-"+slave.guid), true)
 	if err == nil {
-		_, err = slave.conn.Do("BLPOP", "stopped-"+slave.guid, DefaultTimeout)
+		_, err = slave.conn.Do("BLPOP", slave.namespace.Key("stopped-"+slave.guid), DefaultTimeout)
 	}
 
 	logs.NewLogger("redis.slave").Infof("Redis slave shutting down, %v", err)
 	return err
 }
 
-func slaveLoop(conn redis.Conn, delegate Worker, handle string) {
+func slaveLoop(conn redis.Conn, namespace redis.Namespace, delegate Worker, handle string, labels []string) {
 	var redisMsg redisMessage
 
 	logger := logs.NewLogger("redis.slave")
-	logger.Info("Started slave")
+	logger.Infof("Started slave with labels %v", labels)
+
+	stop := namespace.Key("stop-" + handle)
+	registries := []string{namespace.Key(queueRegistry(""))}
+	sharedQueues := []string{namespace.Key(taskQueue("", ""))}
+	for _, label := range labels {
+		registries = append(registries, namespace.Key(queueRegistry(label)))
+		sharedQueues = append(sharedQueues, namespace.Key(taskQueue(label, "")))
+	}
+
+	for turn := 0; ; turn++ {
+		queues := rotate(activeQueues(conn, registries, sharedQueues), turn)
 
-	for {
-		reply, err := redis.Strings(conn.Do("BLPOP", "stop-"+handle, "tasks", 0))
+		args := []interface{}{stop}
+		for _, q := range queues {
+			args = append(args, q)
+		}
+		args = append(args, SlavePollIntervalInSeconds)
+
+		reply, err := redis.Strings(conn.Do("BLPOP", args...))
+
+		if err == redis.ErrNil {
+			continue
+		}
 
 		if len(reply) == 0 {
 			panic("Empty task, usually means connection lost, shutting down")
 		}
 
-		if reply[0] == "stop-"+handle {
-			conn.Do("RPUSH", "stopped-"+handle, true)
+		if reply[0] == stop {
+			workloads.RemoveAllGeneratedApps()
+			conn.Do("RPUSH", namespace.Key("stopped-"+handle), true)
 			break
 		}
 
@@ -106,9 +204,14 @@ func slaveLoop(conn redis.Conn, delegate Worker, handle string) {
 			json.Unmarshal([]byte(reply[1]), &redisMsg)
 
 			go func(experiment string, replyTo string, workloadCtx context.Context) {
+				workloads.DeferLedger(workloadCtx)
 				result := delegate.Time(experiment, workloadCtx)
-				var encoded []byte
-				encoded, err = json.Marshal(result)
+				ledger := workloads.TakeDeferredLedger(workloadCtx)
+				replyCtx, _ := json.Marshal(workloadCtx)
+				encoded, err := json.Marshal(redisReply{result, ledger, replyCtx})
+				if err != nil {
+					logger.Warnf("ERROR: slave could not encode its reply: %v", err)
+				}
 				logger.Debug("Completed slave task, replying")
 				conn.Do("RPUSH", replyTo, string(encoded))
 			}(redisMsg.Workload, redisMsg.Reply, redisMsg.WorkloadContext)
@@ -119,3 +222,39 @@ func slaveLoop(conn redis.Conn, delegate Worker, handle string) {
 		}
 	}
 }
+
+// activeQueues lists the per-experiment queues a slave should serve, dropping
+// queues which have not received a task for longer than a master would wait for a reply
+func activeQueues(conn redis.Conn, registries []string, sharedQueues []string) []string {
+	seen := make(map[string]bool)
+	queues := make([]string, 0)
+	expired := time.Now().Unix() - DefaultTimeout
+	for _, registry := range registries {
+		conn.Do("ZREMRANGEBYSCORE", registry, "-inf", expired)
+		members, _ := redis.Strings(conn.Do("ZRANGE", registry, 0, -1))
+		for _, q := range members {
+			if !seen[q] {
+				seen[q] = true
+				queues = append(queues, q)
+			}
+		}
+	}
+
+	for _, q := range sharedQueues {
+		if !seen[q] {
+			queues = append(queues, q)
+		}
+	}
+	return queues
+}
+
+// rotate changes which queue BLPOP checks first on each turn, so that a busy
+// experiment cannot starve the others
+func rotate(queues []string, turn int) []string {
+	if len(queues) == 0 {
+		return queues
+	}
+
+	n := turn % len(queues)
+	return append(append([]string{}, queues[n:]...), queues[:n]...)
+}
@@ -1,6 +1,7 @@
 package benchmarker
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
 	"os/exec"
@@ -110,6 +111,18 @@ var _ = Describe("RedisWorker", func() {
 				Ω(result.Error).Should(HaveOccurred())
 			})
 
+			It("Merges the context the slave's steps leave behind into the worker's", func() {
+				worker := NewRedisWorker(conn)
+				masterCtx := context.New()
+				masterCtx.PutString("cfUsername", "user1")
+				worker.Time("fooWithContext", masterCtx)
+
+				a, _ := masterCtx.GetInt("a")
+				Ω(a).Should(Equal(1))
+				username, _ := masterCtx.GetString("cfUsername")
+				Ω(username).Should(Equal("user1"))
+			})
+
 			It("Passes workload to each step", func() {
 				worker := NewRedisWorker(conn)
 				worker.Time("fooWithContext,barWithContext", workloadCtx)
@@ -145,6 +158,76 @@ var _ = Describe("RedisWorker", func() {
 				})
 			})
 
+			Describe("When the experiment requests labels", func() {
+				It("does not run the task on an unlabelled slave", func() {
+					worker := NewRedisWorkerWithTimeout(conn, 1)
+					workloadCtx.PutString("labels", "inside")
+					result := worker.Time("foo", workloadCtx)
+					Ω(result.Error).Should(HaveOccurred())
+				})
+
+				Context("And a slave with a matching label is running", func() {
+					var labelledSlave io.Closer
+
+					JustBeforeEach(func() {
+						labelledSlave = StartSlave(conn, delegate, "inside")
+					})
+
+					AfterEach(func() {
+						err := labelledSlave.Close()
+						Ω(err).ShouldNot(HaveOccurred())
+					})
+
+					It("runs the task on the labelled slave", func() {
+						worker := NewRedisWorkerWithTimeout(conn, 2)
+						workloadCtx.PutString("labels", "outside,inside")
+						for i := 0; i < 3; i++ {
+							workloadCtx.PutInt("iterationIndex", i)
+							result := worker.Time("foo", workloadCtx)
+							Ω(result.Error).Should(BeNil())
+							Ω(result.Steps[0].Command).Should(Equal("foo"))
+						}
+					})
+				})
+			})
+
+			Describe("When the experiment has a guid", func() {
+				It("runs the task from the experiment's own queue", func() {
+					worker := NewRedisWorkerWithTimeout(conn, 3)
+					workloadCtx.PutString("experimentGuid", "experiment-1")
+					result := worker.Time("foo", workloadCtx)
+					Ω(result.Error).Should(BeNil())
+					Ω(result.Steps[0].Command).Should(Equal("foo"))
+				})
+			})
+
+			Describe("When the worker uses a different namespace to the slave", func() {
+				It("does not run the task", func() {
+					worker := NewRedisWorkerInNamespace(conn, "someone-else", 1)
+					result := worker.Time("foo", workloadCtx)
+					Ω(result.Error).Should(HaveOccurred())
+				})
+
+				Context("And a slave is running in the same namespace", func() {
+					var namespacedSlave io.Closer
+
+					JustBeforeEach(func() {
+						namespacedSlave = StartSlaveInNamespace(conn, "someone-else", delegate)
+					})
+
+					AfterEach(func() {
+						err := namespacedSlave.Close()
+						Ω(err).ShouldNot(HaveOccurred())
+					})
+
+					It("runs the task", func() {
+						worker := NewRedisWorkerInNamespace(conn, "someone-else", 2)
+						result := worker.Time("foo", workloadCtx)
+						Ω(result.Error).Should(BeNil())
+					})
+				})
+			})
+
 			Describe("Workload context map sending over Redis", func() {
 
 				AfterEach(func() {
@@ -202,6 +285,48 @@ var _ = Describe("RedisWorker", func() {
 	})
 })
 
+var _ = Describe("Redis task queues", func() {
+	It("names queues by label and experiment", func() {
+		Ω(taskQueue("", "")).Should(Equal("tasks"))
+		Ω(taskQueue("inside", "")).Should(Equal("tasks:inside"))
+		Ω(taskQueue("", "abc")).Should(Equal("tasks.abc"))
+		Ω(taskQueue("inside", "abc")).Should(Equal("tasks:inside.abc"))
+	})
+
+	It("sends every task of an experiment with several labels to one queue", func() {
+		ctx := context.New()
+		ctx.PutString("labels", "outside, inside,outside")
+		Ω(labelsFor(ctx)).Should(Equal([]string{"inside", "outside"}))
+		ctx.PutInt("iterationIndex", 1)
+		Ω(labelsFor(ctx)).Should(Equal([]string{"inside", "outside"}))
+	})
+
+	It("rotates the order queues are checked in on each turn", func() {
+		queues := []string{"a", "b", "c"}
+		Ω(rotate(queues, 0)).Should(Equal([]string{"a", "b", "c"}))
+		Ω(rotate(queues, 1)).Should(Equal([]string{"b", "c", "a"}))
+		Ω(rotate(queues, 5)).Should(Equal([]string{"c", "a", "b"}))
+		Ω(queues).Should(Equal([]string{"a", "b", "c"}))
+	})
+})
+
+var _ = Describe("Redis replies", func() {
+	It("carry the iteration's result, the slave's ledger entries and its context back to the master", func() {
+		sent := redisReply{
+			IterationResult{2 * time.Second, []StepResult{}, encodeError(errors.New("Foo")), ""},
+			[]workloads.LedgerEntry{{Kind: workloads.LedgerRoute, Id: "ROUTE-GUID", Worker: 3}},
+			json.RawMessage(`{"token":"TOKEN"}`),
+		}
+		encoded, err := json.Marshal(sent)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var received redisReply
+		err = json.Unmarshal(encoded, &received)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(received).Should(Equal(sent))
+	})
+})
+
 func StartRedis(config string) {
 	_, filename, _, _ := runtime.Caller(0)
 	dir, _ := filepath.Abs(filepath.Dir(filename))
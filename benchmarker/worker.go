@@ -2,7 +2,7 @@ package benchmarker
 
 import (
 	"errors"
-	"strings"
+	"fmt"
 
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/workloads"
@@ -30,20 +30,72 @@ func (self *defaultWorker) Visit(fn func(workloads.WorkloadStep)) {
 }
 
 func (self *defaultWorker) Validate(name string) (ok bool, err error) {
-	ok = true
-	ws := strings.Split(name, ",")
-	for _, w := range ws {
-		var valid = false
-		self.Visit(func(workload workloads.WorkloadStep) {
-			if workload.Name == w {
-				valid = true
+	calls, err := workloads.ParseWorkload(name)
+	if err != nil {
+		return false, err
+	}
+
+	if err := self.validateCalls(calls); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (self *defaultWorker) validateCalls(calls []workloads.StepCall) error {
+	for _, call := range calls {
+		if call.Name == workloads.RandomStep {
+			for _, choice := range call.Choices {
+				if err := self.validateCalls(choice.Steps); err != nil {
+					return err
+				}
 			}
-		})
+			continue
+		}
+		if call.Name == workloads.FaultyStep {
+			if err := self.validateCalls([]workloads.StepCall{*call.Wrapped}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		workload, valid := self.step(call.Name)
 		if !valid {
-			ok = false
-			err = errors.New(w)
-			break
+			return unknownStep(call)
 		}
+		if err := workload.ValidateArguments(call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// step looks up a workload step by name; exec: steps run the named command
+// and so need not be added to the worker, but only run with -allow-exec
+func (self *defaultWorker) step(name string) (workloads.WorkloadStep, bool) {
+	if step, ok := self.Experiments[name]; ok {
+		return step, true
+	}
+	if workloads.IsExecStep(name) && params.allowExec {
+		return workloads.ExecStep(name), true
+	}
+	return workloads.WorkloadStep{}, false
+}
+
+// stepFor looks up the step a call runs and the call to run it with; a
+// faulty(...) call runs the step it wraps, with its faults injected
+func (self *defaultWorker) stepFor(call workloads.StepCall) (workloads.WorkloadStep, workloads.StepCall, bool) {
+	if call.Name == workloads.FaultyStep {
+		step, wrapped, ok := self.stepFor(*call.Wrapped)
+		return call.Faults.Inject(step), wrapped, ok
+	}
+
+	step, ok := self.step(call.Name)
+	return step, call, ok
+}
+
+func unknownStep(call workloads.StepCall) error {
+	if workloads.IsExecStep(call.Name) && !params.allowExec {
+		return fmt.Errorf("%s (exec: steps are disabled, run PAT with -allow-exec to enable them)", call.Text)
 	}
-	return
+	return errors.New(call.Text)
 }
@@ -48,6 +48,24 @@ var _ = Describe("LocalWorker", func() {
 			Ω(err.Error()).Should(ContainSubstring("bar"))
 			Ω(ok).Should(BeFalse())
 		})
+
+		It("Accepts exec steps without them being added when they are allowed", func() {
+			params.allowExec = true
+			defer func() { params.allowExec = false }()
+
+			worker := &defaultWorker{make(map[string]WorkloadStep)}
+			ok, err := worker.Validate("exec:./deploy.sh")
+			Ω(err).Should(BeNil())
+			Ω(ok).Should(BeTrue())
+		})
+
+		It("Rejects exec steps by default", func() {
+			worker := &defaultWorker{make(map[string]WorkloadStep)}
+			ok, err := worker.Validate("exec:./deploy.sh")
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.Error()).Should(ContainSubstring("-allow-exec"))
+			Ω(ok).Should(BeFalse())
+		})
 	})
 
 	Describe("When multiple steps are provided separated by commas", func() {
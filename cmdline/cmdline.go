@@ -1,10 +1,13 @@
 package cmdline
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/benchmarker"
@@ -19,28 +22,82 @@ import (
 var params = struct {
 	app                 string
 	manifest            string
+	cfMemory            string
+	cfInstances         string
+	cfOrg               string
+	cfTraceDir          string
 	iterations          int
 	listWorkloads       bool
 	concurrency         string
 	concurrencyStepTime int
 	silent              bool
 	workload            string
+	setup               string
+	setupScope          string
+	teardown            string
+	scenario            string
 	interval            int
 	stop                int
 	restUser            string
 	restPass            string
 	restTarget          string
 	restSpace           string
+	restClientId        string
+	restClientSecret    string
+	restGrantType       string
+	restCredentials     string
+	provisionUsers      int
+	restInstances       int
+	restMemory          int
+	restEnv             string
+	restService         string
+	restServicePlan     string
+	restServiceTimeout  int
+	restV3Timeout       int
+	restStartTimeout    int
+	restRoutesPerPage   int
+	resourceMatching    bool
+	appLanguage         string
+	appFiles            int
+	appBytes            int
+	labels              string
+	httpMethod          string
+	httpUrl             string
+	httpHeaders         string
+	httpBody            string
+	httpExpectStatus    int
+	httpExpectBody      string
+	httpExpectJson      string
+	appDomain           string
+	appRouteTimeout     int
+	logLines            int
+	logEndpoint         string
+	logTimeout          int
+	ledgerDir           string
+	fakeCf              bool
+	fakeCfAddress       string
+	fakeCfLatency       string
+	fakeCfStagingTime   string
+	fakeCfErrorRate     string
+	fakeCfStagingFails  string
 }{}
 
 func InitCommandLineFlags(config config.Config) {
 	config.StringVar(&params.app, "app", "assets/dora", "filepath to app, defaults to provided dora in assets")
 	config.StringVar(&params.manifest, "app:manifest", "", "filepath to cf manifest for the app")
+	config.StringVar(&params.cfMemory, "cf:memory", "", "memory limit of apps pushed by cf:push, e.g. 256M, defaults to 64M unless app:manifest is given")
+	config.StringVar(&params.cfInstances, "cf:instances", "", "number of instances of apps pushed by cf:push, defaults to the app:manifest's or 1")
+	config.StringVar(&params.cfOrg, "cf:org", "", "org targeted by cf:login, needed if the users belong to more than one org")
+	config.StringVar(&params.cfTraceDir, "cf:trace-dir", workloads.DefaultCfTraceDir, "directory the cf:* workloads write CF_TRACE files to, kept for failed iterations; empty to turn tracing off")
 	config.IntVar(&params.iterations, "iterations", 1, "number of pushes to attempt")
 	config.StringVar(&params.concurrency, "concurrency", "1", "number of workers to execute the workload in parallel, can be static or ramping up, i.e. 1..3")
 	config.IntVar(&params.concurrencyStepTime, "concurrency:timeBetweenSteps", 60, "seconds between adding additonal workers when ramping works up")
 	config.BoolVar(&params.silent, "silent", false, "true to run silently and exit without interaction when finished")
 	config.StringVar(&params.workload, "workload", "cf:push", "a comma-separated list of operations a user should issue (use -list-workloads to see available workload options)")
+	config.StringVar(&params.setup, "setup", "", "a comma-separated list of operations to run before the -workload iterations, e.g. rest:target,rest:login, timed separately")
+	config.StringVar(&params.setupScope, "setup:scope", PerWorker, "'worker' to run -setup and -teardown in each worker, or 'experiment' to run them once, sharing the setup's results with every worker")
+	config.StringVar(&params.teardown, "teardown", "", "a comma-separated list of operations to run after the -workload iterations, timed separately")
+	config.StringVar(&params.scenario, "scenario", "", "a YAML scenario file describing the setup, iteration and teardown steps, used in place of -workload, -setup, -setup:scope and -teardown")
 	config.IntVar(&params.interval, "interval", 0, "repeat a workload every n seconds, to be used with -stop")
 	config.IntVar(&params.stop, "stop", 0, "repeat a repeating interval until n seconds, to be used with -interval")
 	config.BoolVar(&params.listWorkloads, "list-workloads", false, "Lists the available workloads")
@@ -48,16 +105,71 @@ func InitCommandLineFlags(config config.Config) {
 	config.StringVar(&params.restUser, "rest:username", "", "username for REST api")
 	config.StringVar(&params.restPass, "rest:password", "", "password for REST api")
 	config.StringVar(&params.restSpace, "rest:space", "dev", "space to target for REST api")
+	config.StringVar(&params.restClientId, "rest:client-id", workloads.DefaultClientId, "OAuth client id rest:login uses to get tokens from UAA")
+	config.StringVar(&params.restClientSecret, "rest:client-secret", "", "OAuth client secret rest:login uses to get tokens from UAA")
+	config.StringVar(&params.restGrantType, "rest:grant-type", "password", "OAuth grant rest:login uses, either password (using rest:username and rest:password) or client_credentials")
+	config.StringVar(&params.restCredentials, "rest:credentials", "", "a .csv (username,password rows) or .yml file of users for rest:login, used instead of rest:username and rest:password")
+	config.IntVar(&params.provisionUsers, "rest:provision-users", 0, "number of users, all developers in one rest:space of a new org, to create for rest:login before the run and delete afterwards (requires a rest:client-id with scim.write and cloud_controller.admin)")
+	config.IntVar(&params.restInstances, "rest:instances", workloads.DefaultScaleInstances, "number of instances the rest:scale workload scales an app to")
+	config.IntVar(&params.restMemory, "rest:memory", 0, "memory in MB the rest:scale workload gives an app, unchanged if 0")
+	config.StringVar(&params.restEnv, "rest:env", "", "environment variables set by the rest:update-env workload, as a |-separated list of NAME=value pairs")
+	config.StringVar(&params.restService, "rest:service", "", "label of the service offering used by the rest:create-service workload")
+	config.StringVar(&params.restServicePlan, "rest:service-plan", "", "name of the service plan used by the rest:create-service workload")
+	config.IntVar(&params.restStartTimeout, "rest:start-timeout", workloads.DefaultAppStartTimeoutInSeconds, "seconds the rest:push, rest:start and rest:restart workloads wait for an app to stage and start")
+	config.IntVar(&params.restV3Timeout, "rest:v3-timeout", workloads.DefaultV3TimeoutInSeconds, "seconds the rest:v3:upload, rest:v3:stage and rest:v3:start workloads wait for a package or build to be processed, or the app to start")
+	config.IntVar(&params.restServiceTimeout, "rest:service-timeout", workloads.DefaultServiceTimeoutInSeconds, "seconds the rest:create-service and rest:delete-service workloads wait for an asynchronous broker")
+	config.IntVar(&params.restRoutesPerPage, "rest:routes-per-page", workloads.DefaultRoutesPerPage, "page size used by the rest:list-routes workload")
+	config.BoolVar(&params.resourceMatching, "rest:resource-matching", false, "true to skip uploading files the Cloud Controller already has when rest:push uploads the app")
+	config.StringVar(&params.httpMethod, "http:method", "GET", "HTTP method for the http:request workload")
+	config.StringVar(&params.httpUrl, "http:url", "", "URL for the http:request workload, may use workload context values, e.g. http://{{.appNames}}.example.com")
+	config.StringVar(&params.httpHeaders, "http:headers", "", "headers for the http:request workload, as a |-separated list of 'Name: value' pairs")
+	config.StringVar(&params.httpBody, "http:body", "", "request body template for the http:request workload")
+	config.IntVar(&params.httpExpectStatus, "http:expect-status", 0, "status code the http:request workload should receive, defaults to any non-error status")
+	config.StringVar(&params.httpExpectBody, "http:expect-body", "", "text the http:request workload's response body should contain")
+	config.StringVar(&params.httpExpectJson, "http:expect-json", "", "a dot-separated JSON path (optionally path=value) the http:request workload's response body should contain")
+	config.StringVar(&params.appLanguage, "app:language", "ruby", "buildpack of the app generated by the app:generate workload, one of "+strings.Join(workloads.AppLanguages(), ", "))
+	config.IntVar(&params.appFiles, "app:files", 1, "number of random payload files in the app generated by the app:generate workload")
+	config.IntVar(&params.appBytes, "app:bytes", 0, "total size in bytes of the random payload in the app generated by the app:generate workload")
+	config.StringVar(&params.appDomain, "app:domain", "", "domain of pushed apps' routes for the app:firstRequest workload, defaults to the rest:target domain without 'api.'")
+	config.IntVar(&params.appRouteTimeout, "app:routeTimeout", workloads.DefaultRouteTimeoutInSeconds, "seconds the app:firstRequest workload waits for a pushed app to respond with 200")
+	config.IntVar(&params.logLines, "logs:lines", workloads.DefaultLogLines, "number of lines the app:logs workload has the app log")
+	config.StringVar(&params.logEndpoint, "logs:endpoint", "", "URL the app:logs workload reads the app's logs from, may use workload context values and {{.appGuid}}, defaults to the target's doppler recent logs")
+	config.IntVar(&params.logTimeout, "logs:timeout", workloads.DefaultLogTimeoutInSeconds, "seconds the app:logs workload waits for the logged lines to arrive before counting the rest as lost")
+	config.StringVar(&params.ledgerDir, "ledger-dir", workloads.DefaultLedgerDir, "directory recording the apps, routes and services each experiment creates, so that they are deleted when it ends or is interrupted (or later, with 'pat cleanup <experiment guid>')")
+	config.BoolVar(&params.fakeCf, "fake-cf", false, "true to run the rest workloads against a fake Cloud Foundry served by PAT itself, in place of -rest:target")
+	config.StringVar(&params.fakeCfAddress, "fake-cf:address", "127.0.0.1:0", "address the -fake-cf Cloud Foundry listens on, any free port by default")
+	config.StringVar(&params.fakeCfLatency, "fake-cf:latency", "", "time the -fake-cf Cloud Foundry takes to answer each request, e.g. 200ms, 200ms±100ms (uniform) or 200ms~50ms (normal)")
+	config.StringVar(&params.fakeCfStagingTime, "fake-cf:staging-time", "", "time apps take to stage on the -fake-cf Cloud Foundry, in the form of -fake-cf:latency")
+	config.StringVar(&params.fakeCfErrorRate, "fake-cf:error-rate", "", "fraction of requests the -fake-cf Cloud Foundry fails with a 500, e.g. 5%")
+	config.StringVar(&params.fakeCfStagingFails, "fake-cf:staging-failure-rate", "", "fraction of apps that fail to stage on the -fake-cf Cloud Foundry, e.g. 5%")
+	config.StringVar(&params.labels, "labels", "", "a comma-separated list of slave labels allowed to run the workload (requires -use-redis-worker)")
 	benchmarker.DescribeParameters(config)
 	store.DescribeParameters(config)
 }
 
 func RunCommandLine() error {
+	if params.scenario != "" {
+		if err := applyScenario(params.scenario); err != nil {
+			return err
+		}
+	}
+
+	if params.fakeCf {
+		fake, err := startFakeCf()
+		if err != nil {
+			return err
+		}
+		defer fake.Stop()
+	}
+
 	params.workload = strings.Replace(params.workload, " ", "", -1)
+	params.setup = strings.Replace(params.setup, " ", "", -1)
+	params.teardown = strings.Replace(params.teardown, " ", "", -1)
 
 	workloadContext := NewContext()
-	workloads.PopulateRestContext(params.restTarget, params.restUser, params.restPass, params.restSpace, workloadContext)
-	workloads.PopulateAppContext(params.app, params.manifest, workloadContext)
+	if err := populateContext(workloadContext); err != nil {
+		return err
+	}
 
 	return WithConfiguredWorkerAndSlaves(func(worker benchmarker.Worker) error {
 		return validateParameters(worker, func() error {
@@ -69,6 +181,21 @@ func RunCommandLine() error {
 				}
 				parsedConcurrencyStepTime := parseConcurrencyStepTime(params.concurrencyStepTime)
 
+				// the users are torn down when the run ends or is interrupted, whichever is first
+				teardownUsers := func() {}
+				if params.provisionUsers > 0 {
+					provisioned, err := ProvisionUsers(workloadContext, params.provisionUsers)
+					var once sync.Once
+					teardownUsers = func() {
+						once.Do(func() { TeardownUsers(workloadContext, provisioned) })
+					}
+					defer teardownUsers()
+					if err != nil {
+						return err
+					}
+					workloads.PopulateCredentialsContext(provisioned.Credentials, workloadContext)
+				}
+
 				lab := LaboratoryFactory(store)
 
 				handlers := make([]func(<-chan *Sample), 0)
@@ -91,22 +218,99 @@ func RunCommandLine() error {
 					})
 				}
 
-				lab.RunWithHandlers(
-					NewRunnableExperiment(
-						NewExperimentConfiguration(
-							params.iterations, parsedConcurrency, parsedConcurrencyStepTime, params.interval, params.stop, worker, params.workload)), handlers, workloadContext)
+				experiment := NewRunnableExperiment(
+					NewExperimentConfiguration(
+						params.iterations, parsedConcurrency, parsedConcurrencyStepTime, params.interval, params.stop, worker, params.workload, benchmarker.ParseLabels(params.labels), params.setup, params.setupScope, params.teardown))
+				experimentGuid, _ := lab.RunWithHandlers(experiment, handlers, workloadContext)
+
+				// the workers are stopped before cleaning up, so that nothing they are
+				// still creating is missed
+				OnInterrupt(func() {
+					fmt.Println("Waiting for the running iterations to finish (interrupt again to exit at once)...")
+					experiment.Quit()
+					cleanup(workloadContext, experimentGuid)
+					teardownUsers()
+				})
 
 				if params.silent {
 					SilentExit(exitBlocker)
 				} else {
 					BlockExit()
 				}
+				experiment.Quit()
+
+				if cleanupErr := cleanup(workloadContext, experimentGuid); cleanupErr != nil && err == nil {
+					err = cleanupErr
+				}
 				return err
 			})
 		})
 	})
 }
 
+// RunCleanup retries the cleanup of experiments whose resources were not all
+// deleted when they ended
+func RunCleanup(experimentGuids []string) error {
+	if len(experimentGuids) == 0 {
+		return errors.New("usage: pat cleanup <experiment guid>...")
+	}
+
+	workloadContext := NewContext()
+	if err := populateContext(workloadContext); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, guid := range experimentGuids {
+		if err := cleanup(workloadContext, guid); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func cleanup(workloadContext context.Context, experimentGuid string) error {
+	if experimentGuid == "" {
+		return nil
+	}
+
+	if err := CleanupExperiment(workloadContext, experimentGuid); err != nil {
+		fmt.Printf("Some resources of experiment %s could not be deleted (retry with 'pat cleanup %s'): %v\n", experimentGuid, experimentGuid, err)
+		return err
+	}
+	return nil
+}
+
+func populateContext(workloadContext context.Context) error {
+	workloads.PopulateRestContext(params.restTarget, params.restUser, params.restPass, params.restSpace, workloadContext)
+	workloads.PopulateOAuthContext(params.restClientId, params.restClientSecret, params.restGrantType, workloadContext)
+	workloads.PopulateAppLifecycleContext(params.restInstances, params.restMemory, params.restEnv, workloadContext)
+	workloads.PopulateServiceContext(params.restService, params.restServicePlan, params.restServiceTimeout, workloadContext)
+	workloads.PopulateV3Context(params.restV3Timeout, workloadContext)
+	workloads.PopulateAppStartContext(params.restStartTimeout, workloadContext)
+	workloads.PopulateRoutesContext(params.restRoutesPerPage, workloadContext)
+	workloads.PopulatePushContext(params.resourceMatching, workloadContext)
+	workloads.PopulateGeneratorContext(params.appLanguage, params.appFiles, params.appBytes, workloadContext)
+	workloads.PopulateAppContext(params.app, params.manifest, workloadContext)
+	workloads.PopulateCfPushContext(params.cfMemory, params.cfInstances, workloadContext)
+	workloads.PopulateCfLoginContext(params.cfOrg, workloadContext)
+	workloads.PopulateCfTraceContext(params.cfTraceDir, workloadContext)
+	workloads.PopulateRouteContext(params.appDomain, params.appRouteTimeout, workloadContext)
+	workloads.PopulateLogsContext(params.logLines, params.logEndpoint, params.logTimeout, workloadContext)
+	workloads.PopulateHttpContext(params.httpMethod, params.httpUrl, params.httpHeaders, params.httpBody, params.httpExpectStatus, params.httpExpectBody, params.httpExpectJson, workloadContext)
+	workloads.PopulateLedgerContext(params.ledgerDir, workloadContext)
+
+	if params.restCredentials != "" {
+		credentials, err := workloads.LoadCredentials(params.restCredentials)
+		if err != nil {
+			return err
+		}
+		workloads.PopulateCredentialsContext(credentials, workloadContext)
+	}
+
+	return nil
+}
+
 func parseConcurrency(concurrency string) ([]int, error) {
 	rawConcurrency := strings.SplitN(concurrency, "..", 2)
 	parsedConcurrency := make([]int, len(rawConcurrency))
@@ -128,13 +332,48 @@ func parseConcurrencyStepTime(concurrencyStepTime int) time.Duration {
 	return parsedConcurrencyStepTime
 }
 
+func applyScenario(path string) error {
+	scenario, err := workloads.LoadScenario(path)
+	if err != nil {
+		return fmt.Errorf("Could not load scenario %s: %v", path, err)
+	}
+
+	params.workload = scenario.Workload
+	params.setup = scenario.Setup
+	params.teardown = scenario.Teardown
+	if scenario.SetupScope != "" {
+		params.setupScope = scenario.SetupScope
+	}
+	return nil
+}
+
 func validateParameters(worker benchmarker.Worker, then func() error) error {
 	if params.listWorkloads {
 		worker.Visit(PrintWorkload)
 		return nil
 	}
 
-	var ok, err = worker.Validate(params.workload)
+	if params.setupScope != PerWorker && params.setupScope != PerExperiment {
+		return fmt.Errorf("Invalid setup:scope '%s', expected '%s' or '%s'", params.setupScope, PerWorker, PerExperiment)
+	}
+
+	if err := validateWorkload(worker, params.workload); err != nil {
+		return err
+	}
+	for _, workload := range []string{params.setup, params.teardown} {
+		if workload == "" {
+			continue
+		}
+		if err := validateWorkload(worker, workload); err != nil {
+			return err
+		}
+	}
+
+	return then()
+}
+
+func validateWorkload(worker benchmarker.Worker, workload string) error {
+	var ok, err = worker.Validate(workload)
 
 	if !ok {
 		fmt.Printf("Invalid workload: '%s'\n\n", err)
@@ -142,8 +381,7 @@ func validateParameters(worker benchmarker.Worker, then func() error) error {
 		worker.Visit(PrintWorkload)
 		return err
 	}
-
-	return then()
+	return nil
 }
 
 var WithConfiguredWorkerAndSlaves = func(fn func(worker benchmarker.Worker) error) error {
@@ -171,8 +409,37 @@ var SilentExit = func(e <-chan int) {
 	return
 }
 
+var CleanupExperiment = func(workloadContext context.Context, experimentGuid string) error {
+	return workloads.NewRestWorkload().Cleanup(workloadContext, experimentGuid)
+}
+
+var ProvisionUsers = func(workloadContext context.Context, count int) (workloads.ProvisionedUsers, error) {
+	return workloads.NewRestWorkload().ProvisionUsers(workloadContext, count)
+}
+
+var TeardownUsers = func(workloadContext context.Context, provisioned workloads.ProvisionedUsers) error {
+	return workloads.NewRestWorkload().TeardownUsers(workloadContext, provisioned)
+}
+
+var OnInterrupt = func(fn func()) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		go func() {
+			fn()
+			os.Exit(130)
+		}()
+		<-interrupts
+		os.Exit(130)
+	}()
+}
+
 var PrintWorkload = func(workload workloads.WorkloadStep) {
 	fmt.Printf("\x1b[1m%s\x1b[0m\n\t%s\n", workload.Name, workload.Description)
+	for _, p := range workload.Parameters {
+		fmt.Printf("\t\x1b[36m%s\x1b[0m=... %s (defaults to -%s)\n", p.Name, p.Description, p.ContextKey)
+	}
 }
 
 var NewContext = func() context.Context {
@@ -2,6 +2,8 @@ package cmdline_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/benchmarker"
@@ -17,10 +19,12 @@ import (
 
 var _ = Describe("Cmdline", func() {
 	var (
-		flags config.Config
-		args  []string
-		lab   *dummyLab
-		err   error
+		flags          config.Config
+		args           []string
+		lab            *dummyLab
+		err            error
+		cleanedUp      []string
+		interruptClean func()
 	)
 
 	BeforeEach(func() {
@@ -37,6 +41,15 @@ var _ = Describe("Cmdline", func() {
 			newLab = lab
 			return
 		}
+
+		cleanedUp = make([]string, 0)
+		CleanupExperiment = func(ctx context.Context, experimentGuid string) error {
+			cleanedUp = append(cleanedUp, experimentGuid)
+			return nil
+		}
+		OnInterrupt = func(fn func()) {
+			interruptClean = fn
+		}
 	})
 
 	JustBeforeEach(func() {
@@ -207,6 +220,171 @@ var _ = Describe("Cmdline", func() {
 		})
 	})
 
+	Describe("When -labels is supplied", func() {
+		BeforeEach(func() {
+			args = []string{"-labels", "inside, outside"}
+		})
+
+		It("configures the experiment with the parsed labels", func() {
+			Ω(lab).Should(HaveBeenRunWith("labels", []string{"inside", "outside"}))
+		})
+	})
+
+	Describe("When -setup and -teardown are supplied", func() {
+		BeforeEach(func() {
+			args = []string{"-setup", "login", "-setup:scope", "experiment", "-teardown", "cf:push", "-workload", "push"}
+		})
+
+		It("configures the experiment with the parameters", func() {
+			Ω(lab).Should(HaveBeenRunWith("setup", "login"))
+			Ω(lab).Should(HaveBeenRunWith("setupscope", "experiment"))
+			Ω(lab).Should(HaveBeenRunWith("teardown", "cf:push"))
+		})
+
+		Context("with an unknown workload", func() {
+			BeforeEach(func() {
+				lab = nil
+				args = []string{"-setup", "nope"}
+			})
+
+			It("does not run the experiment", func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(lab).Should(BeNil())
+			})
+		})
+
+		Context("with an unknown scope", func() {
+			BeforeEach(func() {
+				lab = nil
+				args = []string{"-setup:scope", "iteration"}
+			})
+
+			It("does not run the experiment", func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(lab).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("When -scenario is supplied", func() {
+		var path string
+
+		BeforeEach(func() {
+			f, _ := ioutil.TempFile("", "scenario")
+			f.WriteString("setup: [login]\nsetup-scope: experiment\niteration: [push, {step: push, repeat: 2}]\n")
+			f.Close()
+			path = f.Name()
+			args = []string{"-scenario", path, "-workload", "login"}
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("configures the experiment with the scenario's steps", func() {
+			Ω(lab).Should(HaveBeenRunWith("workload", "push,push,push"))
+			Ω(lab).Should(HaveBeenRunWith("setup", "login"))
+			Ω(lab).Should(HaveBeenRunWith("setupscope", "experiment"))
+		})
+
+		Context("with a missing file", func() {
+			BeforeEach(func() {
+				lab = nil
+				args = []string{"-scenario", "does/not/exist.yml"}
+			})
+
+			It("does not run the experiment", func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(lab).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("When -fake-cf is supplied", func() {
+		var ctx context.Context
+
+		BeforeEach(func() {
+			ctx = context.New()
+			NewContext = func() context.Context {
+				return ctx
+			}
+			args = []string{"-fake-cf", "-rest:target", "someTarget", "-fake-cf:latency", "10ms±5ms"}
+		})
+
+		It("targets the rest workloads at the fake", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			target, _ := ctx.GetString("rest:target")
+			Ω(target).Should(ContainSubstring("http://127.0.0.1:"))
+		})
+
+		Context("with an invalid latency", func() {
+			BeforeEach(func() {
+				lab = nil
+				args = []string{"-fake-cf", "-fake-cf:latency", "soon"}
+			})
+
+			It("does not run the experiment", func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(lab).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("Cleaning up", func() {
+		BeforeEach(func() {
+			args = []string{"-ledger-dir", "some/dir"}
+		})
+
+		It("cleans up the experiment when it ends", func() {
+			Ω(cleanedUp).Should(Equal([]string{"EXPERIMENT-GUID"}))
+		})
+
+		It("cleans up the experiment when interrupted", func() {
+			cleanedUp = make([]string, 0)
+			interruptClean()
+			Ω(cleanedUp).Should(Equal([]string{"EXPERIMENT-GUID"}))
+		})
+
+		It("retries the cleanup of the given experiments", func() {
+			cleanedUp = make([]string, 0)
+			err := RunCleanup([]string{"GUID-1", "GUID-2"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cleanedUp).Should(Equal([]string{"GUID-1", "GUID-2"}))
+		})
+
+		It("requires an experiment guid to retry", func() {
+			err := RunCleanup([]string{})
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("When -rest:provision-users is supplied", func() {
+		var tornDown []string
+
+		BeforeEach(func() {
+			args = []string{"-rest:provision-users", "2"}
+			tornDown = make([]string, 0)
+			ProvisionUsers = func(ctx context.Context, count int) (workloads.ProvisionedUsers, error) {
+				return workloads.ProvisionedUsers{OrgGuid: "ORG-GUID"}, nil
+			}
+			TeardownUsers = func(ctx context.Context, provisioned workloads.ProvisionedUsers) error {
+				tornDown = append(tornDown, provisioned.OrgGuid)
+				return nil
+			}
+		})
+
+		It("tears the users down when the run ends", func() {
+			Ω(tornDown).Should(Equal([]string{"ORG-GUID"}))
+		})
+
+		It("tears the users down once, after cleaning up, when interrupted", func() {
+			cleanedUp = make([]string, 0)
+			interruptClean()
+			Ω(cleanedUp).Should(Equal([]string{"EXPERIMENT-GUID"}))
+			Ω(tornDown).Should(Equal([]string{"ORG-GUID"}))
+		})
+	})
+
 	Describe("When -concurrency:timeBetweenSteps is supplied", func() {
 		BeforeEach(func() {
 			args = []string{"-concurrency:timeBetweenSteps", "3"}
@@ -244,6 +422,14 @@ func (m *runWithMatcher) Match(actualLab interface{}) (bool, error) {
 		actual = runWith.Stop
 	case "concurrencysteptime":
 		actual = runWith.ConcurrencyStepTime
+	case "labels":
+		actual = runWith.Labels
+	case "setup":
+		actual = runWith.Setup
+	case "setupscope":
+		actual = runWith.SetupScope
+	case "teardown":
+		actual = runWith.Teardown
 	}
 	m.lastMatch = actual
 	return Equal(actual).Match(m.value)
@@ -271,7 +457,7 @@ func (d *dummyLab) Run(runnable laboratory.Runnable, workloadCtx context.Context
 
 func (d *dummyLab) RunWithHandlers(runnable laboratory.Runnable, handlers []func(<-chan *experiment.Sample), workloadCtx context.Context) (string, error) {
 	d.lastRunWith = runnable.(*experiment.RunnableExperiment)
-	return "", nil
+	return "EXPERIMENT-GUID", nil
 }
 
 func (d *dummyLab) Visit(func(experiment.Experiment)) {
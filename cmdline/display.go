@@ -3,8 +3,10 @@ package cmdline
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/workloads"
 )
 
 func display(concurrency string, iterations int, interval int, stop int, concurrencyStepTime int, samples <-chan *experiment.Sample) {
@@ -37,9 +39,28 @@ func display(concurrency string, iterations int, interval int, stop int, concurr
 			fmt.Printf("\x1b[1m\tTotal time\x1b[0m:            \x1b[36m%v\x1b[0m\n", command.TotalTime)
 			fmt.Printf("\x1b[1m\tPer second throughput\x1b[0m: \x1b[36m%v\x1b[0m\n", command.Throughput)
 		}
+		if len(s.Metrics) > 0 {
+			fmt.Println()
+			fmt.Println("\x1b[32;1mMetrics:\x1b[0m")
+			fmt.Println()
+			for key, metric := range s.Metrics {
+				fmt.Printf("\x1b[1m%v\x1b[0m (%v):\n", key, metric.Kind)
+				fmt.Printf("\x1b[1m\tCount\x1b[0m:                 \x1b[36m%v\x1b[0m\n", metric.Count)
+				if metric.Kind == workloads.CounterMetric {
+					fmt.Printf("\x1b[1m\tTotal\x1b[0m:                 \x1b[36m%v\x1b[0m\n", metric.Total)
+				}
+				fmt.Printf("\x1b[1m\tAverage\x1b[0m:               \x1b[36m%v\x1b[0m\n", metricValue(metric.Kind, metric.Average))
+				fmt.Printf("\x1b[1m\tLast\x1b[0m:                  \x1b[36m%v\x1b[0m\n", metricValue(metric.Kind, metric.Last))
+				fmt.Printf("\x1b[1m\tMin\x1b[0m:                   \x1b[36m%v\x1b[0m\n", metricValue(metric.Kind, metric.Min))
+				fmt.Printf("\x1b[1m\tMax\x1b[0m:                   \x1b[36m%v\x1b[0m\n", metricValue(metric.Kind, metric.Max))
+			}
+		}
 		fmt.Println("┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄")
-		if s.TotalErrors > 0 {
+		if s.TotalErrors > 0 || s.StageErrors > 0 {
 			fmt.Printf("\nTotal errors: %d\n", s.TotalErrors)
+			if s.StageErrors > 0 {
+				fmt.Printf("Setup and teardown errors: %d\n", s.StageErrors)
+			}
 			fmt.Printf("Last error: %v\n", s.LastError)
 		}
 		fmt.Println()
@@ -47,6 +68,13 @@ func display(concurrency string, iterations int, interval int, stop int, concurr
 	}
 }
 
+func metricValue(kind string, value float64) interface{} {
+	if kind == workloads.TimingMetric {
+		return time.Duration(value)
+	}
+	return value
+}
+
 func totalIterations(iterations int, interval int, stopTime int) int64 {
 	var totalIterations int
 
@@ -0,0 +1,33 @@
+package cmdline
+
+import (
+	"github.com/cloudfoundry-incubator/pat/fakecf"
+	"github.com/cloudfoundry-incubator/pat/workloads"
+)
+
+// startFakeCf serves a fake Cloud Foundry for the run and targets the rest
+// workloads at it, so that PAT can be exercised without a real one
+func startFakeCf() (*fakecf.FakeCF, error) {
+	var config fakecf.Config
+	var err error
+	if config.Latency, err = workloads.ParseDelay(params.fakeCfLatency); err != nil {
+		return nil, err
+	}
+	if config.StagingTime, err = workloads.ParseDelay(params.fakeCfStagingTime); err != nil {
+		return nil, err
+	}
+	if config.ErrorRate, err = workloads.ParseRate(params.fakeCfErrorRate); err != nil {
+		return nil, err
+	}
+	if config.StagingFailureRate, err = workloads.ParseRate(params.fakeCfStagingFails); err != nil {
+		return nil, err
+	}
+
+	fake := fakecf.New(config)
+	if err := fake.Start(params.fakeCfAddress); err != nil {
+		return nil, err
+	}
+
+	params.restTarget = fake.URL()
+	return fake, nil
+}
@@ -0,0 +1,45 @@
+package cmdline
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry-incubator/pat/config"
+	"github.com/cloudfoundry-incubator/pat/logs"
+	"github.com/cloudfoundry-incubator/pat/server"
+)
+
+// Main runs PAT as the pat executable does, so that a program which registers
+// its own workloads with workloads.Register can build a PAT binary including them
+func Main() {
+	useServer := false
+	flags := config.ConfigAndFlags
+	flags.BoolVar(&useServer, "server", false, "true to run the HTTP server interface")
+
+	logs.InitCommandLineFlags(flags)
+	InitCommandLineFlags(flags)
+	server.InitCommandLineFlags(flags)
+	err := flags.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(10)
+	}
+
+	if useServer == true {
+		logs.NewLogger("main").Info("Starting in server mode")
+		server.LedgerDir = params.ledgerDir
+		server.Serve()
+	} else if args := flags.Args(); len(args) > 0 && args[0] == "cleanup" {
+		err = RunCleanup(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(20)
+		}
+	} else {
+		err = RunCommandLine()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(20)
+		}
+	}
+}
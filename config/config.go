@@ -83,6 +83,11 @@ func (f *f) Parse(args []string) error {
 	return nil
 }
 
+// Args returns the arguments left after the flags
+func (f *f) Args() []string {
+	return f.flagSet.Args()
+}
+
 func (f *f) ParseEnv() error {
 	for _, e := range f.envVars {
 		if value := os.Getenv(e.name); value != "" {
@@ -14,6 +14,7 @@ type Context interface {
 	GetFloat64(k string) (float64, bool)
 	PutBool(k string, v bool)
 	GetBool(k string) (bool, bool)
+	Delete(k string)
 	MarshalJSON() ([]byte, error)
 	UnmarshalJSON(b []byte) error
 	Clone() contextMap
@@ -76,6 +77,10 @@ func (c contextMap) GetBool(k string) (bool, bool) {
 	}
 }
 
+func (c contextMap) Delete(k string) {
+	delete(c, k)
+}
+
 func (c contextMap) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]interface{}(c))
 }
@@ -59,6 +59,16 @@ var _ = Describe("Context map", func() {
 		})
 	})
 
+	Context("Deleting values", func() {
+		It("removes the key from the context map", func() {
+			localContext.PutString("key", "abc")
+			localContext.Delete("key")
+
+			_, exists := localContext.GetString("key")
+			Ω(exists).Should(Equal(false))
+		})
+	})
+
 	Context("Cloning map", func() {
 		It("returns a copy of the cloned context map", func() {
 			localContext.PutString("str1", "abc")
@@ -1,11 +1,16 @@
 package experiment
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
+	"strings"
+	"sync"
 	"time"
 
 	. "github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/workloads"
 )
 
 type SampleType int
@@ -27,6 +32,18 @@ type Command struct {
 	WorstTime  time.Duration
 }
 
+// Metric aggregates the values workload steps report with workloads.Count,
+// workloads.Gauge and workloads.Timing; timings are in nanoseconds
+type Metric struct {
+	Kind    string
+	Count   int64
+	Average float64
+	Total   float64
+	Last    float64
+	Min     float64
+	Max     float64
+}
+
 type Sample struct {
 	Commands              map[string]Command
 	Average               time.Duration
@@ -34,6 +51,7 @@ type Sample struct {
 	SystemTime            string
 	Total                 int64
 	TotalErrors           int
+	StageErrors           int
 	TotalWorkers          int
 	LastResult            time.Duration
 	LastError             string
@@ -41,6 +59,7 @@ type Sample struct {
 	NinetyfifthPercentile time.Duration
 	WallTime              time.Duration
 	Type                  SampleType
+	Metrics               map[string]Metric
 }
 
 type Experiment interface {
@@ -56,12 +75,35 @@ type ExperimentConfiguration struct {
 	Stop                int
 	Worker              Worker
 	Workload            string
+	Labels              []string
+	Setup               string
+	SetupScope          string
+	Teardown            string
 }
 
+// setup and teardown workloads run either in each worker's context, around
+// its iterations, or once in the context every worker clones
+const (
+	PerWorker     = "worker"
+	PerExperiment = "experiment"
+)
+
 type RunnableExperiment struct {
 	ExperimentConfiguration
 	executerFactory func(iterationResults chan IterationResult, errors chan error, workers chan int, quit chan bool) Executable
 	samplerFactory  func(iterations int, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable
+	stopper         *stopper
+}
+
+// stopper ends a running experiment early: closing quit stops any more
+// iterations and workers being scheduled, and done is closed once the
+// running ones have finished
+type stopper struct {
+	sync.Mutex
+	quit    chan bool
+	done    chan bool
+	running bool
+	stopped bool
 }
 
 type ExecutableExperiment struct {
@@ -88,12 +130,38 @@ type Samplable interface {
 	Sample()
 }
 
-func NewExperimentConfiguration(iterations int, concurrency []int, concurrencyStepTime time.Duration, interval int, stop int, worker Worker, workload string) ExperimentConfiguration {
-	return ExperimentConfiguration{iterations, concurrency, concurrencyStepTime, interval, stop, worker, workload}
+func NewExperimentConfiguration(iterations int, concurrency []int, concurrencyStepTime time.Duration, interval int, stop int, worker Worker, workload string, labels []string, setup string, setupScope string, teardown string) ExperimentConfiguration {
+	return ExperimentConfiguration{iterations, concurrency, concurrencyStepTime, interval, stop, worker, workload, labels, setup, setupScope, teardown}
+}
+
+// Validate checks the setup scope and that the worker knows the workload,
+// setup and teardown steps
+func (c ExperimentConfiguration) Validate() error {
+	if c.SetupScope != PerWorker && c.SetupScope != PerExperiment {
+		return fmt.Errorf("Invalid setup:scope '%s', expected '%s' or '%s'", c.SetupScope, PerWorker, PerExperiment)
+	}
+
+	if ok, err := c.Worker.Validate(c.Workload); !ok {
+		return err
+	}
+
+	for _, workload := range []string{c.Setup, c.Teardown} {
+		if workload == "" {
+			continue
+		}
+		if ok, err := c.Worker.Validate(workload); !ok {
+			return err
+		}
+	}
+	return nil
 }
 
 func NewRunnableExperiment(config ExperimentConfiguration) *RunnableExperiment {
-	return &RunnableExperiment{config, config.newExecutableExperiment, newRunningExperiment}
+	return &RunnableExperiment{config, config.newExecutableExperiment, newRunningExperiment, newStopper()}
+}
+
+func newStopper() *stopper {
+	return &stopper{quit: make(chan bool), done: make(chan bool)}
 }
 
 func (c ExperimentConfiguration) newExecutableExperiment(iterationResults chan IterationResult, errors chan error, workers chan int, quit chan bool) Executable {
@@ -102,7 +170,7 @@ func (c ExperimentConfiguration) newExecutableExperiment(iterationResults chan I
 	if len(c.Concurrency) > 1 {
 		totalWorkers = c.Concurrency[1]
 	}
-	schedule := linearSchedule(startingWorkers, totalWorkers, c.ConcurrencyStepTime)
+	schedule := linearSchedule(startingWorkers, totalWorkers, c.ConcurrencyStepTime, quit)
 	return &ExecutableExperiment{c, iterationResults, workers, quit, schedule}
 }
 
@@ -115,7 +183,7 @@ func (config *RunnableExperiment) Run(tracker func(<-chan *Sample), workloadCtx
 	errors := make(chan error)
 	workers := make(chan int)
 	samples := make(chan *Sample)
-	quit := make(chan bool)
+	quit := config.stopper.start()
 	done := make(chan bool)
 	maxIterations := config.Iterations
 	if config.Stop != 0 && config.Interval != 0 && config.Interval < config.Stop {
@@ -129,16 +197,115 @@ func (config *RunnableExperiment) Run(tracker func(<-chan *Sample), workloadCtx
 	}(done)
 
 	config.executerFactory(iteration, errors, workers, quit).Execute(workloadCtx)
+	close(config.stopper.done)
 	<-done
 	return nil
 }
 
+// Quit schedules no more iterations and, if the experiment is running, waits
+// for its workers to finish the ones they are running and tear down
+func (config *RunnableExperiment) Quit() {
+	config.stopper.Lock()
+	if !config.stopper.stopped {
+		close(config.stopper.quit)
+		config.stopper.stopped = true
+	}
+	running := config.stopper.running
+	config.stopper.Unlock()
+
+	if running {
+		<-config.stopper.done
+	}
+}
+
+func (s *stopper) start() chan bool {
+	s.Lock()
+	defer s.Unlock()
+	s.running = true
+	return s.quit
+}
+
 func (ex *ExecutableExperiment) Execute(workloadCtx context.Context) {
+	if len(ex.Labels) > 0 {
+		workloadCtx.PutString("labels", strings.Join(ex.Labels, ","))
+	}
+
+	setup := TimedStage(ex.iteration, ex.Worker, SetupStage, ex.Setup)
+	teardown := func(ctx context.Context) {
+		TimedStage(ex.iteration, ex.Worker, TeardownStage, ex.Teardown)(ctx)
+	}
+
+	if ex.SetupScope == PerExperiment {
+		if setup(workloadCtx) {
+			ex.executeIterations(nil, nil, workloadCtx)
+			teardown(workloadCtx)
+		}
+	} else {
+		ex.executeIterations(setup, teardown, workloadCtx)
+	}
+
+	close(ex.iteration)
+}
+
+func (ex *ExecutableExperiment) executeIterations(setup func(context.Context) bool, teardown func(context.Context), workloadCtx context.Context) {
+	if setup != nil && ex.Interval != 0 && ex.Stop != 0 {
+		stages := newWorkerStages(setup, teardown)
+		defer stages.teardown()
+		setup, teardown = stages.setupWorker, nil
+	}
+
 	Execute(RepeatEveryUntil(ex.Interval, ex.Stop, func(context.Context) {
-		ExecuteConcurrently(ex.schedule.start(), Repeat(ex.Iterations, Counted(ex.workers, TimedWithWorker(ex.iteration, ex.Worker, ex.Workload))), workloadCtx)
+		ExecuteConcurrentlyWithSetup(ex.schedule.start(), RepeatUntil(ex.Iterations, Counted(ex.workers, TimedWithWorker(ex.iteration, ex.Worker, ex.Workload)), ex.quit), setup, teardown, workloadCtx)
 	}, ex.quit), workloadCtx)
+}
 
-	close(ex.iteration)
+// workerStages runs each worker's setup once however often the iterations are
+// repeated: on later repeats the worker with the same index carries on with
+// the context it left behind, and every worker whose setup succeeded is torn
+// down after the last
+type workerStages struct {
+	sync.Mutex
+	setup        func(context.Context) bool
+	teardownFunc func(context.Context)
+	workers      map[int]workerStage
+}
+
+type workerStage struct {
+	ctx context.Context
+	ok  bool
+}
+
+func newWorkerStages(setup func(context.Context) bool, teardown func(context.Context)) *workerStages {
+	return &workerStages{setup: setup, teardownFunc: teardown, workers: make(map[int]workerStage)}
+}
+
+func (s *workerStages) setupWorker(ctx context.Context) bool {
+	index, _ := ctx.GetInt("workerIndex")
+	s.Lock()
+	previous, seen := s.workers[index]
+	s.Unlock()
+
+	ok := previous.ok
+	if seen {
+		carried, _ := json.Marshal(previous.ctx)
+		ctx.UnmarshalJSON(carried)
+	} else {
+		ok = s.setup(ctx)
+	}
+
+	s.Lock()
+	s.workers[index] = workerStage{ctx, ok}
+	s.Unlock()
+	return ok
+}
+
+func (s *workerStages) teardown() {
+	for _, worker := range s.workers {
+		if !worker.ok {
+			continue
+		}
+		s.teardownFunc(worker.ctx)
+	}
 }
 
 func clone(src map[string]Command) map[string]Command {
@@ -149,11 +316,20 @@ func clone(src map[string]Command) map[string]Command {
 	return clone
 }
 
+func cloneMetrics(src map[string]Metric) map[string]Metric {
+	var clone = make(map[string]Metric)
+	for k, v := range src {
+		clone[k] = v
+	}
+	return clone
+}
+
 func (schedule concurrencySchedule) start() chan int {
 	return schedule()
 }
 
-func linearSchedule(startingWorkers int, totalWorkers int, concurrencyStepTime time.Duration) concurrencySchedule {
+// linearSchedule stops adding workers once quit is closed
+func linearSchedule(startingWorkers int, totalWorkers int, concurrencyStepTime time.Duration, quit <-chan bool) concurrencySchedule {
 	return func() chan int {
 		myStartingWorkers := startingWorkers
 		myTotalWorkers := totalWorkers
@@ -162,16 +338,29 @@ func linearSchedule(startingWorkers int, totalWorkers int, concurrencyStepTime t
 		go func() {
 			defer close(ch)
 			for i := 0; i < myStartingWorkers; i++ {
-				ch <- 1
+				select {
+				case ch <- 1:
+				case <-quit:
+					return
+				}
 			}
 			if myConcurrencyStepTime > 0 && myStartingWorkers < myTotalWorkers {
 				tick := time.NewTicker(myConcurrencyStepTime)
-				for _ = range tick.C {
-					ch <- 1
+				defer tick.Stop()
+				for {
+					select {
+					case <-tick.C:
+					case <-quit:
+						return
+					}
+					select {
+					case ch <- 1:
+					case <-quit:
+						return
+					}
 					myStartingWorkers++
 					if myStartingWorkers >= myTotalWorkers {
-						tick.Stop()
-						break
+						return
 					}
 				}
 			}
@@ -182,12 +371,14 @@ func linearSchedule(startingWorkers int, totalWorkers int, concurrencyStepTime t
 
 func (ex *SamplableExperiment) Sample() {
 	commands := make(map[string]Command)
+	metrics := make(map[string]Metric)
 	var iterations int64
 	var totalTime time.Duration
 	var avg time.Duration
 	var lastError string
 	var lastResult time.Duration
 	var totalErrors int
+	var stageErrors int
 	var workers int
 	var worstResult time.Duration
 	var ninetyfifthPercentile time.Duration
@@ -205,7 +396,24 @@ func (ex *SamplableExperiment) Sample() {
 				return
 			}
 			sampleType = ResultSample
+			if iteration.Error != nil {
+				lastError = iteration.Error.Error()
+			}
+
+			// setup and teardown timings and errors are reported on their own,
+			// without counting towards the iterations
+			if iteration.Stage != "" {
+				if iteration.Error != nil {
+					stageErrors = stageErrors + 1
+				}
+				addSteps(commands, metrics, iteration.Stage+":", iteration.Steps)
+				break
+			}
+
 			iterations = iterations + 1
+			if iteration.Error != nil {
+				totalErrors = totalErrors + 1
+			}
 			totalTime = totalTime + iteration.Duration
 			avg = time.Duration(totalTime.Nanoseconds() / iterations)
 			lastResult = iteration.Duration
@@ -222,29 +430,49 @@ func (ex *SamplableExperiment) Sample() {
 			}
 			ninetyfifthPercentile = percentile[percentileLength-int(math.Floor(float64(iterations)*.05+0.95))]
 
-			for _, step := range iteration.Steps {
-				cmd := commands[step.Command]
-				cmd.Count = cmd.Count + 1
-				cmd.TotalTime = cmd.TotalTime + step.Duration
-				cmd.LastTime = step.Duration
-				cmd.Average = time.Duration(cmd.TotalTime.Nanoseconds() / cmd.Count)
-				cmd.Throughput = float64(cmd.Count) / cmd.TotalTime.Seconds()
-				if step.Duration > cmd.WorstTime {
-					cmd.WorstTime = step.Duration
-				}
-
-				commands[step.Command] = cmd
-			}
-
-			if iteration.Error != nil {
-				lastError = iteration.Error.Error()
-				totalErrors = totalErrors + 1
-			}
+			addSteps(commands, metrics, "", iteration.Steps)
 		case w := <-ex.workers:
 			workers = workers + w
 		case _ = <-heartbeat.C:
 			//heartbeat for updating CLI Walltime every second
 		}
-		ex.samples <- &Sample{clone(commands), avg, totalTime, time.Now().Format(time.RFC3339Nano), iterations, totalErrors, workers, lastResult, lastError, worstResult, ninetyfifthPercentile, time.Now().Sub(startTime), sampleType}
+		ex.samples <- &Sample{clone(commands), avg, totalTime, time.Now().Format(time.RFC3339Nano), iterations, totalErrors, stageErrors, workers, lastResult, lastError, worstResult, ninetyfifthPercentile, time.Now().Sub(startTime), sampleType, cloneMetrics(metrics)}
+	}
+}
+
+func addSteps(commands map[string]Command, metrics map[string]Metric, prefix string, steps []StepResult) {
+	for _, step := range steps {
+		cmd := commands[prefix+step.Command]
+		cmd.Count = cmd.Count + 1
+		cmd.TotalTime = cmd.TotalTime + step.Duration
+		cmd.LastTime = step.Duration
+		cmd.Average = time.Duration(cmd.TotalTime.Nanoseconds() / cmd.Count)
+		cmd.Throughput = float64(cmd.Count) / cmd.TotalTime.Seconds()
+		if step.Duration > cmd.WorstTime {
+			cmd.WorstTime = step.Duration
+		}
+
+		commands[prefix+step.Command] = cmd
+
+		for _, measurement := range step.Metrics {
+			addMetric(metrics, prefix+step.Command+"/"+measurement.Name, measurement)
+		}
+	}
+}
+
+func addMetric(metrics map[string]Metric, name string, measurement workloads.Measurement) {
+	value := measurement.Value
+	metric := metrics[name]
+	metric.Kind = measurement.Kind
+	if metric.Count == 0 || value < metric.Min {
+		metric.Min = value
+	}
+	if metric.Count == 0 || value > metric.Max {
+		metric.Max = value
 	}
+	metric.Count = metric.Count + 1
+	metric.Total = metric.Total + value
+	metric.Last = value
+	metric.Average = metric.Total / float64(metric.Count)
+	metrics[name] = metric
 }
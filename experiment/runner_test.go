@@ -2,10 +2,12 @@ package experiment
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	. "github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/workloads"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -39,7 +41,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 				sampler = &DummySampler{maxIterations, samples, iterationResults, workers, errors, sampleFunc}
 				return sampler
 			}
-			config = &RunnableExperiment{ExperimentConfiguration{5, []int{2}, 1 * time.Second, 1, 3, worker, "push"}, executorFactory, samplerFactory}
+			config = &RunnableExperiment{ExperimentConfiguration{5, []int{2}, 1 * time.Second, 1, 3, worker, "push", nil, "", "", ""}, executorFactory, samplerFactory, newStopper()}
 		})
 
 		It("Sends Samples from Sampler to the passed tracker function", func() {
@@ -69,7 +71,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 		})
 
 		It("Calculates the maximum iterations correctly when stop is not divisible by interval", func() {
-			config = &RunnableExperiment{ExperimentConfiguration{5, []int{2}, 1 * time.Second, 2, 5, worker, "push"}, executorFactory, samplerFactory}
+			config = &RunnableExperiment{ExperimentConfiguration{5, []int{2}, 1 * time.Second, 2, 5, worker, "push", nil, "", "", ""}, executorFactory, samplerFactory, newStopper()}
 			executorFunc = func(e *DummyExecutor) {}
 			sampleFunc = func(s *DummySampler) {}
 			config.Run(func(samples <-chan *Sample) {}, workloadCtx)
@@ -149,6 +151,176 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 		PIt("Closes the iterationResults channel when the executorFunc has finished", func() {})
 		PIt("Runs a given number of times", func() {})
 		PIt("Uses the passed worker", func() {})
+
+		Describe("With setup and teardown", func() {
+			var (
+				worker     *LocalWorker
+				iterations chan IterationResult
+				results    []IterationResult
+				logins     int
+				setup      string
+				mutex      sync.Mutex
+			)
+
+			BeforeEach(func() {
+				logins = 0
+				setup = "login"
+				worker = NewLocalWorker()
+				worker.AddWorkloadStep(workloads.StepWithContext("login", func(ctx context.Context) error {
+					mutex.Lock()
+					defer mutex.Unlock()
+					logins++
+					ctx.PutString("token", "TOKEN")
+					return nil
+				}, ""))
+				worker.AddWorkloadStep(workloads.StepWithContext("push", func(ctx context.Context) error {
+					if _, ok := ctx.GetString("token"); !ok {
+						return errors.New("not logged in")
+					}
+					return nil
+				}, ""))
+				worker.AddWorkloadStep(workloads.Step("logout", func() error { return nil }, ""))
+				worker.AddWorkloadStep(workloads.Step("bad-login", func() error { return errors.New("bad credentials") }, ""))
+			})
+
+			executeRepeatedly := func(scope string, interval int, stop int) {
+				iterations = make(chan IterationResult)
+				results = make([]IterationResult, 0)
+				done := make(chan bool)
+				go func() {
+					for r := range iterations {
+						results = append(results, r)
+					}
+					done <- true
+				}()
+
+				config := NewExperimentConfiguration(3, []int{2}, 0, interval, stop, worker, "push", nil, setup, scope, "logout")
+				config.newExecutableExperiment(iterations, make(chan error), make(chan int, 100), make(chan bool)).Execute(context.New())
+				<-done
+			}
+
+			execute := func(scope string) {
+				executeRepeatedly(scope, 0, 0)
+			}
+
+			stages := func() map[string]int {
+				counts := make(map[string]int)
+				for _, r := range results {
+					counts[r.Stage]++
+					Ω(r.Error).Should(BeNil())
+				}
+				return counts
+			}
+
+			It("runs them in each worker, sharing the setup's context with its iterations", func() {
+				execute(PerWorker)
+				Ω(logins).Should(Equal(2))
+				Ω(stages()).Should(Equal(map[string]int{SetupStage: 2, "": 3, TeardownStage: 2}))
+			})
+
+			It("runs them once, sharing the setup's context with every worker", func() {
+				execute(PerExperiment)
+				Ω(logins).Should(Equal(1))
+				Ω(stages()).Should(Equal(map[string]int{SetupStage: 1, "": 3, TeardownStage: 1}))
+			})
+
+			It("runs them once in each worker when the iterations are repeated, keeping its context", func() {
+				executeRepeatedly(PerWorker, 1, 1)
+				Ω(logins).Should(Equal(2))
+				Ω(stages()).Should(Equal(map[string]int{SetupStage: 2, "": 6, TeardownStage: 2}))
+			})
+
+			Context("When the setup fails", func() {
+				BeforeEach(func() {
+					setup = "bad-login"
+				})
+
+				stagesRun := func() map[string]int {
+					counts := make(map[string]int)
+					for _, r := range results {
+						counts[r.Stage]++
+					}
+					return counts
+				}
+
+				It("runs neither the iterations nor the teardown of the worker", func() {
+					execute(PerWorker)
+					Ω(stagesRun()).Should(Equal(map[string]int{SetupStage: 2}))
+				})
+
+				It("runs neither the iterations nor the teardown of the experiment", func() {
+					execute(PerExperiment)
+					Ω(stagesRun()).Should(Equal(map[string]int{SetupStage: 1}))
+				})
+
+				It("does not tear the worker down after the last repeat", func() {
+					executeRepeatedly(PerWorker, 1, 1)
+					Ω(stagesRun()).Should(Equal(map[string]int{SetupStage: 2}))
+				})
+			})
+		})
+	})
+
+	Describe("Validating", func() {
+		It("checks the setup scope and the workload, setup and teardown steps", func() {
+			worker := NewLocalWorker()
+			worker.AddWorkloadStep(workloads.Step("login", func() error { return nil }, ""))
+			worker.AddWorkloadStep(workloads.Step("push", func() error { return nil }, ""))
+
+			Ω(NewExperimentConfiguration(1, []int{1}, 0, 0, 0, worker, "push", nil, "login", PerExperiment, "login").Validate()).Should(BeNil())
+			Ω(NewExperimentConfiguration(1, []int{1}, 0, 0, 0, worker, "push", nil, "login", "everywhere", "").Validate()).ShouldNot(BeNil())
+			Ω(NewExperimentConfiguration(1, []int{1}, 0, 0, 0, worker, "push", nil, "logon", PerWorker, "").Validate()).ShouldNot(BeNil())
+			Ω(NewExperimentConfiguration(1, []int{1}, 0, 0, 0, worker, "push", nil, "", PerWorker, "login,logout").Validate()).ShouldNot(BeNil())
+			Ω(NewExperimentConfiguration(1, []int{1}, 0, 0, 0, worker, "push,pull", nil, "", PerWorker, "").Validate()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("Quitting", func() {
+		It("schedules no more iterations and waits for the running ones and the teardown", func() {
+			var mutex sync.Mutex
+			pushes, running, logouts := 0, 0, 0
+			worker := NewLocalWorker()
+			worker.AddWorkloadStep(workloads.Step("push", func() error {
+				mutex.Lock()
+				pushes++
+				running++
+				mutex.Unlock()
+				time.Sleep(50 * time.Millisecond)
+				mutex.Lock()
+				running--
+				mutex.Unlock()
+				return nil
+			}, ""))
+			worker.AddWorkloadStep(workloads.Step("logout", func() error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				logouts++
+				return nil
+			}, ""))
+
+			experiment := NewRunnableExperiment(NewExperimentConfiguration(100, []int{2}, 0, 0, 0, worker, "push", nil, "", PerWorker, "logout"))
+			go experiment.Run(func(samples <-chan *Sample) {
+				for _ = range samples {
+				}
+			}, context.New())
+
+			Eventually(func() int {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return pushes
+			}).Should(BeNumerically(">", 0))
+			experiment.Quit()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Ω(running).Should(Equal(0))
+			Ω(logouts).Should(Equal(2))
+			Ω(pushes).Should(BeNumerically("<", 100))
+		})
+
+		It("returns at once when the experiment is not running", func() {
+			NewRunnableExperiment(NewExperimentConfiguration(1, []int{1}, 0, 0, 0, NewLocalWorker(), "push", nil, "", PerWorker, "")).Quit()
+		})
 	})
 
 	Describe("SamplableExperiment.samples", func() {
@@ -171,9 +343,9 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 
 		It("saves command in a immutable map", func() {
 			go func() {
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, ""}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, ""}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, ""}
 			}()
 
 			Ω((<-samples).Commands["push"].Count).Should(Equal(int64(1)))
@@ -201,9 +373,9 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 		})
 
 		It("Calculates the running average", func() {
-			go func() { iteration <- IterationResult{2 * time.Second, nil, nil} }()
-			go func() { iteration <- IterationResult{4 * time.Second, nil, nil} }()
-			go func() { iteration <- IterationResult{6 * time.Second, nil, nil} }()
+			go func() { iteration <- IterationResult{2 * time.Second, nil, nil, ""} }()
+			go func() { iteration <- IterationResult{4 * time.Second, nil, nil, ""} }()
+			go func() { iteration <- IterationResult{6 * time.Second, nil, nil, ""} }()
 
 			Ω((<-samples).Average).Should(Equal(2 * time.Second))
 			Ω((<-samples).Average).Should(Equal(3 * time.Second))
@@ -212,7 +384,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 
 		It("Closes the samples channel when there are no more iterationResults", func() {
 			go func() {
-				iteration <- IterationResult{2 * time.Second, nil, nil}
+				iteration <- IterationResult{2 * time.Second, nil, nil, ""}
 				close(iteration)
 			}()
 
@@ -223,18 +395,36 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 
 		It("Counts errors", func() {
 			go func() {
-				iteration <- IterationResult{0, nil, &EncodableError{"fishfingers burnt"}}
-				iteration <- IterationResult{0, nil, &EncodableError{"toast not buttered"}}
+				iteration <- IterationResult{0, nil, &EncodableError{"fishfingers burnt"}, ""}
+				iteration <- IterationResult{0, nil, &EncodableError{"toast not buttered"}, ""}
 			}()
 
 			Ω((<-samples).TotalErrors).Should(Equal(1))
 			Ω((<-samples).TotalErrors).Should(Equal(2))
 		})
 
+		It("Reports setup and teardown steps as commands of their own, and their errors apart, without counting them as iterations", func() {
+			go func() {
+				iteration <- IterationResult{2 * time.Second, []StepResult{StepResult{Command: "login", Duration: 2 * time.Second}}, nil, SetupStage}
+				iteration <- IterationResult{0, nil, &EncodableError{"logout failed"}, TeardownStage}
+			}()
+
+			sample := <-samples
+			Ω(sample.Total).Should(Equal(int64(0)))
+			Ω(sample.Average).Should(Equal(0 * time.Second))
+			Ω(sample.Commands["setup:login"].Count).Should(Equal(int64(1)))
+			Ω(sample.Commands).ShouldNot(HaveKey("login"))
+
+			sample = <-samples
+			Ω(sample.TotalErrors).Should(Equal(0))
+			Ω(sample.StageErrors).Should(Equal(1))
+			Ω(sample.LastError).Should(Equal("logout failed"))
+		})
+
 		It("Calculates the throughput for a command", func() {
 			go func() {
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "list", Duration: 2 * time.Second}}, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, ""}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "list", Duration: 2 * time.Second}}, nil, ""}
 			}()
 
 			Ω((<-samples).Commands["push"].Throughput).Should(BeNumerically("==", 1))
@@ -244,7 +434,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 				iteration <- IterationResult{0, []StepResult{
 					StepResult{Command: "push", Duration: 3 * time.Second},
 					StepResult{Command: "push", Duration: 2 * time.Second}},
-					nil}
+					nil, ""}
 			}()
 
 			sample := <-samples
@@ -252,6 +442,33 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			Ω(sample.Commands["push"].TotalTime).Should(Equal(6 * time.Second))
 			Ω(sample.Commands["push"].Throughput).Should(BeNumerically("==", 0.5))
 		})
+
+		It("Aggregates the metrics steps report by step and name", func() {
+			go func() {
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "probe", Metrics: []workloads.Measurement{{"loss-rate", workloads.GaugeMetric, 0.5}}}}, nil, ""}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "probe", Metrics: []workloads.Measurement{{"loss-rate", workloads.GaugeMetric, 0.1}}}}, nil, SetupStage}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "probe", Metrics: []workloads.Measurement{{"loss-rate", workloads.GaugeMetric, 0.0}}}}, nil, ""}
+			}()
+
+			<-samples
+			<-samples
+			sample := <-samples
+			Ω(sample.Metrics["probe/loss-rate"]).Should(Equal(Metric{Kind: workloads.GaugeMetric, Count: 2, Average: 0.25, Total: 0.5, Last: 0, Min: 0, Max: 0.5}))
+			Ω(sample.Metrics["setup:probe/loss-rate"].Count).Should(Equal(int64(1)))
+		})
+
+		It("Totals counters", func() {
+			go func() {
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "rest:push", Metrics: []workloads.Measurement{{"bytes-uploaded", workloads.CounterMetric, 100}}}}, nil, ""}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "rest:push", Metrics: []workloads.Measurement{{"bytes-uploaded", workloads.CounterMetric, 300}}}}, nil, ""}
+			}()
+
+			<-samples
+			sample := <-samples
+			Ω(sample.Metrics["rest:push/bytes-uploaded"].Kind).Should(Equal(workloads.CounterMetric))
+			Ω(sample.Metrics["rest:push/bytes-uploaded"].Total).Should(Equal(400.0))
+			Ω(sample.Metrics["rest:push/bytes-uploaded"].Average).Should(Equal(200.0))
+		})
 	})
 
 	Describe("Sampling Percentile", func() {
@@ -280,7 +497,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 
 			go func() {
 				for i := 0; i < maxIterations; i++ {
-					iteration <- IterationResult{time.Duration(samplesToSend[i]) * time.Second, nil, nil}
+					iteration <- IterationResult{time.Duration(samplesToSend[i]) * time.Second, nil, nil, ""}
 				}
 			}()
 			for q := 0; q < maxIterations; q++ {
@@ -292,7 +509,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 	Describe("Scheduling", func() {
 		Context("#linearSchedule", func() {
 			It("Creates a prepopulated channel containing the starting amount of events", func() {
-				schedule := linearSchedule(3, 0, 0*time.Second).start()
+				schedule := linearSchedule(3, 0, 0*time.Second, nil).start()
 				for i := 0; i < 3; i++ {
 					Ω(<-schedule).ShouldNot(BeNil())
 				}
@@ -300,7 +517,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			})
 
 			It("Pushes events at the provided interval", func() {
-				schedule := linearSchedule(0, 3, 3*time.Second).start()
+				schedule := linearSchedule(0, 3, 3*time.Second, nil).start()
 				for i := 0; i < 3; i++ {
 					delay, _ := Time(func() error {
 						<-schedule
@@ -312,16 +529,24 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			})
 
 			It("Only pushes the starting workers when supplied with a concurrencyStepTime of 0", func() {
-				schedule := linearSchedule(3, 6, 0*time.Second).start()
+				schedule := linearSchedule(3, 6, 0*time.Second, nil).start()
 				for i := 0; i < 3; i++ {
 					Ω(<-schedule).ShouldNot(BeNil())
 				}
 				Ω(schedule).Should(BeClosed())
 			})
 
+			It("Stops pushing events once quit is closed", func() {
+				quit := make(chan bool)
+				schedule := linearSchedule(1, 3, 100*time.Millisecond, quit).start()
+				Ω(<-schedule).ShouldNot(BeNil())
+				close(quit)
+				Eventually(schedule).Should(BeClosed())
+			})
+
 			Context("Repeated scheduling", func() {
 				It("creates a new schedule each time start() is called", func() {
-					scheduler := linearSchedule(1, 3, 3*time.Second)
+					scheduler := linearSchedule(1, 3, 3*time.Second, nil)
 					schedule := scheduler.start()
 					Ω(<-schedule).ShouldNot(BeNil())
 					for i := 0; i < 2; i++ {
@@ -0,0 +1,396 @@
+package fakecf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/workloads"
+	"github.com/gorilla/mux"
+	"github.com/nu7hatch/gouuid"
+)
+
+// Config shapes the fake's behaviour: every request is answered after a
+// Latency sample, ErrorRate of them fail with a 500, and started apps stage
+// for a StagingTime sample, failing to stage at StagingFailureRate
+type Config struct {
+	Latency            workloads.Delay
+	StagingTime        workloads.Delay
+	ErrorRate          float64
+	StagingFailureRate float64
+}
+
+// Domain is the fake's one shared domain; routes in it are recorded, but
+// nothing is served on them
+const Domain = "fake-cf.example.com"
+
+const domainGuid = "fake-domain"
+
+type fakeRoute struct {
+	Guid       string
+	Host       string `json:"host"`
+	DomainGuid string `json:"domain_guid"`
+	SpaceGuid  string `json:"space_guid"`
+	Apps       map[string]bool
+}
+
+type fakeApp struct {
+	Guid          string
+	Name          string `json:"name"`
+	SpaceGuid     string `json:"space_guid"`
+	State         string `json:"state"`
+	Memory        int    `json:"memory"`
+	Instances     int    `json:"instances"`
+	StagedAt      time.Time
+	StagingFailed bool
+}
+
+// FakeCF is a Cloud Controller and UAA in one, serving the /v2/info,
+// /oauth/token, /v2/spaces, /v2/shared_domains, /v2/routes, /v2/apps, bits
+// upload, resource matching and instances endpoints the rest workloads use,
+// with apps and routes kept in memory
+type FakeCF struct {
+	config   Config
+	router   *mux.Router
+	listener net.Listener
+	url      string
+
+	mutex  sync.Mutex
+	random *rand.Rand
+	apps   map[string]*fakeApp
+	routes map[string]*fakeRoute
+	tokens int
+}
+
+func New(config Config) *FakeCF {
+	fake := &FakeCF{
+		config: config,
+		router: mux.NewRouter(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		apps:   make(map[string]*fakeApp),
+		routes: make(map[string]*fakeRoute),
+	}
+
+	fake.router.Methods("GET").Path("/v2/info").HandlerFunc(fake.info)
+	fake.router.Methods("POST").Path("/oauth/token").HandlerFunc(fake.token)
+	fake.router.Methods("GET").Path("/v2/spaces").HandlerFunc(fake.authorized(fake.spaces))
+	fake.router.Methods("GET").Path("/v2/shared_domains").HandlerFunc(fake.authorized(fake.sharedDomains))
+	fake.router.Methods("POST").Path("/v2/routes").HandlerFunc(fake.authorized(fake.createRoute))
+	fake.router.Methods("PUT").Path("/v2/routes/{route}/apps/{guid}").HandlerFunc(fake.authorized(fake.withApp(fake.mapRoute)))
+	fake.router.Methods("DELETE").Path("/v2/routes/{route}").HandlerFunc(fake.authorized(fake.deleteRoute))
+	fake.router.Methods("PUT").Path("/v2/resource_match").HandlerFunc(fake.authorized(fake.resourceMatch))
+	fake.router.Methods("GET").Path("/v2/apps").HandlerFunc(fake.authorized(fake.listApps))
+	fake.router.Methods("POST").Path("/v2/apps").HandlerFunc(fake.authorized(fake.createApp))
+	fake.router.Methods("GET").Path("/v2/apps/{guid}").HandlerFunc(fake.authorized(fake.withApp(fake.getApp)))
+	fake.router.Methods("PUT").Path("/v2/apps/{guid}").HandlerFunc(fake.authorized(fake.withApp(fake.updateApp)))
+	fake.router.Methods("DELETE").Path("/v2/apps/{guid}").HandlerFunc(fake.authorized(fake.withApp(fake.deleteApp)))
+	fake.router.Methods("PUT").Path("/v2/apps/{guid}/bits").HandlerFunc(fake.authorized(fake.withApp(fake.uploadBits)))
+	fake.router.Methods("GET").Path("/v2/apps/{guid}/routes").HandlerFunc(fake.authorized(fake.withApp(fake.appRoutes)))
+	fake.router.Methods("GET").Path("/v2/apps/{guid}/instances").HandlerFunc(fake.authorized(fake.withApp(fake.instances)))
+	return fake
+}
+
+// Start serves the fake on address, e.g. "127.0.0.1:0" for any free port
+func (fake *FakeCF) Start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	fake.listener = listener
+	fake.url = "http://" + listener.Addr().String()
+	go http.Serve(listener, fake)
+	return nil
+}
+
+func (fake *FakeCF) Stop() {
+	if fake.listener != nil {
+		fake.listener.Close()
+	}
+}
+
+// URL is the target to give rest:target once the fake has started
+func (fake *FakeCF) URL() string {
+	return fake.url
+}
+
+// Apps is the number of apps pushed and not yet deleted
+func (fake *FakeCF) Apps() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return len(fake.apps)
+}
+
+// Routes is the number of routes created and not yet deleted
+func (fake *FakeCF) Routes() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return len(fake.routes)
+}
+
+func (fake *FakeCF) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	latency := fake.config.Latency.Sample(fake.random)
+	failed := fake.random.Float64() < fake.config.ErrorRate
+	fake.mutex.Unlock()
+
+	time.Sleep(latency)
+	if failed {
+		cfError(w, http.StatusInternalServerError, 10001, "CF-ServerError", "Injected by the fake Cloud Foundry")
+		return
+	}
+
+	fake.router.ServeHTTP(w, r)
+}
+
+func (fake *FakeCF) info(w http.ResponseWriter, r *http.Request) {
+	reply(w, http.StatusOK, map[string]interface{}{
+		"name":                   "fake-cf",
+		"api_version":            "2.25.0",
+		"authorization_endpoint": fake.url,
+		"token_endpoint":         fake.url,
+	})
+}
+
+func (fake *FakeCF) token(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	fake.tokens = fake.tokens + 1
+	token := fmt.Sprintf("fake-token-%d", fake.tokens)
+	fake.mutex.Unlock()
+
+	reply(w, http.StatusOK, map[string]interface{}{
+		"access_token":  token,
+		"refresh_token": "refresh-" + token,
+		"token_type":    "bearer",
+		"expires_in":    3600,
+	})
+}
+
+func (fake *FakeCF) spaces(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Query().Get("q"), "name:")
+	reply(w, http.StatusOK, resources(resource("fake-space-"+name, map[string]interface{}{"name": name})))
+}
+
+func (fake *FakeCF) sharedDomains(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Query().Get("q"), "name:")
+	if name != "" && name != Domain {
+		reply(w, http.StatusOK, resources())
+		return
+	}
+	reply(w, http.StatusOK, resources(resource(domainGuid, map[string]interface{}{"name": Domain})))
+}
+
+func (fake *FakeCF) createRoute(w http.ResponseWriter, r *http.Request) {
+	route := &fakeRoute{Apps: make(map[string]bool)}
+	if err := json.NewDecoder(r.Body).Decode(route); err != nil || route.DomainGuid != domainGuid {
+		cfError(w, http.StatusBadRequest, 1001, "CF-MessageParseError", "Request invalid due to parse error")
+		return
+	}
+
+	guid, _ := uuid.NewV4()
+	route.Guid = guid.String()
+
+	fake.mutex.Lock()
+	fake.routes[route.Guid] = route
+	fake.mutex.Unlock()
+
+	reply(w, http.StatusCreated, route.resource())
+}
+
+func (fake *FakeCF) mapRoute(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	route, ok := fake.routes[mux.Vars(r)["route"]]
+	if !ok {
+		cfError(w, http.StatusNotFound, 210002, "CF-RouteNotFound", "The route could not be found: "+mux.Vars(r)["route"])
+		return
+	}
+
+	route.Apps[app.Guid] = true
+	reply(w, http.StatusCreated, route.resource())
+}
+
+func (fake *FakeCF) deleteRoute(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if _, ok := fake.routes[mux.Vars(r)["route"]]; !ok {
+		cfError(w, http.StatusNotFound, 210002, "CF-RouteNotFound", "The route could not be found: "+mux.Vars(r)["route"])
+		return
+	}
+	delete(fake.routes, mux.Vars(r)["route"])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fake *FakeCF) appRoutes(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	found := make([]map[string]interface{}, 0)
+	for _, route := range fake.routes {
+		if route.Apps[app.Guid] {
+			found = append(found, route.resource())
+		}
+	}
+	reply(w, http.StatusOK, resources(found...))
+}
+
+func (fake *FakeCF) resourceMatch(w http.ResponseWriter, r *http.Request) {
+	reply(w, http.StatusOK, []interface{}{})
+}
+
+func (fake *FakeCF) listApps(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Query().Get("q"), "name:")
+
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	found := make([]map[string]interface{}, 0)
+	for _, app := range fake.apps {
+		if name == "" || app.Name == name {
+			found = append(found, app.resource())
+		}
+	}
+	reply(w, http.StatusOK, resources(found...))
+}
+
+func (fake *FakeCF) createApp(w http.ResponseWriter, r *http.Request) {
+	app := &fakeApp{State: "STOPPED", Memory: 1024, Instances: 1}
+	if err := json.NewDecoder(r.Body).Decode(app); err != nil || app.Name == "" {
+		cfError(w, http.StatusBadRequest, 1001, "CF-MessageParseError", "Request invalid due to parse error")
+		return
+	}
+
+	guid, _ := uuid.NewV4()
+	app.Guid = guid.String()
+
+	fake.mutex.Lock()
+	fake.apps[app.Guid] = app
+	fake.mutex.Unlock()
+
+	w.Header().Set("Location", "/v2/apps/"+app.Guid)
+	reply(w, http.StatusCreated, app.resource())
+}
+
+func (fake *FakeCF) getApp(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	reply(w, http.StatusOK, app.resource())
+}
+
+func (fake *FakeCF) updateApp(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	update := make(map[string]interface{})
+	json.NewDecoder(r.Body).Decode(&update)
+
+	if instances, ok := update["instances"].(float64); ok {
+		app.Instances = int(instances)
+	}
+	if memory, ok := update["memory"].(float64); ok {
+		app.Memory = int(memory)
+	}
+	if state, ok := update["state"].(string); ok && state != app.State {
+		app.State = state
+		if state == "STARTED" {
+			app.StagedAt = time.Now().Add(fake.config.StagingTime.Sample(fake.random))
+			app.StagingFailed = fake.random.Float64() < fake.config.StagingFailureRate
+		}
+	}
+	reply(w, http.StatusCreated, app.resource())
+}
+
+func (fake *FakeCF) deleteApp(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	delete(fake.apps, app.Guid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fake *FakeCF) uploadBits(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	io.Copy(ioutil.Discard, r.Body)
+	reply(w, http.StatusCreated, map[string]interface{}{})
+}
+
+func (fake *FakeCF) instances(w http.ResponseWriter, r *http.Request, app *fakeApp) {
+	switch {
+	case app.State != "STARTED":
+		cfError(w, http.StatusBadRequest, 220001, "CF-InstancesError", "Instances error: App is stopped")
+	case time.Now().Before(app.StagedAt):
+		cfError(w, http.StatusBadRequest, 170002, "CF-NotStaged", "App has not finished staging")
+	case app.StagingFailed:
+		cfError(w, http.StatusBadRequest, 170001, "CF-StagingError", "Staging error: injected by the fake Cloud Foundry")
+	default:
+		running := make(map[string]interface{})
+		for i := 0; i < app.Instances; i++ {
+			running[fmt.Sprintf("%d", i)] = map[string]interface{}{"state": "RUNNING"}
+		}
+		reply(w, http.StatusOK, running)
+	}
+}
+
+func (fake *FakeCF) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(strings.ToLower(r.Header.Get("Authorization")), "bearer fake-token-") {
+			cfError(w, http.StatusUnauthorized, 1000, "CF-InvalidAuthToken", "Invalid Auth Token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// withApp looks up the app named in the path, holding the lock while the
+// handler changes it
+func (fake *FakeCF) withApp(handler func(w http.ResponseWriter, r *http.Request, app *fakeApp)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+
+		app, ok := fake.apps[mux.Vars(r)["guid"]]
+		if !ok {
+			cfError(w, http.StatusNotFound, 100004, "CF-AppNotFound", "The app could not be found: "+mux.Vars(r)["guid"])
+			return
+		}
+		handler(w, r, app)
+	}
+}
+
+func (route *fakeRoute) resource() map[string]interface{} {
+	return resource(route.Guid, map[string]interface{}{
+		"host":        route.Host,
+		"path":        "",
+		"domain_guid": route.DomainGuid,
+		"space_guid":  route.SpaceGuid,
+		"domain":      resource(domainGuid, map[string]interface{}{"name": Domain}),
+	})
+}
+
+func (app *fakeApp) resource() map[string]interface{} {
+	return resource(app.Guid, map[string]interface{}{
+		"name":       app.Name,
+		"space_guid": app.SpaceGuid,
+		"state":      app.State,
+		"memory":     app.Memory,
+		"instances":  app.Instances,
+	})
+}
+
+func resource(guid string, entity map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"guid": guid},
+		"entity":   entity,
+	}
+}
+
+func resources(found ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"total_results": len(found),
+		"total_pages":   1,
+		"resources":     found,
+	}
+}
+
+func cfError(w http.ResponseWriter, status int, code int, errorCode string, description string) {
+	reply(w, status, map[string]interface{}{"code": code, "error_code": errorCode, "description": description})
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
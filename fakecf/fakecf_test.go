@@ -0,0 +1,93 @@
+package fakecf_test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/fakecf"
+	"github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fake CF", func() {
+	var (
+		fake   *FakeCF
+		config Config
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		config = Config{}
+		ctx = context.New()
+		ctx.PutInt("iterationIndex", 0)
+	})
+
+	JustBeforeEach(func() {
+		fake = New(config)
+		Ω(fake.Start("127.0.0.1:0")).Should(BeNil())
+		workloads.PopulateRestContext(fake.URL(), "user", "pass", "dev", ctx)
+	})
+
+	AfterEach(func() {
+		fake.Stop()
+	})
+
+	It("serves the rest workloads from target to delete", func() {
+		rest := workloads.NewRestWorkload()
+		Ω(rest.Target(ctx)).Should(BeNil())
+		Ω(rest.Login(ctx)).Should(BeNil())
+		Ω(rest.Push(ctx)).Should(BeNil())
+		Ω(fake.Apps()).Should(Equal(1))
+		Ω(fake.Routes()).Should(Equal(1))
+
+		Ω(rest.RestartApp(ctx)).Should(BeNil())
+		Ω(rest.DeleteApp(ctx)).Should(BeNil())
+		Ω(fake.Apps()).Should(Equal(0))
+		Ω(fake.Routes()).Should(Equal(0))
+	})
+
+	It("rejects requests without a token", func() {
+		resp, err := http.Get(fake.URL() + "/v2/apps")
+		Ω(err).Should(BeNil())
+		Ω(resp.StatusCode).Should(Equal(http.StatusUnauthorized))
+	})
+
+	Context("with latency", func() {
+		BeforeEach(func() {
+			config.Latency = workloads.Delay{Mean: 100 * time.Millisecond}
+		})
+
+		It("delays each request", func() {
+			start := time.Now()
+			Ω(workloads.NewRestWorkload().Target(ctx)).Should(BeNil())
+			Ω(time.Now().Sub(start).Seconds()).Should(BeNumerically("~", 0.1, 0.05))
+		})
+	})
+
+	Context("with errors injected into every request", func() {
+		BeforeEach(func() {
+			config.ErrorRate = 1
+		})
+
+		It("fails them", func() {
+			Ω(workloads.NewRestWorkload().Target(ctx)).ShouldNot(BeNil())
+		})
+	})
+
+	Context("with staging failures injected", func() {
+		BeforeEach(func() {
+			config.StagingFailureRate = 1
+		})
+
+		It("fails pushes", func() {
+			rest := workloads.NewRestWorkload()
+			rest.Target(ctx)
+			rest.Login(ctx)
+			err := rest.Push(ctx)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("Stage"))
+		})
+	})
+})
@@ -43,6 +43,7 @@ func (self *lab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
 
 func (self *lab) RunWithHandlers(ex Runnable, additionalHandlers []func(<-chan *experiment.Sample), workloadCtx context.Context) (string, error) {
 	guid, _ := uuid.NewV4()
+	workloadCtx.PutString("experimentGuid", guid.String())
 	handlers := make([]func(<-chan *experiment.Sample), 1)
 	handlers[0] = self.store.Writer(guid.String())
 	for _, h := range additionalHandlers {
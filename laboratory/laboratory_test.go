@@ -48,6 +48,11 @@ var _ = Describe("Laboratory", func() {
 			Ω(run1).ShouldNot(Equal(run2))
 		})
 
+		It("puts the experiment GUID in the workload context", func() {
+			guid, _ := workloadCtx.GetString("experimentGuid")
+			Ω(guid).Should(Equal(run2))
+		})
+
 		It("saves running experiments to the store", func() {
 			Ω(store.stored[run1]).Should(HaveLen(3))
 			Ω(store.stored[run2]).Should(HaveLen(3))
@@ -1,37 +1,9 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/cloudfoundry-incubator/pat/cmdline"
-	"github.com/cloudfoundry-incubator/pat/config"
-	"github.com/cloudfoundry-incubator/pat/logs"
-	"github.com/cloudfoundry-incubator/pat/server"
 )
 
 func main() {
-	useServer := false
-	flags := config.ConfigAndFlags
-	flags.BoolVar(&useServer, "server", false, "true to run the HTTP server interface")
-
-	logs.InitCommandLineFlags(flags)
-	cmdline.InitCommandLineFlags(flags)
-	server.InitCommandLineFlags(flags)
-	err := flags.Parse(os.Args[1:])
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(10)
-	}
-
-	if useServer == true {
-		logs.NewLogger("main").Info("Starting in server mode")
-		server.Serve()
-	} else {
-		err = cmdline.RunCommandLine()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(20)
-		}
-	}
+	cmdline.Main()
 }
@@ -10,6 +10,7 @@ var params = struct {
 	redisHost     string
 	redisPort     int
 	redisPassword string
+	namespace     string
 	vcapServices  string
 }{}
 
@@ -17,6 +18,7 @@ func DescribeParameters(config config.Config) {
 	config.StringVar(&params.redisHost, "redis-host", "localhost", "Redis hostname")
 	config.IntVar(&params.redisPort, "redis-port", 6379, "Redis port")
 	config.StringVar(&params.redisPassword, "redis-password", "", "Redis password")
+	config.StringVar(&params.namespace, "redis-namespace", "", "Prefix for all redis keys, allows separate groups of PAT instances to share a redis server")
 	config.EnvVar(&params.vcapServices, "VCAP_SERVICES", "", "The VCAP_SERVICES environment variable")
 }
 
@@ -30,6 +32,10 @@ func WithRedisConnection(fn func(conn Conn) error) error {
 	return err
 }
 
+func ConfiguredNamespace() Namespace {
+	return Namespace(params.namespace)
+}
+
 func parseVcapServices() {
 	if params.vcapServices != "" {
 		b := []byte(params.vcapServices)
@@ -56,6 +56,23 @@ var _ = Describe("Config", func() {
 		Ω(redisPassword).Should(Equal("p444w"))
 	})
 
+	Context("When -redis-namespace is not set", func() {
+		It("uses the empty namespace, leaving keys unprefixed", func() {
+			Ω(ConfiguredNamespace().Key("tasks")).Should(Equal("tasks"))
+		})
+	})
+
+	Context("When -redis-namespace is set", func() {
+		BeforeEach(func() {
+			args = append(args, "-redis-namespace", "team-a")
+		})
+
+		It("prefixes keys with the namespace", func() {
+			Ω(ConfiguredNamespace()).Should(Equal(Namespace("team-a")))
+			Ω(ConfiguredNamespace().Key("tasks")).Should(Equal("team-a:tasks"))
+		})
+	})
+
 	Context("But if the factory returns an error", func() {
 		BeforeEach(func() {
 			ConnFactory = func(host string, port int, password string) (Conn, error) {
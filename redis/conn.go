@@ -9,6 +9,8 @@ import (
 
 const MAX_IDLE = 20
 
+var ErrNil = redis.ErrNil
+
 type Conn interface {
 	Do(cmd string, args ...interface{}) (interface{}, error)
 }
@@ -0,0 +1,11 @@
+package redis
+
+type Namespace string
+
+func (ns Namespace) Key(key string) string {
+	if ns == "" {
+		return key
+	}
+
+	return string(ns) + ":" + key
+}
@@ -38,6 +38,10 @@ var params = struct {
 	port string
 }{}
 
+// LedgerDir is where experiments run by the server record the resources they
+// create, set from -ledger-dir
+var LedgerDir = workloads.DefaultLedgerDir
+
 func InitCommandLineFlags(config config.Config) {
 	config.EnvVar(&params.port, "VCAP_APP_PORT", "8080", "The port to bind to")
 	store.DescribeParameters(config)
@@ -87,6 +91,11 @@ func bind() {
 	}
 }
 
+// badRequest is an error in what the client sent, answered with a 400
+type badRequest struct {
+	error
+}
+
 type listResponse struct {
 	Items interface{}
 }
@@ -139,17 +148,57 @@ func (ctx *serverContext) handlePush(w http.ResponseWriter, r *http.Request) (in
 		workload = "cf:push"
 	}
 
+	setupScope := r.FormValue("setupScope")
+	if setupScope == "" {
+		setupScope = PerWorker
+	}
+
+	setup, teardown := r.FormValue("setup"), r.FormValue("teardown")
+	if text := r.FormValue("scenario"); text != "" {
+		scenario, err := workloads.ParseScenario([]byte(text))
+		if err != nil {
+			return nil, badRequest{err}
+		}
+		workload, setup, teardown = scenario.Workload, scenario.Setup, scenario.Teardown
+		if scenario.SetupScope != "" {
+			setupScope = scenario.SetupScope
+		}
+	}
+
 	workloadContext := context.New()
 	workloads.PopulateRestContext(r.FormValue("cfTarget"), r.FormValue("cfUsername"), r.FormValue("cfPassword"), r.FormValue("cfSpace"), workloadContext)
+	workloads.PopulateLedgerContext(LedgerDir, workloadContext)
 
-	experiment, _ := ctx.lab.Run(
-		NewRunnableExperiment(
-			NewExperimentConfiguration(
-				pushes, concurrency, concurrencyStepTime, interval, stop, ctx.worker, workload)), workloadContext)
+	config := NewExperimentConfiguration(
+		pushes, concurrency, concurrencyStepTime, interval, stop, ctx.worker, workload, benchmarker.ParseLabels(r.FormValue("labels")), setup, setupScope, teardown)
+	if err := config.Validate(); err != nil {
+		return nil, badRequest{err}
+	}
+
+	experiment, _ := ctx.lab.RunWithHandlers(
+		NewRunnableExperiment(config), []func(<-chan *Sample){cleanupWhenDone(workloadContext)}, workloadContext)
 
 	return ctx.router.Get("experiment").URL("name", experiment)
 }
 
+// cleanupWhenDone deletes what is left in the experiment's ledger once its
+// samples end, i.e. when its workers have finished
+func cleanupWhenDone(workloadContext context.Context) func(<-chan *Sample) {
+	return func(samples <-chan *Sample) {
+		for _ = range samples {
+		}
+
+		experimentGuid, _ := workloadContext.GetString("experimentGuid")
+		if err := CleanupExperiment(workloadContext, experimentGuid); err != nil {
+			logs.NewLogger("server").Errorf("Some resources of experiment %s could not be deleted (retry with 'pat cleanup %s'): %v", experimentGuid, experimentGuid, err)
+		}
+	}
+}
+
+var CleanupExperiment = func(workloadContext context.Context, experimentGuid string) error {
+	return workloads.NewRestWorkload().Cleanup(workloadContext, experimentGuid)
+}
+
 func (ctx *serverContext) handleGetExperiment(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	name := mux.Vars(r)["name"]
 	data, err := ctx.lab.GetData(name)
@@ -165,10 +214,10 @@ func (ctx *serverContext) handleGetExperiment(w http.ResponseWriter, r *http.Req
 func csvHandler(fn func(http.ResponseWriter, *http.Request) (interface{}, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if response, err := fn(w, r); err == nil {
-			fmt.Fprintf(w, "Average,TotalTime,Total,TotalErrors,TotalWorkers,LastResult,LastError,WorstResult,WallTime,Type\n")
+			fmt.Fprintf(w, "Average,TotalTime,Total,TotalErrors,StageErrors,TotalWorkers,LastResult,LastError,WorstResult,WallTime,Type\n")
 			for _, line := range response.(*listResponse).Items.([]*Sample) {
-				fmt.Fprintf(w, "%v,%v,%v,%v,%v,%v,%v,%v,%v,%v\n",
-					line.Average, line.TotalTime, line.Total, line.TotalErrors, line.TotalWorkers, line.LastResult, line.LastError, line.WorstResult, line.WallTime, line.Type)
+				fmt.Fprintf(w, "%v,%v,%v,%v,%v,%v,%v,%v,%v,%v,%v\n",
+					line.Average, line.TotalTime, line.Total, line.TotalErrors, line.StageErrors, line.TotalWorkers, line.LastResult, line.LastError, line.WorstResult, line.WallTime, line.Type)
 			}
 		}
 	}
@@ -196,7 +245,9 @@ func handler(fn func(http.ResponseWriter, *http.Request) (interface{}, error)) h
 			}
 		}
 
-		if err != nil {
+		if _, ok := err.(badRequest); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}
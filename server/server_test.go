@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -114,7 +115,7 @@ var _ = Describe("Server", func() {
 		json := get("/experiments/a")
 		Ω(json).Should(HaveLen(1))
 		experimentA := json["Items"].([]interface{})[0]
-		keys := []string{"Average", "Commands", "LastError", "NinetyfifthPercentile", "Total", "TotalTime", "TotalWorkers", "WallTime", "WorstResult", "LastResult", "TotalErrors", "Type"}
+		keys := []string{"Average", "Commands", "LastError", "NinetyfifthPercentile", "Total", "TotalTime", "TotalWorkers", "WallTime", "WorstResult", "LastResult", "TotalErrors", "StageErrors", "Type"}
 		for _, key := range keys {
 			Ω(experimentA).Should(HaveKey(key))
 		}
@@ -172,8 +173,52 @@ var _ = Describe("Server", func() {
 	})
 
 	It("Supports a 'workload' parameter", func() {
-		post("/experiments/?workload=flibble")
-		Ω(lab.config.Workload).Should(Equal("flibble"))
+		post("/experiments/?workload=" + url.QueryEscape("rest:login,cf:push(memory=256M)"))
+		Ω(lab.config.Workload).Should(Equal("rest:login,cf:push(memory=256M)"))
+	})
+
+	It("Rejects unknown workload steps, including those of scenarios", func() {
+		status, body := reqWithStatus("POST", "/experiments/?workload=flibble")
+		Ω(status).Should(Equal(http.StatusBadRequest))
+		Ω(string(body)).Should(ContainSubstring("flibble"))
+		status, body = reqWithStatus("POST", "/experiments/?scenario="+url.QueryEscape("iteration:\n  - flobble\n"))
+		Ω(status).Should(Equal(http.StatusBadRequest))
+		Ω(string(body)).Should(ContainSubstring("flobble"))
+		Ω(lab.config).Should(BeNil())
+	})
+
+	It("Rejects scenarios which do not parse", func() {
+		status, _ := reqWithStatus("POST", "/experiments/?scenario="+url.QueryEscape("iteration: [unclosed\n"))
+		Ω(status).Should(Equal(http.StatusBadRequest))
+		Ω(lab.config).Should(BeNil())
+	})
+
+	It("Supports a 'scenario' parameter", func() {
+		post("/experiments/?scenario=" + url.QueryEscape("setup:\n  - rest:login\niteration:\n  - step: cf:push\n    repeat: 2\n"))
+		Ω(lab.config.Setup).Should(Equal("rest:login"))
+		Ω(lab.config.Workload).Should(Equal("cf:push,cf:push"))
+	})
+
+	It("Rejects an unknown setup scope", func() {
+		status, body := reqWithStatus("POST", "/experiments/?setup=rest:login&setupScope=bogus")
+		Ω(status).Should(Equal(http.StatusBadRequest))
+		Ω(string(body)).Should(ContainSubstring("bogus"))
+		Ω(lab.config).Should(BeNil())
+	})
+
+	It("Rejects unknown setup and teardown steps", func() {
+		status, body := reqWithStatus("POST", "/experiments/?setup=flibble")
+		Ω(status).Should(Equal(http.StatusBadRequest))
+		Ω(string(body)).Should(ContainSubstring("flibble"))
+		status, body = reqWithStatus("POST", "/experiments/?teardown=rest:login,flobble")
+		Ω(status).Should(Equal(http.StatusBadRequest))
+		Ω(string(body)).Should(ContainSubstring("flobble"))
+		Ω(lab.config).Should(BeNil())
+	})
+
+	It("Supports a 'labels' parameter", func() {
+		post("/experiments/?labels=inside,outside")
+		Ω(lab.config.Labels).Should(Equal([]string{"inside", "outside"}))
 	})
 
 	It("Supports a 'cfTarget' parameter", func() {
@@ -201,11 +246,30 @@ var _ = Describe("Server", func() {
 		Ω(json["Location"]).Should(Equal("/experiments/some-guid"))
 	})
 
+	It("Cleans up the experiment's resources once it has finished", func() {
+		cleanedUp := make([]string, 0)
+		CleanupExperiment = func(ctx context.Context, experimentGuid string) error {
+			cleanedUp = append(cleanedUp, experimentGuid)
+			return nil
+		}
+		post("/experiments/")
+		Ω(workloadCtxStringValue("ledger:dir")).Should(Equal(LedgerDir))
+
+		samples := make(chan *Sample, 1)
+		samples <- &Sample{}
+		close(samples)
+		for _, handler := range lab.handlers {
+			handler(samples)
+		}
+		Ω(cleanedUp).Should(Equal([]string{"some-guid"}))
+	})
+
 })
 
 type DummyLab struct {
 	experiments []*DummyExperiment
 	config      *RunnableExperiment
+	handlers    []func(<-chan *Sample)
 }
 
 type DummyExperiment struct {
@@ -213,16 +277,17 @@ type DummyExperiment struct {
 }
 
 func (l *DummyLab) RunWithHandlers(ex Runnable, fns []func(<-chan *Sample), workloadCtx context.Context) (string, error) {
-	Fail("called unexpected dummy function")
-	return "", nil
-}
-
-func (l *DummyLab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
 	l.config = ex.(*RunnableExperiment)
+	l.handlers = fns
 	workloadContext = workloadCtx
+	workloadCtx.PutString("experimentGuid", "some-guid")
 	return "some-guid", nil
 }
 
+func (l *DummyLab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
+	return l.RunWithHandlers(ex, nil, workloadCtx)
+}
+
 func (l *DummyLab) Visit(fn func(ex Experiment)) {
 	for _, e := range l.experiments {
 		fn(e)
@@ -258,6 +323,11 @@ func decode(encoded []byte) (decoded map[string]interface{}) {
 }
 
 func req(method string, url string) []byte {
+	_, body := reqWithStatus(method, url)
+	return body
+}
+
+func reqWithStatus(method string, url string) (int, []byte) {
 	resp := httptest.NewRecorder()
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
@@ -267,9 +337,9 @@ func req(method string, url string) []byte {
 	http.DefaultServeMux.ServeHTTP(resp, req)
 	if body, err := ioutil.ReadAll(resp.Body); err != nil {
 		Ω(err).NotTo(HaveOccurred())
-		return nil
+		return resp.Code, nil
 	} else {
-		return body
+		return resp.Code, body
 	}
 }
 
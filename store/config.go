@@ -38,7 +38,7 @@ var WithRedisConnection = func(fn func(conn redis.Conn) error) error {
 }
 
 var RedisStoreFactory = func(conn redis.Conn) (laboratory.Store, error) {
-	return NewRedisStore(conn)
+	return NewRedisStoreInNamespace(conn, redis.ConfiguredNamespace())
 }
 
 var CsvStoreFactory = func(dir string) laboratory.Store {
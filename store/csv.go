@@ -2,6 +2,7 @@ package store
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path"
@@ -69,7 +70,7 @@ func (self *csvFile) Write(samples <-chan *experiment.Sample) {
 	var body []string
 	w := csv.NewWriter(f)
 
-	header = []string{"Average", "TotalTime", "SystemTime", "Total", "TotalErrors", "LastError", "TotalWorkers", "LastResult", "WorstResult", "NinetyfifthPercentile", "WallTime", "Type"}
+	header = []string{"Average", "TotalTime", "SystemTime", "Total", "TotalErrors", "LastError", "TotalWorkers", "LastResult", "WorstResult", "NinetyfifthPercentile", "WallTime", "Type", "Metrics", "StageErrors"}
 	for _, k := range self.commands {
 		header = append(header, "Commands|"+k+"|Count",
 			"Commands|"+k+"|Throughput",
@@ -93,7 +94,9 @@ func (self *csvFile) Write(samples <-chan *experiment.Sample) {
 				strconv.Itoa(int(s.WorstResult.Nanoseconds())),
 				strconv.Itoa(int(s.NinetyfifthPercentile.Nanoseconds())),
 				strconv.Itoa(int(s.WallTime)),
-				strconv.Itoa(int(s.Type))}
+				strconv.Itoa(int(s.Type)),
+				encodeMetrics(s.Metrics),
+				strconv.Itoa(s.StageErrors)}
 
 			for _, k := range self.commands {
 				if s.Commands[k].Count == 0 {
@@ -128,12 +131,20 @@ func (self *csvFile) GetData() (samples []*experiment.Sample, err error) {
 
 	var cmd experiment.Command
 	var cmdColumns = make(map[string]int)
+	var metricsColumn = -1
+	var stageErrorsColumn = -1
 	for i, d := range decoded {
 		if i == 0 {
 			for n, s := range d {
 				if strings.HasPrefix(s, "Commands|") {
 					cmdColumns[s] = n
 				}
+				if s == "Metrics" {
+					metricsColumn = n
+				}
+				if s == "StageErrors" {
+					stageErrorsColumn = n
+				}
 			}
 		} else {
 			sample := &experiment.Sample{}
@@ -150,6 +161,15 @@ func (self *csvFile) GetData() (samples []*experiment.Sample, err error) {
 			sample.NinetyfifthPercentile, err = duration(d[9])
 			sample.WallTime, err = duration(d[10])
 			sample.Type = experiment.ResultSample // this is the only type we currently persist
+			if metricsColumn >= 0 && d[metricsColumn] != "" {
+				if err := json.Unmarshal([]byte(d[metricsColumn]), &sample.Metrics); err != nil {
+					return nil, err
+				}
+			}
+
+			if stageErrorsColumn >= 0 {
+				sample.StageErrors, err = strconv.Atoi(d[stageErrorsColumn])
+			}
 
 			var cmdName string
 			for k, _ := range cmdColumns {
@@ -180,6 +200,16 @@ func (self *csvFile) GetData() (samples []*experiment.Sample, err error) {
 	return
 }
 
+// metrics are named by the workloads reporting them rather than known up front
+// like the commands, so they are kept as JSON in a single column
+func encodeMetrics(metrics map[string]experiment.Metric) string {
+	if len(metrics) == 0 {
+		return ""
+	}
+	encoded, _ := json.Marshal(metrics)
+	return string(encoded)
+}
+
 func (store *CsvStore) LoadAll() (samples []experiment.Experiment, err error) {
 	files, err := ioutil.ReadDir(store.dir)
 	if err != nil {
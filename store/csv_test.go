@@ -27,6 +27,7 @@ var _ = Describe("Csv Store", func() {
 			store    *CsvStore
 			output   string
 			commands map[string]experiment.Command
+			metrics  map[string]experiment.Metric
 		)
 
 		JustBeforeEach(func() {
@@ -40,9 +41,10 @@ var _ = Describe("Csv Store", func() {
 			commands = make(map[string]experiment.Command)
 			cmd := experiment.Command{1, 0.5, 2, 3, 4, 5}
 			commands["boo"] = cmd
+			metrics = map[string]experiment.Metric{"boo/loss-rate": experiment.Metric{"gauge", 2, 0.25, 0.5, 0.5, 0, 0.5}}
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{commands, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample},
+				&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 2, 5, 6, "", 7, 3, 8, experiment.ResultSample, metrics},
+				&experiment.Sample{commands, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 0, 5, 4, "foo", 3, 7, 2, experiment.ResultSample, nil},
 			})
 			files, err := ioutil.ReadDir(dir)
 			Ω(err).ShouldNot(HaveOccurred())
@@ -71,21 +73,22 @@ var _ = Describe("Csv Store", func() {
 			samples, err := ex[0].GetData()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(samples[0]).Should(Equal(&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample}))
+			Ω(samples[0]).Should(Equal(&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 2, 5, 6, "", 7, 3, 8, experiment.ResultSample, metrics}))
+			Ω(samples[1].Metrics).Should(BeNil())
 		})
 
 		It("Loads multiple CSVs from a directory, in order", func() {
 			foo := store.Writer("bar")
 			write(foo, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil},
+				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 0, 5, 4, "foo", 3, 7, 2, experiment.ResultSample, nil},
 			})
 
 			bar := store.Writer("baz")
 			write(bar, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 1, 2, "2009-12-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2010-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil},
+				&experiment.Sample{nil, 1, 2, "2009-12-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil},
+				&experiment.Sample{nil, 9, 8, "2010-12-10T23:00:00Z", 7, 6, 0, 5, 4, "foo", 3, 7, 2, experiment.ResultSample, nil},
 			})
 
 			samples, err := store.LoadAll()
@@ -10,7 +10,8 @@ import (
 const MAX_RESULTS = 10000
 
 type redisStore struct {
-	c redis.Conn
+	c         redis.Conn
+	namespace redis.Namespace
 }
 
 type redisExperiment struct {
@@ -19,12 +20,16 @@ type redisExperiment struct {
 }
 
 func NewRedisStore(conn redis.Conn) (*redisStore, error) {
-	return &redisStore{conn}, nil
+	return NewRedisStoreInNamespace(conn, "")
+}
+
+func NewRedisStoreInNamespace(conn redis.Conn, namespace redis.Namespace) (*redisStore, error) {
+	return &redisStore{conn, namespace}, nil
 }
 
 func (r *redisStore) LoadAll() ([]experiment.Experiment, error) {
 	c := r.c
-	members, err := redis.Strings(c.Do("LRANGE", "experiments", 0, MAX_RESULTS))
+	members, err := redis.Strings(c.Do("LRANGE", r.namespace.Key("experiments"), 0, MAX_RESULTS))
 	if err != nil {
 		return nil, err
 	}
@@ -38,21 +43,21 @@ func (r *redisStore) LoadAll() ([]experiment.Experiment, error) {
 }
 
 func (r *redisStore) Writer(guid string) func(samples <-chan *experiment.Sample) {
-	r.c.Do("RPUSH", "experiments", guid)
+	r.c.Do("RPUSH", r.namespace.Key("experiments"), guid)
 	return func(ch <-chan *experiment.Sample) {
 		for sample := range ch {
-			push(r.c, guid, sample)
+			push(r.c, r.namespace.Key("experiment."+guid), sample)
 		}
 	}
 }
 
-func push(c redis.Conn, guid string, sample *experiment.Sample) {
+func push(c redis.Conn, key string, sample *experiment.Sample) {
 	json, _ := json.Marshal(sample)
-	c.Do("RPUSH", "experiment."+guid, json)
+	c.Do("RPUSH", key, json)
 }
 
 func (r redisExperiment) GetData() ([]*experiment.Sample, error) {
-	members, err := redis.Strings(r.redisStore.c.Do("LRANGE", "experiment."+r.guid, 0, MAX_RESULTS))
+	members, err := redis.Strings(r.redisStore.c.Do("LRANGE", r.redisStore.namespace.Key("experiment."+r.guid), 0, MAX_RESULTS))
 	if err != nil {
 		return nil, err
 	}
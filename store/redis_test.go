@@ -40,25 +40,48 @@ var _ = Describe("Redis Store", func() {
 
 			writer := store.Writer("experiment-1")
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 1, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil},
+				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 0, 5, 4, "foo", 3, 1, 2, experiment.ResultSample, map[string]experiment.Metric{"push/bytes-uploaded": experiment.Metric{"counter", 2, 512, 1024, 256, 256, 768}}},
 			})
 
 			writer = store.Writer("experiment-2")
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{nil, 2, 2, "2010-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
+				&experiment.Sample{nil, 2, 2, "2010-11-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil},
 			})
 
 			writer = store.Writer("experiment-3")
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 3, "2011-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 2, 3, "2011-12-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2012-11-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 1, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 3, "2011-11-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil},
+				&experiment.Sample{nil, 2, 3, "2011-12-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil},
+				&experiment.Sample{nil, 9, 8, "2012-11-10T23:00:00Z", 7, 6, 0, 5, 4, "foo", 3, 1, 2, experiment.ResultSample, nil},
 			})
 
 			writer = store.Writer("experiment-with-no-data")
 		})
 
+		It("Does not list experiments from another namespace", func() {
+			conn, err := redis.Connect("", 63798, "p4ssw0rd")
+			Ω(err).ShouldNot(HaveOccurred())
+			namespaced, err := NewRedisStoreInNamespace(conn, "someone-else")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			experiments, err := namespaced.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(0))
+
+			write(namespaced.Writer("experiment-4"), []*experiment.Sample{
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 0, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil},
+			})
+			experiments, err = namespaced.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(1))
+			Ω(data(experiments[0].GetData())).Should(HaveLen(1))
+
+			experiments, err = store.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(4))
+		})
+
 		It("Round trips experiment list", func() {
 			experiments, err := store.LoadAll()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -88,6 +111,7 @@ var _ = Describe("Redis Store", func() {
 			Ω(data(experiments[0].GetData())[1].Total).Should(Equal(int64(7)))
 			Ω(data(experiments[1].GetData())[0].TotalErrors).Should(Equal(4))
 			Ω(data(experiments[2].GetData())[2].TotalWorkers).Should(Equal(5))
+			Ω(data(experiments[0].GetData())[1].Metrics["push/bytes-uploaded"].Total).Should(Equal(1024.0))
 		})
 
 		It("Returns empty array if data not found (redis cannot distinguish empty from not-created lists)", func() {
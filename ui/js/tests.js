@@ -56,10 +56,10 @@ describe("Workload List", function(){
 
   it("returns a list of selected commands, separated by commas", function(){
     $("#workloadItems button:contains('cf:push')").trigger("click")
-    $("#workloadItems button:contains('dummyWithErrors')").trigger("click")
+    $("#workloadItems button:contains('faulty')").trigger("click")
     $("#workloadItems button:contains('cf:push')").trigger("click")
 
-    expect( workloadList.workloads() ).toBe("cf:push,dummyWithErrors,cf:push")    
+    expect( workloadList.workloads() ).toBe("cf:push,faulty(dummy,error=10%),cf:push")    
   })
 
   it("removes a selected command when selected command is clicked", function(){
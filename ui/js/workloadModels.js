@@ -46,9 +46,9 @@ patWorkload = function(){
 		click: workloadClick
 	}
 
-	var dummyWithErrors = {
-		name: "dummyWithErrors",
-		html: "<span class='glyphicon glyphicon-plus-sign'></span> dummyWithErrors",
+	var faultyDummy = {
+		name: "faulty(dummy,error=10%)",
+		html: "<span class='glyphicon glyphicon-plus-sign'></span> faulty(dummy,error=10%)",
 		requires: [],
 		requiredBy: [],
 		args: [],
@@ -242,7 +242,7 @@ patWorkload = function(){
  	}
 
 	// construct models
-	var availableCmds = ko.observableArray([restTarget, restLogin, restPush, cfPush, dummy, dummyWithErrors])
+	var availableCmds = ko.observableArray([restTarget, restLogin, restPush, cfPush, dummy, faultyDummy])
 	var selectedCmds = ko.observableArray([])
 	var reqArguments = ko.observableArray([cfTarget, cfUser, cfPass, cfSpace]);
 
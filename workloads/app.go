@@ -0,0 +1,106 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+const DefaultRouteTimeoutInSeconds = 60 * 5
+
+var RoutePollInterval = 1 * time.Second
+
+func PopulateRouteContext(domain string, timeoutInSeconds int, ctx context.Context) {
+	ctx.PutString("app:domain", domain)
+	ctx.PutInt("app:routeTimeout", timeoutInSeconds)
+}
+
+func (r *rest) FirstRequest(ctx context.Context) error {
+	url, err := r.lastAppUrl(ctx)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := ctx.GetInt("app:routeTimeout")
+	if timeout <= 0 {
+		timeout = DefaultRouteTimeoutInSeconds
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		var body []byte
+		reply := r.client.Request("GET", url, nil, nil, requestTimeout(deadline), &body)
+		if reply.Code == 200 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("App did not respond with 200 on %s within %d seconds, last response: %s", url, timeout, reply.Message)
+		}
+
+		time.Sleep(RoutePollInterval)
+	}
+}
+
+// lastAppUrl is the root URL of the most recently pushed app: that of the
+// first route mapped to it if it was pushed with the REST api, which knows its
+// guid, or <name>.<app:domain>, the route cf:push maps by default, so that
+// cf:push apps can be requested without logging in
+func (r *rest) lastAppUrl(ctx context.Context) (string, error) {
+	appName, ok := lastAppName(ctx)
+	if !ok {
+		return "", errors.New("No pushed app to request")
+	}
+
+	if appGuid, ok := ctx.GetString("appGuid:" + appName); ok {
+		return r.appRouteUrl(ctx, appGuid)
+	}
+
+	domain, err := appDomain(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://%s.%s/", appName, domain), nil
+}
+
+// appRouteUrl is the root URL of the first route mapped to the app
+func (r *rest) appRouteUrl(ctx context.Context, appGuid string) (url string, err error) {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	err = r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		routes := &RoutesResponse{}
+		return r.GetSuccessfully(token, fmt.Sprintf("%s/v2/apps/%s/routes?inline-relations-depth=1", apiEndpoint, appGuid), nil, routes, func(reply Reply) error {
+			if len(routes.Resources) == 0 {
+				return fmt.Errorf("App %s has no route to request", appGuid)
+			}
+
+			route := routes.Resources[0].Entity
+			host := route.Domain.Entity.Name
+			if route.Host != "" {
+				host = route.Host + "." + host
+			}
+			url = fmt.Sprintf("http://%s%s/", host, strings.TrimSuffix(route.Path, "/"))
+			return nil
+		})
+	})
+	return
+}
+
+func appDomain(ctx context.Context) (string, error) {
+	if domain, _ := ctx.GetString("app:domain"); domain != "" {
+		return domain, nil
+	}
+
+	if apiEndpoint, ok := ctx.GetString("apiEndpoint"); ok {
+		parts := strings.SplitN(apiEndpoint, "://", 2)
+		host := parts[len(parts)-1]
+		if strings.HasPrefix(host, "api.") {
+			return strings.TrimSuffix(strings.TrimPrefix(host, "api."), "/"), nil
+		}
+	}
+
+	return "", errors.New("argument app:domain does not exist")
+}
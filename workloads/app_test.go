@@ -0,0 +1,81 @@
+package workloads_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App first request workload", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+		err     error
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		RoutePollInterval = 10 * time.Millisecond
+	})
+
+	JustBeforeEach(func() {
+		err = NewRestWorkloadWithClient(client).FirstRequest(ctx)
+	})
+
+	Context("When no app has been pushed", func() {
+		BeforeEach(func() {
+			PopulateRouteContext("example.com", 1, ctx)
+		})
+
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When an app has been pushed", func() {
+		BeforeEach(func() {
+			ctx.PutString("appNames", "firstapp,myapp")
+		})
+
+		Context("and it responds on its route", func() {
+			BeforeEach(func() {
+				PopulateRouteContext("example.com", 1, ctx)
+				replies["http://myapp.example.com/"] = "hello"
+			})
+
+			It("requests the most recently pushed app", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				client.ShouldHaveBeenCalledWith("GET", "http://myapp.example.com/")
+			})
+		})
+
+		Context("and no domain is configured", func() {
+			BeforeEach(func() {
+				PopulateRouteContext("", 1, ctx)
+				ctx.PutString("apiEndpoint", "https://api.example.com")
+				replies["http://myapp.example.com/"] = "hello"
+			})
+
+			It("uses the domain of the API endpoint", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				client.ShouldHaveBeenCalledWith("GET", "http://myapp.example.com/")
+			})
+		})
+
+		Context("and it never responds with 200", func() {
+			BeforeEach(func() {
+				PopulateRouteContext("example.com", 1, ctx)
+			})
+
+			It("returns an error once the timeout expires", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
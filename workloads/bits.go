@@ -0,0 +1,239 @@
+package workloads
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+// files the cf CLI never uploads, whatever the .cfignore says
+var defaultIgnores = []string{".cfignore", "_darcs", ".DS_Store", ".git", ".gitignore", ".hg", "manifest.yml", ".svn"}
+
+type appFile struct {
+	Fn   string `json:"fn"`
+	Sha1 string `json:"sha1"`
+	Size int64  `json:"size"`
+	path string
+	mode os.FileMode
+}
+
+type resourceFingerprint struct {
+	Sha1 string `json:"sha1"`
+	Size int64  `json:"size"`
+}
+
+func PopulatePushContext(resourceMatching bool, ctx context.Context) {
+	ctx.PutBool("rest:resource-matching", resourceMatching)
+}
+
+// withAppBits uploads the directory in the app context key, or a generated
+// Ruby app when none is configured
+func (r *rest) withAppBits(ctx context.Context, token string, fn func(b *bytes.Buffer, m *multipart.Writer) error) error {
+	return withAppDirBits(ctx, "application", func(files []appFile) ([]appFile, error) {
+		if resourceMatching, _ := ctx.GetBool("rest:resource-matching"); resourceMatching {
+			return r.matchResources(ctx, token, files)
+		}
+		return []appFile{}, nil
+	}, fn)
+}
+
+// withV3AppBits uploads the same app as withAppBits in the bits field of a v3
+// package upload; every file is uploaded, as v3 matches resources differently
+func withV3AppBits(ctx context.Context, fn func(b *bytes.Buffer, m *multipart.Writer) error) error {
+	return withAppDirBits(ctx, "bits", nil, fn)
+}
+
+func withAppDirBits(ctx context.Context, fieldName string, match func(files []appFile) ([]appFile, error), fn func(b *bytes.Buffer, m *multipart.Writer) error) error {
+	appPath, _ := ctx.GetString("app")
+	if appPath == "" {
+		return withGeneratedAppBits(fieldName, fn)
+	}
+
+	files, err := appFiles(appPath)
+	if err != nil {
+		return err
+	}
+
+	matched := make([]appFile, 0)
+	if match != nil {
+		matched, err = match(files)
+		if err != nil {
+			return err
+		}
+	}
+
+	return withZippedAppBits(fieldName, files, matched, fn)
+}
+
+func (r *rest) matchResources(ctx context.Context, token string, files []appFile) ([]appFile, error) {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	fingerprints := make([]resourceFingerprint, len(files))
+	for i, f := range files {
+		fingerprints[i] = resourceFingerprint{f.Sha1, f.Size}
+	}
+
+	var known []resourceFingerprint
+	err := r.PutSuccessfully(token, fmt.Sprintf("%s/v2/resource_match", apiEndpoint), fingerprints, &known, func(reply Reply) error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	isKnown := make(map[resourceFingerprint]bool)
+	for _, k := range known {
+		isKnown[k] = true
+	}
+
+	matched := make([]appFile, 0)
+	for _, f := range files {
+		if isKnown[resourceFingerprint{f.Sha1, f.Size}] {
+			matched = append(matched, f)
+		}
+	}
+	return matched, nil
+}
+
+func withZippedAppBits(fieldName string, files []appFile, matched []appFile, fn func(b *bytes.Buffer, m *multipart.Writer) error) error {
+	skip := make(map[string]bool)
+	for _, f := range matched {
+		skip[f.Fn] = true
+	}
+
+	var b bytes.Buffer
+	multi := multipart.NewWriter(&b)
+	appbits, _ := multi.CreateFormFile(fieldName, "app.zip")
+	zipper := zip.NewWriter(appbits)
+	for _, f := range files {
+		if skip[f.Fn] {
+			continue
+		}
+
+		if err := addToZip(zipper, f); err != nil {
+			return err
+		}
+	}
+	zipper.Close()
+
+	resources, _ := multi.CreateFormField("resources")
+	encoded, _ := json.Marshal(matched)
+	resources.Write(encoded)
+	multi.Close()
+
+	return fn(&b, multi)
+}
+
+func addToZip(zipper *zip.Writer, f appFile) error {
+	header := &zip.FileHeader{Name: f.Fn, Method: zip.Deflate}
+	header.SetMode(f.mode)
+	w, err := zipper.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// appFiles lists the files the cf CLI would upload from dir, with their fingerprints
+func appFiles(dir string) ([]appFile, error) {
+	ignores, err := cfIgnores(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]appFile, 0)
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if isIgnored(rel, ignores) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		files = append(files, appFile{rel, fmt.Sprintf("%x", sha1.Sum(contents)), info.Size(), file, info.Mode()})
+		return nil
+	})
+
+	return files, err
+}
+
+func cfIgnores(dir string) ([]string, error) {
+	ignores := append([]string{}, defaultIgnores...)
+
+	in, err := os.Open(filepath.Join(dir, ".cfignore"))
+	if os.IsNotExist(err) {
+		return ignores, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			ignores = append(ignores, line)
+		}
+	}
+
+	return ignores, scanner.Err()
+}
+
+// isIgnored matches .cfignore patterns against a path and each of its parent
+// directories; patterns starting with / only match from the app root
+func isIgnored(rel string, ignores []string) bool {
+	for _, pattern := range ignores {
+		pattern = strings.TrimSuffix(pattern, "/")
+		anchored := strings.HasPrefix(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+
+		for prefix := rel; prefix != "." && prefix != "/"; prefix = path.Dir(prefix) {
+			if matched, _ := path.Match(pattern, prefix); matched {
+				return true
+			}
+			if matched, _ := path.Match(pattern, path.Base(prefix)); matched && !anchored {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -1,13 +1,13 @@
 package workloads
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -16,10 +16,10 @@ import (
 
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/nu7hatch/gouuid"
-	"github.com/onsi/ginkgo"
-	. "github.com/pivotal-cf-experimental/cf-test-helpers/cf"
 )
 
+const cfTimeout = 10 * time.Minute
+
 //Todo(simon) Remove, for dev testing only
 func random(min, max int) int {
 	rand.Seed(time.Now().UTC().UnixNano())
@@ -29,15 +29,7 @@ func random(min, max int) int {
 
 func Dummy(ctx context.Context) error {
 	guid, _ := uuid.NewV4()
-	appName := "pats-" + guid.String()
-	appNames, _ := ctx.GetString("appNames")
-
-	if appNames != "" {
-		appNames += fmt.Sprintf(",%s", appName)
-	} else {
-		appNames = appName
-	}
-	ctx.PutString("appNames", appNames)
+	addAppName(ctx, "pats-"+guid.String())
 
 	time.Sleep(time.Duration(random(1, 5)) * time.Second)
 	return nil
@@ -48,12 +40,63 @@ func DummyDelete(ctx context.Context) error {
 	return nil
 }
 
-func DummyWithErrors(ctx context.Context) error {
-	Dummy(ctx)
-	if random(0, 10) > 8 {
-		return errors.New("Random (dummy) error")
+func PopulateCfPushContext(memory string, instances string, ctx context.Context) {
+	ctx.PutString("cf:memory", memory)
+	ctx.PutString("cf:instances", instances)
+}
+
+func PopulateCfLoginContext(org string, ctx context.Context) {
+	ctx.PutString("cf:org", org)
+}
+
+// CfLogin logs the CF command-line in as the worker's user in a CF_HOME of
+// its own, which the worker's later cf steps use, so that concurrent workers
+// do not share (and race on) one cf config. The credentials are given to cf
+// auth in its environment, so that they do not show up in the process list
+func CfLogin(ctx context.Context) error {
+	target, _ := ctx.GetString("rest:target")
+	if target == "" {
+		return errors.New("argument rest:target does not exist")
 	}
-	return nil
+
+	home, err := ioutil.TempDir("", "pats-cf-home")
+	if err != nil {
+		return err
+	}
+	ctx.PutString("cf:home", home)
+
+	if err := expectCfToSay(ctx, "OK", "api", target); err != nil {
+		return err
+	}
+
+	username, password := credentialsForWorker(ctx)
+	if err := expectCfToSayWithEnv(ctx, []string{"CF_USERNAME=" + username, "CF_PASSWORD=" + password}, "OK", "auth"); err != nil {
+		return err
+	}
+
+	args := []string{"target"}
+	if org, _ := ctx.GetString("cf:org"); org != "" {
+		args = append(args, "-o", org)
+	}
+	if space, _ := ctx.GetString("rest:space"); space != "" {
+		args = append(args, "-s", space)
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	return expectCfToSay(ctx, "org:", args...)
+}
+
+func CfLogout(ctx context.Context) error {
+	home, _ := ctx.GetString("cf:home")
+	if home == "" {
+		return nil
+	}
+
+	err := expectCfToSay(ctx, "OK", "logout")
+	ctx.PutString("cf:home", "")
+	os.RemoveAll(home)
+	return err
 }
 
 func Push(ctx context.Context) error {
@@ -61,35 +104,83 @@ func Push(ctx context.Context) error {
 	pathToApp, _ := ctx.GetString("app")
 	pathToManifest, _ := ctx.GetString("app:manifest")
 	appName := "pats-" + guid.String()
-	appNames, _ := ctx.GetString("appNames")
+	addAppName(ctx, appName)
+	recordResource(ctx, LedgerCfApp, appName)
 
-	if appNames != "" {
-		appNames += fmt.Sprintf(",%s", appName)
-	} else {
-		appNames = appName
+	args := []string{"push", appName, "-p", pathToApp}
+	if pathToManifest != "" {
+		args = append(args, "-f", pathToManifest)
 	}
-	ctx.PutString("appNames", appNames)
-
-	if pathToManifest == "" {
-		return expectCfToSay("App started", "push", appName, "-m", "64M", "-p", pathToApp)
-	} else {
-		return expectCfToSay("App started", "push", appName, "-p", pathToApp, "-f", pathToManifest)
+	if memory, _ := ctx.GetString("cf:memory"); memory != "" {
+		args = append(args, "-m", memory)
+	} else if pathToManifest == "" {
+		args = append(args, "-m", fmt.Sprintf("%dM", DefaultPushMemoryInMB))
+	}
+	if instances, _ := ctx.GetString("cf:instances"); instances != "" {
+		args = append(args, "-i", instances)
 	}
+
+	return expectCfToSay(ctx, "App started", args...)
 }
 
 func Delete(ctx context.Context) error {
-	appNames, _ := ctx.GetString("appNames")
-	if appNames == "" {
+	appNameToDelete, ok := lastAppName(ctx)
+	if !ok {
 		return errors.New("No app to delete")
 	}
-	appNamesArray := strings.Split(appNames, ",")
-	appNameToDelete := appNamesArray[len(appNamesArray)-1]
 
-	appNames = strings.Replace(appNames, ","+appNameToDelete, "", -1)
-	appNames = strings.Replace(appNames, appNameToDelete, "", -1)
-	ctx.PutString("appNames", appNames)
-	return expectCfToSay("Deleting app", "delete", appNameToDelete, "-f")
+	removeAppName(ctx, appNameToDelete)
+	err := CfDeleteApp(ctx, appNameToDelete)
+	if err == nil {
+		forgetResource(ctx, LedgerCfApp, appNameToDelete)
+	}
+	return err
+}
+
+func addAppName(ctx context.Context, appName string) {
+	appendToList(ctx, "appNames", appName)
+}
+
+func lastAppName(ctx context.Context) (string, bool) {
+	return lastInList(ctx, "appNames")
+}
+
+func removeAppName(ctx context.Context, appName string) {
+	removeFromList(ctx, "appNames", appName)
+}
+
+// the context only holds strings, so lists of apps are kept comma-separated
+func appendToList(ctx context.Context, key string, value string) {
+	list, _ := ctx.GetString(key)
+
+	if list != "" {
+		list += fmt.Sprintf(",%s", value)
+	} else {
+		list = value
+	}
+	ctx.PutString(key, list)
+}
+
+func lastInList(ctx context.Context, key string) (string, bool) {
+	list, _ := ctx.GetString(key)
+	if list == "" {
+		return "", false
+	}
+	values := strings.Split(list, ",")
+	return values[len(values)-1], true
+}
+
+func removeFromList(ctx context.Context, key string, value string) {
+	list, _ := ctx.GetString(key)
+	remaining := make([]string, 0)
+	for _, v := range strings.Split(list, ",") {
+		if v != "" && v != value {
+			remaining = append(remaining, v)
+		}
+	}
+	ctx.PutString(key, strings.Join(remaining, ","))
 }
+
 func CopyAndReplaceText(srcDir string, dstDir string, searchText string, replaceText string) error {
 	return filepath.Walk(srcDir, func(file string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -135,23 +226,75 @@ func GenerateAndPush(ctx context.Context) error {
 		return err
 	}
 
+	appName := "pats-" + guid.String()
+	addAppName(ctx, appName)
+	recordResource(ctx, LedgerCfApp, appName)
+
 	if pathToManifest == "" {
-		return expectCfToSay("App started", "push", "pats-"+guid.String(), "-m", "64M", "-p", pathToApp)
+		return expectCfToSay(ctx, "App started", "push", appName, "-m", "64M", "-p", pathToApp)
 	} else {
-		return expectCfToSay("App started", "push", "pats-"+guid.String(), "-p", pathToApp, "-f", pathToManifest)
+		return expectCfToSay(ctx, "App started", "push", appName, "-p", pathToApp, "-f", pathToManifest)
 	}
 }
 
-func expectCfToSay(expect string, args ...string) error {
-	var outBuffer bytes.Buffer
-	oldWriter := ginkgo.GinkgoWriter
-	ginkgo.GinkgoWriter = bufio.NewWriter(&outBuffer)
-	cfOutBuffer := Cf(args...).Wait(10 * time.Minute).Out
-	cfContents := cfOutBuffer.Contents()
-	ginkgo.GinkgoWriter = oldWriter
-	if strings.Contains(string(cfContents), expect) {
-		return nil
-	} else {
-		return errors.New(string(cfContents))
+// expectCfToSay runs the CF command-line, tracing its requests to the
+// iteration's trace file, if there is one, to time the phases of a push. The
+// trace is kept if the command fails, and its path given in the error
+func expectCfToSay(ctx context.Context, expect string, args ...string) error {
+	return expectCfToSayWithEnv(ctx, nil, expect, args...)
+}
+
+// expectCfToSayWithEnv is expectCfToSay with variables added to cf's
+// environment
+func expectCfToSayWithEnv(ctx context.Context, env []string, expect string, args ...string) error {
+	trace := cfTracePath(ctx)
+	var offset int64
+	if trace != "" {
+		if err := os.MkdirAll(path.Dir(trace), 0755); err != nil {
+			return err
+		}
+		if info, err := os.Stat(trace); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	output, err := runCf(ctx, trace, env, args...)
+	exchanges := readCfTrace(trace, offset)
+	if !strings.Contains(string(output), expect) {
+		return cfError(args[0], output, err, exchanges, trace)
 	}
+
+	recordCfPhases(ctx, exchanges)
+	if trace != "" {
+		if offset == 0 {
+			os.Remove(trace)
+		} else {
+			os.Truncate(trace, offset)
+		}
+	}
+	return nil
+}
+
+// runCf runs the CF command-line, in the worker's CF_HOME if cf:login gave it one
+func runCf(ctx context.Context, trace string, env []string, args ...string) ([]byte, error) {
+	var output bytes.Buffer
+	cmd := exec.Command("cf", args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(), env...)
+	if home, _ := ctx.GetString("cf:home"); home != "" {
+		cmd.Env = append(cmd.Env, "CF_HOME="+home)
+	}
+	if trace != "" {
+		cmd.Env = append(cmd.Env, "CF_TRACE="+trace)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	timer := time.AfterFunc(cfTimeout, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+
+	err := cmd.Wait()
+	return output.Bytes(), err
 }
@@ -7,6 +7,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/cloudfoundry-incubator/pat/context"
 	. "github.com/cloudfoundry-incubator/pat/workloads"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -82,4 +83,71 @@ var _ = Describe("cf Workloads", func() {
 			})
 		})
 	})
+
+	Describe("Running the CF command-line as the worker's user", func() {
+		var (
+			binDir  string
+			oldPath string
+			ctx     context.Context
+		)
+
+		calls := func() []string {
+			log, _ := ioutil.ReadFile(path.Join(binDir, "calls"))
+			return strings.Split(strings.TrimRight(string(log), "\n"), "\n")
+		}
+
+		BeforeEach(func() {
+			binDir, _ = ioutil.TempDir("", "fake-cf")
+			ioutil.WriteFile(path.Join(binDir, "cf"), []byte("#!/bin/sh\necho \"$CF_HOME $@${CF_USERNAME:+ as $CF_USERNAME:$CF_PASSWORD}\" >> "+path.Join(binDir, "calls")+"\necho OK\necho org:\necho App started\n"), 0755)
+			oldPath = os.Getenv("PATH")
+			os.Setenv("PATH", binDir+":"+oldPath)
+
+			ctx = context.New()
+			PopulateRestContext("https://api.example.com", "user1,user2", "pass1,pass2", "dev", ctx)
+			PopulateCfLoginContext("pats-org", ctx)
+			ctx.PutInt("workerIndex", 1)
+		})
+
+		AfterEach(func() {
+			os.Setenv("PATH", oldPath)
+			os.RemoveAll(binDir)
+		})
+
+		It("logs in with the worker's credentials in a CF_HOME of its own", func() {
+			Ω(CfLogin(ctx)).Should(BeNil())
+
+			home, _ := ctx.GetString("cf:home")
+			Ω(home).ShouldNot(BeEmpty())
+			defer os.RemoveAll(home)
+			Ω(calls()).Should(Equal([]string{
+				home + " api https://api.example.com",
+				home + " auth as user2:pass2",
+				home + " target -o pats-org -s dev",
+			}))
+		})
+
+		It("runs the worker's later cf steps in its CF_HOME", func() {
+			CfLogin(ctx)
+			home, _ := ctx.GetString("cf:home")
+			defer os.RemoveAll(home)
+
+			Ω(Push(ctx)).Should(BeNil())
+			Ω(calls()[3]).Should(HavePrefix(home + " push pats-"))
+		})
+
+		It("removes the CF_HOME on logout", func() {
+			CfLogin(ctx)
+			home, _ := ctx.GetString("cf:home")
+
+			Ω(CfLogout(ctx)).Should(BeNil())
+			Ω(calls()[3]).Should(Equal(home + " logout"))
+			_, err := os.Stat(home)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("uses the global cf config without cf:login", func() {
+			Ω(Push(ctx)).Should(BeNil())
+			Ω(calls()[0]).Should(HavePrefix(" push pats-"))
+		})
+	})
 })
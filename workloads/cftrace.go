@@ -0,0 +1,234 @@
+package workloads
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+const DefaultCfTraceDir = "output/traces"
+
+var (
+	bitsPath      = regexp.MustCompile(`^/v2/apps/[^/]+/bits$`)
+	jobPath       = regexp.MustCompile(`^/v2/jobs/[^/]+$`)
+	appPath       = regexp.MustCompile(`^/v2/apps/[^/]+$`)
+	instancesPath = regexp.MustCompile(`^/v2/apps/[^/]+/instances$`)
+)
+
+// CfError is a failed CF command-line step, described by the Cloud
+// Controller's error if the trace has one, or else by the command's output
+type CfError struct {
+	Command     string
+	ErrorCode   string
+	Description string
+	Trace       string
+}
+
+func (e CfError) Error() string {
+	message := "cf " + e.Command + " failed"
+	if e.ErrorCode != "" {
+		message += ": " + e.ErrorCode
+	}
+	if e.Description != "" {
+		message += ": " + e.Description
+	}
+	if e.Trace != "" {
+		message += " (trace: " + e.Trace + ")"
+	}
+	return message
+}
+
+// traceExchange is one request and response in a CF_TRACE file
+type traceExchange struct {
+	Method    string
+	Path      string
+	Requested time.Time
+	Responded time.Time
+	Status    int
+	Body      string
+}
+
+func PopulateCfTraceContext(dir string, ctx context.Context) {
+	ctx.PutString("cf:trace-dir", dir)
+}
+
+// cfTracePath is the file the CF command-line traces the current iteration's
+// requests to, or "" if tracing is off
+func cfTracePath(ctx context.Context) string {
+	dir, _ := ctx.GetString("cf:trace-dir")
+	if dir == "" {
+		return ""
+	}
+
+	name := make([]string, 0)
+	if worker, ok := ctx.GetInt("workerIndex"); ok {
+		name = append(name, fmt.Sprintf("worker-%d", worker))
+	}
+	if iteration, ok := ctx.GetInt("iterationIndex"); ok {
+		name = append(name, fmt.Sprintf("iteration-%d", iteration))
+	}
+	if len(name) == 0 {
+		name = append(name, "pat")
+	}
+
+	experimentGuid, _ := ctx.GetString("experimentGuid")
+	return path.Join(dir, experimentGuid, strings.Join(name, "-")+".trace")
+}
+
+// readCfTrace parses what the CF command-line added to the trace after offset
+func readCfTrace(trace string, offset int64) []traceExchange {
+	if trace == "" {
+		return nil
+	}
+
+	f, err := os.Open(trace)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, 0); err != nil {
+		return nil
+	}
+	return parseCfTrace(f)
+}
+
+func parseCfTrace(trace io.Reader) []traceExchange {
+	exchanges := make([]traceExchange, 0)
+	var current *traceExchange
+	var body *bytes.Buffer
+
+	scanner := bufio.NewScanner(trace)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, "REQUEST: ["):
+			exchanges = append(exchanges, traceExchange{Requested: traceTime(line)})
+			current = &exchanges[len(exchanges)-1]
+			if scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) >= 2 {
+					current.Method = fields[0]
+					current.Path = strings.SplitN(fields[1], "?", 2)[0]
+				}
+			}
+			body = nil
+		case strings.HasPrefix(line, "RESPONSE: [") && current != nil:
+			current.Responded = traceTime(line)
+			if scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) >= 2 {
+					current.Status, _ = strconv.Atoi(fields[1])
+				}
+			}
+			body = nil
+		case line == "" && current != nil && !current.Responded.IsZero() && body == nil:
+			body = &bytes.Buffer{}
+		case body != nil:
+			body.WriteString(line + "\n")
+			current.Body = strings.TrimSpace(body.String())
+		}
+	}
+	return exchanges
+}
+
+func traceTime(line string) time.Time {
+	start := strings.Index(line, "[")
+	end := strings.Index(line, "]")
+	if start < 0 || end < start {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, line[start+1:end])
+	return t
+}
+
+// recordCfPhases reports the upload, staging and starting of an app pushed
+// by the CF command-line as phases of the step, timed from the trace
+func recordCfPhases(ctx context.Context, exchanges []traceExchange) {
+	uploaded := 0
+	for i, e := range exchanges {
+		if e.Method == "PUT" && bitsPath.MatchString(e.Path) {
+			end := i
+			for end+1 < len(exchanges) && exchanges[end+1].Method == "GET" && jobPath.MatchString(exchanges[end+1].Path) {
+				end++
+			}
+			recordPhase(ctx, "upload", exchanges[end].Responded.Sub(e.Requested))
+			uploaded = end + 1
+			break
+		}
+	}
+
+	started := -1
+	for i := uploaded; i < len(exchanges); i++ {
+		if exchanges[i].Method == "GET" && instancesPath.MatchString(exchanges[i].Path) && exchanges[i].Status == 200 {
+			started = i
+			break
+		}
+	}
+	if started < 0 {
+		return
+	}
+
+	for i := started - 1; i >= uploaded; i-- {
+		if exchanges[i].Method == "PUT" && appPath.MatchString(exchanges[i].Path) {
+			recordPhase(ctx, "staging", exchanges[started].Requested.Sub(exchanges[i].Requested))
+			break
+		}
+	}
+
+	last := started
+	for i := started; i < len(exchanges); i++ {
+		if instancesPath.MatchString(exchanges[i].Path) {
+			last = i
+		}
+	}
+	recordPhase(ctx, "starting", exchanges[last].Responded.Sub(exchanges[started].Requested))
+}
+
+// cfError describes a failed command by the last error the Cloud Controller
+// returned, falling back to what the command printed after FAILED
+func cfError(command string, output []byte, err error, exchanges []traceExchange, trace string) error {
+	cfErr := CfError{Command: command, Trace: trace}
+
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		if exchanges[i].Status < 400 {
+			continue
+		}
+
+		var body struct {
+			Description string `json:"description"`
+			ErrorCode   string `json:"error_code"`
+		}
+		if json.Unmarshal([]byte(exchanges[i].Body), &body) != nil || body.Description == "" && body.ErrorCode == "" {
+			break
+		}
+		if body.ErrorCode == "CF-NotStaged" {
+			// the command-line polls instances until staging is done
+			continue
+		}
+		cfErr.ErrorCode = body.ErrorCode
+		cfErr.Description = body.Description
+		return cfErr
+	}
+
+	text := strings.TrimSpace(string(output))
+	if i := strings.LastIndex(text, "FAILED\n"); i >= 0 {
+		text = strings.TrimSpace(text[i+len("FAILED\n"):])
+	}
+	if text == "" && err != nil {
+		text = err.Error()
+	}
+	cfErr.Description = text
+	return cfErr
+}
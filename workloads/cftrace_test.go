@@ -0,0 +1,191 @@
+package workloads_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const pushTrace = `
+REQUEST: [2015-06-01T10:00:00Z]
+PUT /v2/apps/APP-GUID HTTP/1.1
+Host: api.example.com
+
+RESPONSE: [2015-06-01T10:00:00Z]
+HTTP/1.1 201 Created
+Content-Type: application/json
+
+{"metadata": {"guid": "APP-GUID"}}
+
+REQUEST: [2015-06-01T10:00:01Z]
+PUT /v2/apps/APP-GUID/bits?async=true HTTP/1.1
+
+[MULTIPART/FORM-DATA CONTENT HIDDEN]
+
+RESPONSE: [2015-06-01T10:00:03Z]
+HTTP/1.1 201 Created
+
+{"metadata": {"guid": "JOB-GUID"}}
+
+REQUEST: [2015-06-01T10:00:03Z]
+GET /v2/jobs/JOB-GUID HTTP/1.1
+
+RESPONSE: [2015-06-01T10:00:05Z]
+HTTP/1.1 200 OK
+
+{"entity": {"status": "finished"}}
+
+REQUEST: [2015-06-01T10:00:06Z]
+PUT /v2/apps/APP-GUID?async=true HTTP/1.1
+
+{"state":"STARTED"}
+
+RESPONSE: [2015-06-01T10:00:06Z]
+HTTP/1.1 201 Created
+
+REQUEST: [2015-06-01T10:00:08Z]
+GET /v2/apps/APP-GUID/instances HTTP/1.1
+
+RESPONSE: [2015-06-01T10:00:08Z]
+HTTP/1.1 400 Bad Request
+
+{"code": 170002, "description": "App has not finished staging", "error_code": "CF-NotStaged"}
+
+REQUEST: [2015-06-01T10:00:16Z]
+GET /v2/apps/APP-GUID/instances HTTP/1.1
+
+RESPONSE: [2015-06-01T10:00:16Z]
+HTTP/1.1 200 OK
+
+{"0": {"state": "STARTING"}}
+
+REQUEST: [2015-06-01T10:00:19Z]
+GET /v2/apps/APP-GUID/instances HTTP/1.1
+
+RESPONSE: [2015-06-01T10:00:20Z]
+HTTP/1.1 200 OK
+
+{"0": {"state": "RUNNING"}}
+`
+
+const failedPushTrace = `
+REQUEST: [2015-06-01T10:00:00Z]
+POST /v2/apps HTTP/1.1
+
+{"name":"pats-app","memory":4096}
+
+RESPONSE: [2015-06-01T10:00:01Z]
+HTTP/1.1 400 Bad Request
+Content-Type: application/json
+
+{
+  "code": 100005,
+  "description": "You have exceeded your organization's memory limit.",
+  "error_code": "CF-AppMemoryQuotaExceeded"
+}
+`
+
+var _ = Describe("Tracing the CF command-line", func() {
+	var (
+		binDir   string
+		traceDir string
+		oldPath  string
+		ctx      context.Context
+	)
+
+	fakeCf := func(trace string, output string, status string) {
+		ioutil.WriteFile(path.Join(binDir, "trace"), []byte(trace), 0644)
+		ioutil.WriteFile(path.Join(binDir, "cf"), []byte("#!/bin/sh\n"+
+			"[ -n \"$CF_TRACE\" ] && cat "+path.Join(binDir, "trace")+" >> \"$CF_TRACE\"\n"+
+			"printf '"+output+"'\nexit "+status+"\n"), 0755)
+	}
+
+	BeforeEach(func() {
+		binDir, _ = ioutil.TempDir("", "fake-cf")
+		traceDir, _ = ioutil.TempDir("", "traces")
+		oldPath = os.Getenv("PATH")
+		os.Setenv("PATH", binDir+":"+oldPath)
+
+		ctx = context.New()
+		PopulateCfTraceContext(traceDir, ctx)
+		ctx.PutString("experimentGuid", "EXPERIMENT-GUID")
+		ctx.PutInt("workerIndex", 1)
+		ctx.PutInt("iterationIndex", 7)
+		TakePhases(ctx)
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(binDir)
+		os.RemoveAll(traceDir)
+	})
+
+	It("reports the upload, staging and starting of a push as phases", func() {
+		fakeCf(pushTrace, "App started\\n", "0")
+		Ω(Push(ctx)).Should(BeNil())
+
+		Ω(TakePhases(ctx)).Should(Equal([]Phase{
+			{"upload", 4 * time.Second},
+			{"staging", 10 * time.Second},
+			{"starting", 4 * time.Second},
+		}))
+	})
+
+	It("removes the trace of a successful step", func() {
+		fakeCf(pushTrace, "App started\\n", "0")
+		Push(ctx)
+
+		files, _ := ioutil.ReadDir(path.Join(traceDir, "EXPERIMENT-GUID"))
+		Ω(files).Should(BeEmpty())
+	})
+
+	Context("when the command fails", func() {
+		var err error
+
+		BeforeEach(func() {
+			fakeCf(failedPushTrace, "Creating app pats-app...\\nFAILED\\nServer error, status code: 400\\n", "1")
+			err = Push(ctx)
+		})
+
+		It("returns the Cloud Controller's error", func() {
+			Ω(err).Should(HaveOccurred())
+			cfErr, ok := err.(CfError)
+			Ω(ok).Should(BeTrue())
+			Ω(cfErr.Command).Should(Equal("push"))
+			Ω(cfErr.ErrorCode).Should(Equal("CF-AppMemoryQuotaExceeded"))
+			Ω(cfErr.Description).Should(Equal("You have exceeded your organization's memory limit."))
+		})
+
+		It("keeps the iteration's trace and gives its path in the error", func() {
+			trace := path.Join(traceDir, "EXPERIMENT-GUID", "worker-1-iteration-7.trace")
+			Ω(err.Error()).Should(ContainSubstring("(trace: " + trace + ")"))
+
+			contents, _ := ioutil.ReadFile(trace)
+			Ω(string(contents)).Should(ContainSubstring("CF-AppMemoryQuotaExceeded"))
+		})
+
+		It("keeps the trace when later steps of the worker succeed", func() {
+			fakeCf(pushTrace, "OK\\n", "0")
+			ctx.PutString("cf:home", path.Join(binDir, "home"))
+			CfLogout(ctx)
+
+			contents, _ := ioutil.ReadFile(path.Join(traceDir, "EXPERIMENT-GUID", "worker-1-iteration-7.trace"))
+			Ω(string(contents)).Should(Equal(failedPushTrace))
+		})
+	})
+
+	It("falls back to the command's output without a trace", func() {
+		PopulateCfTraceContext("", ctx)
+		fakeCf("", "FAILED\\nNo space targeted\\n", "1")
+
+		err := Push(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal("cf push failed: No space targeted"))
+	})
+})
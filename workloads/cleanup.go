@@ -0,0 +1,127 @@
+package workloads
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+var cleanupOrder = []string{LedgerServiceBinding, LedgerRoute, LedgerRestApp, LedgerServiceInstance, LedgerCfApp}
+
+var restCleanupUris = map[string]string{
+	LedgerServiceBinding:  "%s/v2/service_bindings/%s",
+	LedgerRoute:           "%s/v2/routes/%s",
+	LedgerRestApp:         "%s/v2/apps/%s?recursive=true",
+	LedgerServiceInstance: "%s/v2/service_instances/%s?recursive=true&accepts_incomplete=true",
+}
+
+var CfDeleteApp = func(ctx context.Context, appName string) error {
+	return expectCfToSay(ctx, "Deleting app", "delete", appName, "-f")
+}
+
+// Cleanup deletes every resource still in the experiment's ledger, logging in
+// to the REST api, and the CF command-line, as the worker that created each
+// one, and removes the ones that are gone so that it can be retried until the
+// ledger is empty. Apps generated for the experiment on this machine are
+// removed too; those are never in the ledger, which is shared with redis slaves
+func (r *rest) Cleanup(ctx context.Context, experimentGuid string) error {
+	RemoveGeneratedApps(experimentGuid)
+
+	dir, _ := ctx.GetString("ledger:dir")
+	entries, err := LedgerEntries(dir, experimentGuid)
+	if err != nil {
+		return err
+	}
+
+	workerContexts := make(map[int]context.Context)
+	cfContexts := make(map[int]context.Context)
+	defer func() {
+		for _, cfCtx := range cfContexts {
+			CfLogout(cfCtx)
+		}
+	}()
+
+	var lastErr error
+	for _, kind := range cleanupOrder {
+		for _, entry := range entries {
+			if entry.Kind != kind {
+				continue
+			}
+
+			var err error
+			if entry.Kind == LedgerCfApp {
+				err = deleteCfApp(ctx, cfContexts, entry)
+			} else {
+				err = r.deleteResource(ctx, workerContexts, entry)
+			}
+			if err == nil {
+				entry.Removed = true
+				err = appendToLedger(dir, experimentGuid, entry)
+			}
+			if err != nil {
+				lastErr = fmt.Errorf("Could not clean up %s %s: %v", entry.Kind, entry.Id, err)
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// deleteCfApp deletes an app pushed by cf:push in a CF_HOME logged in as the
+// worker that pushed it; without a rest:target to log in to, the global cf
+// config is used
+func deleteCfApp(ctx context.Context, cfContexts map[int]context.Context, entry LedgerEntry) error {
+	if target, _ := ctx.GetString("rest:target"); target == "" {
+		return CfDeleteApp(ctx, entry.Id)
+	}
+
+	cfCtx, ok := cfContexts[entry.Worker]
+	if !ok {
+		cfCtx = ctx.Clone()
+		cfCtx.PutInt("workerIndex", entry.Worker)
+		if err := CfLogin(cfCtx); err != nil {
+			CfLogout(cfCtx)
+			return err
+		}
+		cfContexts[entry.Worker] = cfCtx
+	}
+
+	return CfDeleteApp(cfCtx, entry.Id)
+}
+
+func (r *rest) deleteResource(ctx context.Context, workerContexts map[int]context.Context, entry LedgerEntry) error {
+
+	uri, ok := restCleanupUris[entry.Kind]
+	if !ok {
+		return fmt.Errorf("unknown resource kind")
+	}
+
+	workerCtx, ok := workerContexts[entry.Worker]
+	if !ok {
+		workerCtx = ctx.Clone()
+		workerCtx.PutInt("workerIndex", entry.Worker)
+		if err := r.Target(workerCtx); err != nil {
+			return err
+		}
+		if err := r.requestToken(workerCtx, r.grantInputs(workerCtx)); err != nil {
+			return err
+		}
+		workerContexts[entry.Worker] = workerCtx
+	}
+
+	apiEndpoint, _ := workerCtx.GetString("apiEndpoint")
+	return r.checkLoggedIn(workerCtx, func(r *rest, token string) error {
+		err := r.DeleteSuccessfully(token, fmt.Sprintf(uri, apiEndpoint, entry.Id), nil, nil, func(reply Reply) error {
+			return nil
+		})
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(httpError)
+	return ok && e.Code == 404
+}
@@ -0,0 +1,195 @@
+package workloads_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cleaning up after an experiment", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+		dir     string
+	)
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "ledger")
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		PopulateRestContext("APISERVER", "user1,user2", "pass1,pass2", "dev", ctx)
+		PopulateLedgerContext(dir, ctx)
+		ctx.PutString("experimentGuid", "EXPERIMENT-GUID")
+		ctx.PutString("token", "TOKEN")
+		ctx.PutString("apiEndpoint", "APISERVER")
+		ctx.PutInt("workerIndex", 1)
+
+		replies["APISERVER/v2/info"] = TargetResponse{LoginEndpoint: "LOGINSERVER", UaaEndpoint: "UAASERVER"}
+		replies["LOGINSERVER/oauth/token"] = LoginResponse{Token: "WORKER-TOKEN"}
+		replies["APISERVER/v2/routes"] = Resource{Metadata{"ROUTE-GUID"}}
+		replies["APISERVER/v2/shared_domains?q=name:example.com"] = DomainsResponse{[]Resource{Resource{Metadata{"DOMAIN-GUID"}}}}
+		PopulateRouteContext("example.com", 1, ctx)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("records the resources a workload creates in the experiment's ledger", func() {
+		err := NewRestWorkloadWithClient(client).CreateRoute(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		entries, err := LedgerEntries(dir, "EXPERIMENT-GUID")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(Equal([]LedgerEntry{{Kind: LedgerRoute, Id: "ROUTE-GUID", Worker: 1}}))
+	})
+
+	It("forgets resources once the workload deletes them", func() {
+		replies["APISERVER/v2/routes/ROUTE-GUID"] = ""
+		NewRestWorkloadWithClient(client).CreateRoute(ctx)
+		err := NewRestWorkloadWithClient(client).DeleteRoute(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		entries, _ := LedgerEntries(dir, "EXPERIMENT-GUID")
+		Ω(entries).Should(BeEmpty())
+	})
+
+	It("does not record anything without a ledger directory", func() {
+		PopulateLedgerContext("", ctx)
+		NewRestWorkloadWithClient(client).CreateRoute(ctx)
+
+		files, _ := ioutil.ReadDir(dir)
+		Ω(files).Should(BeEmpty())
+	})
+
+	It("keeps the entries in the context when the ledger is deferred, until they are taken and recorded", func() {
+		DeferLedger(ctx)
+		NewRestWorkloadWithClient(client).CreateRoute(ctx)
+
+		files, _ := ioutil.ReadDir(dir)
+		Ω(files).Should(BeEmpty())
+
+		deferred := TakeDeferredLedger(ctx)
+		Ω(deferred).Should(Equal([]LedgerEntry{{Kind: LedgerRoute, Id: "ROUTE-GUID", Worker: 1}}))
+		Ω(TakeDeferredLedger(ctx)).Should(BeEmpty())
+
+		RecordLedgerEntries(ctx, deferred)
+		NewRestWorkloadWithClient(client).CreateRoute(ctx)
+		entries, _ := LedgerEntries(dir, "EXPERIMENT-GUID")
+		Ω(entries).Should(Equal(append(deferred, deferred...)))
+	})
+
+	Describe("Cleanup", func() {
+		var (
+			deletedCfApps  []string
+			oldCfDeleteApp func(context.Context, string) error
+		)
+
+		BeforeEach(func() {
+			deletedCfApps = make([]string, 0)
+			oldCfDeleteApp = CfDeleteApp
+			CfDeleteApp = func(ctx context.Context, appName string) error {
+				deletedCfApps = append(deletedCfApps, appName)
+				return nil
+			}
+
+			NewRestWorkloadWithClient(client).CreateRoute(ctx)
+		})
+
+		AfterEach(func() {
+			CfDeleteApp = oldCfDeleteApp
+		})
+
+		It("deletes the remaining resources as the worker that created them and empties the ledger", func() {
+			replies["APISERVER/v2/routes/ROUTE-GUID"] = ""
+			err := NewRestWorkloadWithClient(client).Cleanup(ctx, "EXPERIMENT-GUID")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/routes/ROUTE-GUID")
+			login := client.ShouldHaveBeenCalledWith("POST(uaa)", "LOGINSERVER/oauth/token")
+			Ω(login).Should(HaveKeyWithValue("username", []string{"user2"}))
+
+			entries, _ := LedgerEntries(dir, "EXPERIMENT-GUID")
+			Ω(entries).Should(BeEmpty())
+		})
+
+		It("keeps resources it could not delete so that cleanup can be retried", func() {
+			err := NewRestWorkloadWithClient(client).Cleanup(ctx, "EXPERIMENT-GUID")
+			Ω(err).Should(HaveOccurred())
+
+			entries, _ := LedgerEntries(dir, "EXPERIMENT-GUID")
+			Ω(entries).Should(HaveLen(1))
+		})
+
+		It("does not record generated apps in the ledger, which is shared with redis slaves", func() {
+			PopulateGeneratorContext("staticfile", 0, 0, ctx)
+			Ω(Generate(ctx)).Should(BeNil())
+			generated, _ := ctx.GetString("app")
+			defer os.RemoveAll(generated)
+
+			entries, _ := LedgerEntries(dir, "EXPERIMENT-GUID")
+			Ω(entries).Should(Equal([]LedgerEntry{{Kind: LedgerRoute, Id: "ROUTE-GUID", Worker: 1}}))
+		})
+
+		It("removes the app each worker generated last on this machine", func() {
+			replies["APISERVER/v2/routes/ROUTE-GUID"] = ""
+			PopulateGeneratorContext("staticfile", 0, 0, ctx)
+			Ω(Generate(ctx)).Should(BeNil())
+			generated, _ := ctx.GetString("app")
+
+			err := NewRestWorkloadWithClient(client).Cleanup(ctx, "EXPERIMENT-GUID")
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = os.Stat(generated)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("deletes cf apps logged in to the cf CLI as the worker that pushed them", func() {
+			replies["APISERVER/v2/routes/ROUTE-GUID"] = ""
+			binDir, _ := ioutil.TempDir("", "fake-cf")
+			defer os.RemoveAll(binDir)
+			ioutil.WriteFile(path.Join(binDir, "cf"), []byte("#!/bin/sh\necho \"$CF_HOME $@${CF_USERNAME:+ as $CF_USERNAME}\" >> "+path.Join(binDir, "calls")+"\necho OK\necho org:\n"), 0755)
+			oldPath := os.Getenv("PATH")
+			os.Setenv("PATH", binDir+":"+oldPath)
+			defer os.Setenv("PATH", oldPath)
+
+			homes := make(map[string]string)
+			CfDeleteApp = func(ctx context.Context, appName string) error {
+				homes[appName], _ = ctx.GetString("cf:home")
+				return nil
+			}
+			RecordLedgerEntries(ctx, []LedgerEntry{{Kind: LedgerCfApp, Id: "pats-app-0", Worker: 0}, {Kind: LedgerCfApp, Id: "pats-app-1", Worker: 1}})
+
+			err := NewRestWorkloadWithClient(client).Cleanup(ctx, "EXPERIMENT-GUID")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(homes["pats-app-0"]).ShouldNot(BeEmpty())
+			Ω(homes["pats-app-1"]).ShouldNot(BeEmpty())
+			Ω(homes["pats-app-0"]).ShouldNot(Equal(homes["pats-app-1"]))
+
+			log, _ := ioutil.ReadFile(path.Join(binDir, "calls"))
+			calls := string(log)
+			Ω(calls).Should(ContainSubstring(homes["pats-app-0"] + " auth as user1"))
+			Ω(calls).Should(ContainSubstring(homes["pats-app-1"] + " auth as user2"))
+			Ω(strings.Count(calls, " logout")).Should(Equal(2))
+			_, err = os.Stat(homes["pats-app-0"])
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+
+			entries, _ := LedgerEntries(dir, "EXPERIMENT-GUID")
+			Ω(entries).Should(BeEmpty())
+		})
+
+		It("deletes cf apps with the cf CLI", func() {
+			ctx.PutString("appNames", "pats-app")
+			err := Delete(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deletedCfApps).Should(Equal([]string{"pats-app"}))
+		})
+	})
+})
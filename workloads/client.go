@@ -2,6 +2,7 @@ package workloads
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -9,16 +10,21 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/pat/logs"
 )
 
 type httpclient interface {
+	Request(method string, url string, headers http.Header, data io.Reader, timeout time.Duration, responseBody interface{}) (reply Reply)
 	Get(token string, url string, data interface{}, responseBody interface{}) (reply Reply)
 	Put(token string, url string, data interface{}, responseBody interface{}) (reply Reply)
 	MultipartPut(token string, m *multipart.Writer, url string, data *bytes.Buffer, responseBody interface{}) (reply Reply)
 	Post(token string, url string, data interface{}, responseBody interface{}) (reply Reply)
-	PostToUaa(url string, data url.Values, responseBody interface{}) (reply Reply)
+	Delete(token string, url string, data interface{}, responseBody interface{}) (reply Reply)
+	Patch(token string, url string, data interface{}, responseBody interface{}) (reply Reply)
+	MultipartPost(token string, m *multipart.Writer, url string, data *bytes.Buffer, responseBody interface{}) (reply Reply)
+	PostToUaa(url string, clientId string, clientSecret string, data url.Values, responseBody interface{}) (reply Reply)
 }
 
 type Reply struct {
@@ -29,6 +35,14 @@ type Reply struct {
 
 const TRACE_REST_CALLS = true
 
+// RequestTimeout is the longest a request to an app, or another endpoint
+// outside the Cloud Controller, may take, unless its step has less time left
+var RequestTimeout = 60 * time.Second
+
+func (client rest) Request(method string, url string, headers http.Header, data io.Reader, timeout time.Duration, body interface{}) Reply {
+	return client.do(method, url, headers, data, timeout, body)
+}
+
 func (client rest) Post(token string, url string, data interface{}, body interface{}) Reply {
 	return client.req(token, "POST", url, "", "", "", jsonToString(data), body)
 }
@@ -45,8 +59,20 @@ func (client rest) Get(token string, url string, data interface{}, body interfac
 	return client.req(token, "GET", url, "", "", "", jsonToString(data), body)
 }
 
-func (client rest) PostToUaa(url string, data url.Values, reply interface{}) Reply {
-	return client.req("", "POST", url, "application/x-www-form-urlencoded", "cf", "", strings.NewReader(data.Encode()), reply)
+func (client rest) Delete(token string, url string, data interface{}, body interface{}) Reply {
+	return client.req(token, "DELETE", url, "", "", "", jsonToString(data), body)
+}
+
+func (client rest) Patch(token string, url string, data interface{}, body interface{}) Reply {
+	return client.req(token, "PATCH", url, "", "", "", jsonToString(data), body)
+}
+
+func (client rest) MultipartPost(token string, m *multipart.Writer, url string, data *bytes.Buffer, body interface{}) Reply {
+	return client.req(token, "POST", url, m.FormDataContentType(), "", "", data, body)
+}
+
+func (client rest) PostToUaa(url string, clientId string, clientSecret string, data url.Values, reply interface{}) Reply {
+	return client.req("", "POST", url, "application/x-www-form-urlencoded", clientId, clientSecret, strings.NewReader(data.Encode()), reply)
 }
 
 func (context *rest) GetSuccessfully(token string, url string, data url.Values, responseBody interface{}, fn func(reply Reply) error) error {
@@ -77,39 +103,83 @@ func (context *rest) PostSuccessfully(token string, url string, data interface{}
 	})
 }
 
-func (context *rest) PostToUaaSuccessfully(url string, data url.Values, responseBody interface{}, fn func(reply Reply) error) error {
-	reply := context.client.PostToUaa(url, data, responseBody)
+func (context *rest) DeleteSuccessfully(token string, url string, data interface{}, responseBody interface{}, fn func(reply Reply) error) error {
+	reply := context.client.Delete(token, url, data, responseBody)
+	return checkSuccessfulReply(reply, func() error {
+		return fn(reply)
+	})
+}
+
+func (context *rest) PatchSuccessfully(token string, url string, data interface{}, responseBody interface{}, fn func(reply Reply) error) error {
+	reply := context.client.Patch(token, url, data, responseBody)
+	return checkSuccessfulReply(reply, func() error {
+		return fn(reply)
+	})
+}
+
+func (context *rest) MultipartPostSuccessfully(token string, m *multipart.Writer, url string, data *bytes.Buffer, responseBody interface{}, fn func(reply Reply) error) error {
+	reply := context.client.MultipartPost(token, m, url, data, responseBody)
+	return checkSuccessfulReply(reply, func() error {
+		return fn(reply)
+	})
+}
+
+func (context *rest) PostToUaaSuccessfully(url string, clientId string, clientSecret string, data url.Values, responseBody interface{}, fn func(reply Reply) error) error {
+	reply := context.client.PostToUaa(url, clientId, clientSecret, data, responseBody)
 	return checkSuccessfulReply(reply, func() error {
 		return fn(reply)
 	})
 }
 
+// requestTimeout is RequestTimeout, or less if the step has less time left
+// before its deadline, but at least a second
+func requestTimeout(deadline time.Time) time.Duration {
+	timeout := deadline.Sub(time.Now())
+	if timeout > RequestTimeout {
+		return RequestTimeout
+	}
+	if timeout < time.Second {
+		return time.Second
+	}
+	return timeout
+}
+
 func jsonToString(data interface{}) io.Reader {
 	j, _ := json.Marshal(data)
 	return strings.NewReader(string(j))
 }
 
 func (client rest) req(token string, method string, url string, contentType string, authUser string, authPassword string, data io.Reader, reply interface{}) Reply {
-	req, err := http.NewRequest(method, url, data)
-	if err != nil {
-		return Reply{0, err.Error(), ""}
-	}
-
+	headers := make(http.Header)
 	if authUser != "" {
-		req.SetBasicAuth(authUser, authPassword)
+		headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(authUser+":"+authPassword)))
 	} else {
-		req.Header.Set("Authorization", "bearer "+token)
+		headers.Set("Authorization", "bearer "+token)
 	}
 
 	if contentType != "" {
-		req.Header.Set("Content-Type", contentType)
+		headers.Set("Content-Type", contentType)
 	}
 
-	c := &http.Client{}
+	return client.do(method, url, headers, data, 0, reply)
+}
+
+func (client rest) do(method string, url string, headers http.Header, data io.Reader, timeout time.Duration, reply interface{}) Reply {
+	req, err := http.NewRequest(method, url, data)
+	if err != nil {
+		return Reply{0, err.Error(), ""}
+	}
+
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	c := &http.Client{Timeout: timeout}
 	resp, err := c.Do(req)
 	if err != nil {
 		return Reply{0, err.Error(), ""}
 	}
+	defer resp.Body.Close()
 
 	var logger = logs.NewLogger("workloads.rest")
 
@@ -121,7 +191,11 @@ func (client rest) req(token string, method string, url string, contentType stri
 		logger.Debug1f(">> %s", body)
 	}
 
-	json.Unmarshal(resp_body, &reply)
+	if raw, ok := reply.(*[]byte); ok {
+		*raw = resp_body
+	} else {
+		json.Unmarshal(resp_body, &reply)
+	}
 	logger.Debug1f("%s %s %s", method, url, resp.Status)
 	return Reply{resp.StatusCode, resp.Status, resp.Header.Get("Location")}
 }
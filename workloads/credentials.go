@@ -0,0 +1,105 @@
+package workloads
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"launchpad.net/goyaml"
+)
+
+type Credential struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// LoadCredentials reads users from a CSV file of username,password rows or a
+// YAML list of username/password maps, chosen by the file's extension
+func LoadCredentials(path string) ([]Credential, error) {
+	var credentials []Credential
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		credentials, err = loadCsvCredentials(path)
+	case ".yml", ".yaml":
+		credentials, err = loadYamlCredentials(path)
+	default:
+		return nil, fmt.Errorf("Unknown credentials file type '%s', expected .csv, .yml or .yaml", path)
+	}
+
+	if err == nil && len(credentials) == 0 {
+		err = fmt.Errorf("No credentials found in '%s'", path)
+	}
+	return credentials, err
+}
+
+func loadCsvCredentials(path string) ([]Credential, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]Credential, 0, len(rows))
+	for i, row := range rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("Expected username,password on line %d of '%s'", i+1, path)
+		}
+		if i == 0 && row[0] == "username" && row[1] == "password" {
+			continue
+		}
+		credentials = append(credentials, Credential{row[0], row[1]})
+	}
+	return credentials, nil
+}
+
+func loadYamlCredentials(path string) ([]Credential, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]Credential, 0)
+	err = goyaml.Unmarshal(contents, &credentials)
+	return credentials, err
+}
+
+func PopulateCredentialsContext(credentials []Credential, ctx context.Context) {
+	encoded, _ := json.Marshal(credentials)
+	ctx.PutString("rest:credentials", string(encoded))
+}
+
+// credentialsForWorker gives each virtual worker the same user for all of its
+// iterations, cycling through the users when there are more workers than users
+func credentialsForWorker(ctx context.Context) (string, string) {
+	index, ok := ctx.GetInt("workerIndex")
+	if !ok {
+		index, _ = ctx.GetInt("iterationIndex")
+	}
+
+	if encoded, _ := ctx.GetString("rest:credentials"); encoded != "" {
+		var credentials []Credential
+		json.Unmarshal([]byte(encoded), &credentials)
+		if len(credentials) > 0 {
+			credential := credentials[index%len(credentials)]
+			return credential.Username, credential.Password
+		}
+	}
+
+	users, _ := ctx.GetString("rest:username")
+	passwords, _ := ctx.GetString("rest:password")
+	var userList = strings.Split(users, ",")
+	var passList = strings.Split(passwords, ",")
+	return userList[index%len(userList)], passList[index%len(passList)]
+}
@@ -0,0 +1,95 @@
+package workloads_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credentials", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "pat-credentials")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Loading credentials", func() {
+		It("reads a CSV file, skipping a header row", func() {
+			path := filepath.Join(dir, "users.csv")
+			ioutil.WriteFile(path, []byte("username,password\nuser1,pass1\nuser2,\"pass,2\"\n"), 0600)
+
+			credentials, err := LoadCredentials(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(Equal([]Credential{{"user1", "pass1"}, {"user2", "pass,2"}}))
+		})
+
+		It("reads a YAML file", func() {
+			path := filepath.Join(dir, "users.yml")
+			ioutil.WriteFile(path, []byte("- username: user1\n  password: pass1\n- username: user2\n  password: pass2\n"), 0600)
+
+			credentials, err := LoadCredentials(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(Equal([]Credential{{"user1", "pass1"}, {"user2", "pass2"}}))
+		})
+
+		It("rejects other kinds of file", func() {
+			path := filepath.Join(dir, "users.txt")
+			ioutil.WriteFile(path, []byte("user1 pass1"), 0600)
+
+			_, err := LoadCredentials(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects files without credentials", func() {
+			path := filepath.Join(dir, "users.csv")
+			ioutil.WriteFile(path, []byte("username,password\n"), 0600)
+
+			_, err := LoadCredentials(path)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Logging in with loaded credentials", func() {
+		var (
+			client *dummyClient
+			ctx    context.Context
+		)
+
+		BeforeEach(func() {
+			client = &dummyClient{make(map[string]interface{}), make(map[string]string), make(map[call]interface{})}
+			ctx = context.New()
+			ctx.PutInt("iterationIndex", 5)
+			ctx.PutString("loginEndpoint", "LOGINSERVER")
+			ctx.PutString("apiEndpoint", "APISERVER")
+			PopulateCredentialsContext([]Credential{{"user1", "pass1"}, {"user2", "pass2"}, {"user3", "pass3"}}, ctx)
+		})
+
+		It("uses the same user for every iteration of a worker", func() {
+			ctx.PutInt("workerIndex", 1)
+			for _, iteration := range []int{1, 2, 3} {
+				ctx.PutInt("iterationIndex", iteration)
+				NewRestWorkloadWithClient(client).Login(ctx)
+				data := client.ShouldHaveBeenCalledWith("POST(uaa)", "LOGINSERVER/oauth/token")
+				Ω(data.(url.Values).Get("username")).Should(Equal("user2"))
+				Ω(data.(url.Values).Get("password")).Should(Equal("pass2"))
+			}
+		})
+
+		It("cycles through the users when there are more workers than users", func() {
+			ctx.PutInt("workerIndex", 4)
+			NewRestWorkloadWithClient(client).Login(ctx)
+			data := client.ShouldHaveBeenCalledWith("POST(uaa)", "LOGINSERVER/oauth/token")
+			Ω(data.(url.Values).Get("username")).Should(Equal("user2"))
+		})
+	})
+})
@@ -0,0 +1,95 @@
+package workloads
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay is a distribution of durations: a fixed "200ms", a uniformly
+// distributed "2s±1s" (or "2s+-1s"), or a normally distributed "2s~500ms"
+// (mean and standard deviation); samples are never negative
+type Delay struct {
+	Mean   time.Duration
+	Spread time.Duration
+	Normal bool
+}
+
+func ParseDelay(text string) (Delay, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Delay{}, nil
+	}
+
+	for _, separator := range []string{"±", "+-", "~"} {
+		parts := strings.SplitN(text, separator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		mean, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return Delay{}, fmt.Errorf("Invalid delay '%s': %v", text, err)
+		}
+		spread, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return Delay{}, fmt.Errorf("Invalid delay '%s': %v", text, err)
+		}
+		return Delay{mean, spread, separator == "~"}, nil
+	}
+
+	mean, err := time.ParseDuration(text)
+	if err != nil {
+		return Delay{}, fmt.Errorf("Invalid delay '%s': %v", text, err)
+	}
+	return Delay{Mean: mean}, nil
+}
+
+func (d Delay) Sample(random *rand.Rand) time.Duration {
+	sample := d.Mean
+	if d.Spread > 0 {
+		if d.Normal {
+			sample = sample + time.Duration(random.NormFloat64()*float64(d.Spread))
+		} else {
+			sample = sample + time.Duration((random.Float64()*2-1)*float64(d.Spread))
+		}
+	}
+
+	if sample < 0 {
+		return 0
+	}
+	return sample
+}
+
+func (d Delay) String() string {
+	switch {
+	case d.Spread == 0:
+		return d.Mean.String()
+	case d.Normal:
+		return d.Mean.String() + "~" + d.Spread.String()
+	default:
+		return d.Mean.String() + "±" + d.Spread.String()
+	}
+}
+
+// ParseRate reads a fraction of requests given as a percentage, "10%", or as
+// a number between 0 and 1, "0.1"
+func ParseRate(text string) (float64, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+
+	number, scale := text, 1.0
+	if strings.HasSuffix(text, "%") {
+		number, scale = strings.TrimSuffix(text, "%"), 100
+	}
+
+	rate, err := strconv.ParseFloat(number, 64)
+	if err != nil || rate < 0 || rate/scale > 1 {
+		return 0, fmt.Errorf("Invalid rate '%s', expected a percentage or a number between 0 and 1", text)
+	}
+	return rate / scale, nil
+}
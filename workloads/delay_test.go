@@ -0,0 +1,41 @@
+package workloads_test
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Delays and rates", func() {
+	It("parses fixed, uniform and normal delays", func() {
+		Ω(ParseDelay("200ms")).Should(Equal(Delay{Mean: 200 * time.Millisecond}))
+		Ω(ParseDelay("2s±1s")).Should(Equal(Delay{2 * time.Second, 1 * time.Second, false}))
+		Ω(ParseDelay("2s+-1s")).Should(Equal(Delay{2 * time.Second, 1 * time.Second, false}))
+		Ω(ParseDelay("2s~500ms")).Should(Equal(Delay{2 * time.Second, 500 * time.Millisecond, true}))
+		Ω(ParseDelay("")).Should(Equal(Delay{}))
+
+		_, err := ParseDelay("soon")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("samples within the spread of a uniform delay, never below zero", func() {
+		random := rand.New(rand.NewSource(1))
+		delay := Delay{Mean: 100 * time.Millisecond, Spread: 200 * time.Millisecond}
+		for i := 0; i < 100; i++ {
+			Ω(delay.Sample(random)).Should(BeNumerically(">=", 0))
+			Ω(delay.Sample(random)).Should(BeNumerically("<=", 300*time.Millisecond))
+		}
+	})
+
+	It("parses rates as percentages or fractions", func() {
+		Ω(ParseRate("10%")).Should(Equal(0.1))
+		Ω(ParseRate("0.25")).Should(Equal(0.25))
+		Ω(ParseRate("")).Should(Equal(0.0))
+
+		_, err := ParseRate("150%")
+		Ω(err).Should(HaveOccurred())
+	})
+})
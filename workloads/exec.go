@@ -0,0 +1,106 @@
+package workloads
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+// ExecPrefix marks a workload step that runs an external command, e.g.
+// exec:./scripts/deploy.sh; the rest of the name is the command to run
+const ExecPrefix = "exec:"
+
+func IsExecStep(name string) bool {
+	return strings.HasPrefix(name, ExecPrefix) && len(name) > len(ExecPrefix)
+}
+
+func ExecStep(name string) WorkloadStep {
+	command := strings.TrimPrefix(name, ExecPrefix)
+	return StepWithContext(name, func(ctx context.Context) error {
+		return runExec(command, ctx)
+	}, "Runs "+command+", passing the workload context as JSON on stdin and in PAT_CONTEXT")
+}
+
+// runExec runs the command with the context as JSON on its stdin and in the
+// PAT_CONTEXT environment variable; a JSON object printed on stdout is merged
+// back into the context, and a non-zero exit status fails the step
+func runExec(command string, ctx context.Context) error {
+	encoded, err := ctx.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command)
+	cmd.Stdin = bytes.NewReader(encoded)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "PAT_CONTEXT="+string(encoded))
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s: %v: %s", command, err, message)
+		}
+		return fmt.Errorf("%s: %v", command, err)
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return nil
+	}
+	return mergeExecOutput(command, encoded, output, ctx)
+}
+
+// mergeExecOutput keeps the type of keys already in the context, so a script
+// that echoes the context back leaves booleans and floats readable with
+// GetBool and GetFloat64; new keys are stored as strings, which is how the
+// workloads read context values, numbers included
+func mergeExecOutput(command string, encoded []byte, output []byte, ctx context.Context) error {
+	existing := make(map[string]interface{})
+	if err := json.Unmarshal(encoded, &existing); err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(output, &values); err != nil {
+		return fmt.Errorf("%s did not print a JSON object: %v", command, err)
+	}
+
+	for k, v := range values {
+		var text string
+		switch value := v.(type) {
+		case string:
+			text = value
+		case float64:
+			text = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			text = strconv.FormatBool(value)
+		default:
+			return fmt.Errorf("%s printed an unsupported value for '%s', expected a string, number or boolean", command, k)
+		}
+
+		switch existing[k].(type) {
+		case bool:
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return fmt.Errorf("%s printed '%s' for '%s', expected a boolean", command, text, k)
+			}
+			ctx.PutBool(k, b)
+		case float64:
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return fmt.Errorf("%s printed '%s' for '%s', expected a number", command, text, k)
+			}
+			ctx.PutFloat64(k, f)
+		default:
+			ctx.PutString(k, text)
+		}
+	}
+	return nil
+}
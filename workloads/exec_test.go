@@ -0,0 +1,113 @@
+package workloads_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exec steps", func() {
+	var (
+		dir string
+		ctx context.Context
+	)
+
+	script := func(body string) string {
+		name := path.Join(dir, "step.sh")
+		ioutil.WriteFile(name, []byte("#!/bin/sh\n"+body), 0755)
+		return ExecPrefix + name
+	}
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "exec")
+		ctx = context.New()
+		ctx.PutString("appNames", "pats-app")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("recognises steps by their prefix", func() {
+		Ω(IsExecStep("exec:./deploy.sh")).Should(BeTrue())
+		Ω(IsExecStep("exec:")).Should(BeFalse())
+		Ω(IsExecStep("cf:push")).Should(BeFalse())
+	})
+
+	It("passes the context as JSON on stdin", func() {
+		step := ExecStep(script(`grep -q '"appNames":"pats-app"' || exit 1`))
+		Ω(step.Fn(ctx)).Should(BeNil())
+	})
+
+	It("passes the context in the PAT_CONTEXT environment variable", func() {
+		step := ExecStep(script(`echo "$PAT_CONTEXT" | grep -q pats-app || exit 1`))
+		Ω(step.Fn(ctx)).Should(BeNil())
+	})
+
+	It("merges a JSON object printed on stdout into the context", func() {
+		step := ExecStep(script(`echo '{"deployment": "cf", "vms": 3, "healthy": true}'`))
+		Ω(step.Fn(ctx)).Should(BeNil())
+
+		deployment, _ := ctx.GetString("deployment")
+		Ω(deployment).Should(Equal("cf"))
+		vms, _ := ctx.GetInt("vms")
+		Ω(vms).Should(Equal(3))
+		healthy, _ := ctx.GetString("healthy")
+		Ω(healthy).Should(Equal("true"))
+		appNames, _ := ctx.GetString("appNames")
+		Ω(appNames).Should(Equal("pats-app"))
+	})
+
+	It("stores numbers as strings, which the steps after it can read", func() {
+		step := ExecStep(script(`echo '{"rest:instances": 3, "ratio": 0.5}'`))
+		Ω(step.Fn(ctx)).Should(BeNil())
+
+		instances, _ := ctx.GetInt("rest:instances")
+		Ω(instances).Should(Equal(3))
+		ratio, _ := ctx.GetString("ratio")
+		Ω(ratio).Should(Equal("0.5"))
+	})
+
+	It("keeps the type of values already in the context", func() {
+		ctx.PutBool("rest:resource-matching", true)
+		ctx.PutFloat64("ratio", 0.5)
+		step := ExecStep(script(`cat`))
+		Ω(step.Fn(ctx)).Should(BeNil())
+
+		matching, ok := ctx.GetBool("rest:resource-matching")
+		Ω(ok).Should(BeTrue())
+		Ω(matching).Should(BeTrue())
+		ratio, _ := ctx.GetFloat64("ratio")
+		Ω(ratio).Should(Equal(0.5))
+		appNames, _ := ctx.GetString("appNames")
+		Ω(appNames).Should(Equal("pats-app"))
+	})
+
+	It("fails when it prints a value that does not fit an existing boolean", func() {
+		ctx.PutBool("rest:resource-matching", true)
+		step := ExecStep(script(`echo '{"rest:resource-matching": "sometimes"}'`))
+		Ω(step.Fn(ctx)).ShouldNot(BeNil())
+	})
+
+	It("fails with the command's stderr when it exits with a non-zero status", func() {
+		step := ExecStep(script(`echo "bosh is down" >&2; exit 3`))
+		err := step.Fn(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("bosh is down"))
+	})
+
+	It("fails when the output is not a JSON object", func() {
+		step := ExecStep(script(`echo done`))
+		Ω(step.Fn(ctx)).ShouldNot(BeNil())
+	})
+
+	It("fails when the command does not exist", func() {
+		step := ExecStep(ExecPrefix + path.Join(dir, "missing.sh"))
+		Ω(step.Fn(ctx)).ShouldNot(BeNil())
+	})
+})
@@ -0,0 +1,74 @@
+package workloads
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+// FaultyStep runs another step with faults injected, e.g.
+// faulty(cf:push,error=10%,delay=2s±1s,panic=1%)
+const FaultyStep = "faulty"
+
+// Faults are what a faulty(...) step injects into the step it wraps: a Delay
+// before it runs, and, instead of running it, an error at ErrorRate or a
+// panic at PanicRate
+type Faults struct {
+	Delay     Delay
+	ErrorRate float64
+	PanicRate float64
+}
+
+var faultsRandom = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// ParseFaults reads the delay, error and panic arguments of a faulty(...)
+// step, the delay in the form of ParseDelay and the rates of ParseRate
+func ParseFaults(arguments map[string]string) (faults Faults, err error) {
+	for name, value := range arguments {
+		switch name {
+		case "delay":
+			faults.Delay, err = ParseDelay(value)
+		case "error":
+			faults.ErrorRate, err = ParseRate(value)
+		case "panic":
+			faults.PanicRate, err = ParseRate(value)
+		default:
+			err = fmt.Errorf("unknown fault '%s', expected delay, error or panic", name)
+		}
+		if err != nil {
+			return Faults{}, err
+		}
+	}
+
+	if faults.ErrorRate+faults.PanicRate > 1 {
+		return Faults{}, fmt.Errorf("error and panic rates add up to more than 100%%")
+	}
+	return faults, nil
+}
+
+// Inject returns the step with the faults injected into it
+func (faults Faults) Inject(step WorkloadStep) WorkloadStep {
+	fn := step.Fn
+	step.Fn = func(ctx context.Context) error {
+		faultsRandom.Lock()
+		delay := faults.Delay.Sample(faultsRandom.Rand)
+		roll := faultsRandom.Float64()
+		faultsRandom.Unlock()
+
+		time.Sleep(delay)
+		switch {
+		case roll < faults.PanicRate:
+			panic(fmt.Sprintf("Injected panic in %s", step.Name))
+		case roll < faults.PanicRate+faults.ErrorRate:
+			return fmt.Errorf("Injected error in %s", step.Name)
+		}
+		return fn(ctx)
+	}
+	return step
+}
@@ -0,0 +1,55 @@
+package workloads_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Faults", func() {
+	var (
+		ran  bool
+		step WorkloadStep
+	)
+
+	BeforeEach(func() {
+		ran = false
+		step = Step("push", func() error { ran = true; return nil }, "")
+	})
+
+	It("parses delays and rates", func() {
+		faults, err := ParseFaults(map[string]string{"delay": "200ms", "error": "10%", "panic": "0.01"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(faults).Should(Equal(Faults{Delay{Mean: 200 * time.Millisecond}, 0.1, 0.01}))
+
+		_, err = ParseFaults(map[string]string{"timeout": "1s"})
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("runs the step when no fault is injected", func() {
+		Ω(Faults{}.Inject(step).Fn(context.New())).Should(BeNil())
+		Ω(ran).Should(BeTrue())
+	})
+
+	It("delays the step", func() {
+		start := time.Now()
+		Faults{Delay: Delay{Mean: 100 * time.Millisecond}}.Inject(step).Fn(context.New())
+		Ω(time.Now().Sub(start).Seconds()).Should(BeNumerically("~", 0.1, 0.05))
+		Ω(ran).Should(BeTrue())
+	})
+
+	It("fails the step instead of running it", func() {
+		err := Faults{ErrorRate: 1}.Inject(step).Fn(context.New())
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("push"))
+		Ω(ran).Should(BeFalse())
+	})
+
+	It("panics instead of running the step", func() {
+		Ω(func() { Faults{PanicRate: 1}.Inject(step).Fn(context.New()) }).Should(Panic())
+		Ω(ran).Should(BeFalse())
+	})
+})
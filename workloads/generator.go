@@ -0,0 +1,217 @@
+package workloads
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/nu7hatch/gouuid"
+)
+
+// appTemplate is the files of an app for a buildpack; Binary, if given, is
+// the source of a Go program compiled for the platform into the app's "app"
+// executable, so that binary_buildpack apps need nothing from the stack
+type appTemplate struct {
+	Buildpack string
+	Files     map[string]string
+	Binary    string
+}
+
+const helloServer = "package main\n\nimport (\n\t\"fmt\"\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n\thttp.HandleFunc(\"/\", func(w http.ResponseWriter, r *http.Request) {\n\t\tfmt.Fprint(w, \"Hello from PAT $SALT\")\n\t})\n\thttp.ListenAndServe(\":\"+os.Getenv(\"PORT\"), nil)\n}\n"
+
+// $SALT is replaced in every file so that each generated app is unique
+var appTemplates = map[string]appTemplate{
+	"staticfile": {"staticfile_buildpack", map[string]string{
+		"Staticfile": "",
+		"index.html": "<html><body>Hello from PAT $SALT</body></html>\n",
+	}, ""},
+	"ruby": {"ruby_buildpack", map[string]string{
+		"config.ru":    "app = lambda do |env|\n body = 'Hello from PAT $SALT'\n [200, { 'Content-Type' => 'text/plain', 'Content-Length' => body.length.to_s }, [body] ]\nend\n\nrun app\n",
+		"Gemfile":      "source \"https://rubygems.org\"\n\ngem \"rack\"\n",
+		"Gemfile.lock": "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (1.5.2)\n\nPLATFORMS\n  ruby\n\nDEPENDENCIES\n  rack\n",
+	}, ""},
+	"go": {"go_buildpack", map[string]string{
+		"go.mod":  "module pat-app\n",
+		"main.go": helloServer,
+	}, ""},
+	"binary": {"binary_buildpack", map[string]string{
+		"Procfile": "web: ./app\n",
+	}, helloServer},
+}
+
+func AppLanguages() []string {
+	languages := make([]string, 0, len(appTemplates))
+	for language := range appTemplates {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+func PopulateGeneratorContext(language string, files int, bytes int, ctx context.Context) {
+	ctx.PutString("app:language", language)
+	ctx.PutInt("app:files", files)
+	ctx.PutInt("app:bytes", bytes)
+}
+
+// GenerateApp writes an app for the given language's buildpack to dir, with
+// a manifest selecting the buildpack and a payload of random data spread
+// over the given number of files
+func GenerateApp(dir string, language string, files int, bytes int) error {
+	template, ok := appTemplates[language]
+	if !ok {
+		return fmt.Errorf("Unknown app language '%s', expected one of %s", language, strings.Join(AppLanguages(), ", "))
+	}
+
+	salt, _ := uuid.NewV4()
+	for name, contents := range template.Files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(strings.Replace(contents, "$SALT", salt.String(), -1)), 0644); err != nil {
+			return err
+		}
+	}
+
+	if template.Binary != "" {
+		if err := compileApp(filepath.Join(dir, "app"), strings.Replace(template.Binary, "$SALT", salt.String(), -1)); err != nil {
+			return err
+		}
+	}
+
+	manifest := fmt.Sprintf("---\napplications:\n- name: pats-%s\n  memory: 64M\n  buildpack: %s\n", salt.String(), template.Buildpack)
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.yml"), []byte(manifest), 0644); err != nil {
+		return err
+	}
+
+	return generatePayload(filepath.Join(dir, "payload"), files, bytes)
+}
+
+// compileApp builds a Go program into a static executable for the linux/amd64
+// cells of the platform, which needs the go command on the machine PAT runs on
+func compileApp(executable string, source string) error {
+	src, err := ioutil.TempDir("", "pats-app-src")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(src)
+
+	if err := ioutil.WriteFile(filepath.Join(src, "go.mod"), []byte("module pat-app\n"), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "main.go"), []byte(source), 0644); err != nil {
+		return err
+	}
+
+	build := exec.Command("go", "build", "-o", executable, ".")
+	build.Dir = src
+	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		return fmt.Errorf("Could not compile the binary app (which needs go): %v %s", err, output)
+	}
+	return nil
+}
+
+func generatePayload(dir string, files int, bytes int) error {
+	if files <= 0 || bytes <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for i := 0; i < files; i++ {
+		size := bytes / files
+		if i < bytes%files {
+			size++
+		}
+
+		payload := make([]byte, size)
+		rand.Read(payload)
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("blob-%d.bin", i)), payload, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generatedApps is the directories Generate created in this process, by
+// experiment, so that only the worker's own machine ever removes them
+var generatedApps = struct {
+	sync.Mutex
+	dirs map[string]string
+}{dirs: make(map[string]string)}
+
+// Generate creates a fresh app variant for the cf: and rest: push steps that
+// follow it, replacing the variant this process generated for the previous
+// iteration; RemoveGeneratedApps removes each worker's last
+func Generate(ctx context.Context) error {
+	if previous, _ := ctx.GetString("app:generated"); previous != "" {
+		removeGeneratedApp(previous)
+	}
+
+	language, _ := ctx.GetString("app:language")
+	files, _ := ctx.GetInt("app:files")
+	bytes, _ := ctx.GetInt("app:bytes")
+	experimentGuid, _ := ctx.GetString("experimentGuid")
+
+	dir, err := ioutil.TempDir("", "pats-app")
+	if err != nil {
+		return err
+	}
+	ctx.PutString("app:generated", dir)
+	generatedApps.Lock()
+	generatedApps.dirs[dir] = experimentGuid
+	generatedApps.Unlock()
+
+	if err := GenerateApp(dir, language, files, bytes); err != nil {
+		return err
+	}
+
+	ctx.PutString("app", dir)
+	ctx.PutString("app:manifest", filepath.Join(dir, "manifest.yml"))
+	return nil
+}
+
+// removeGeneratedApp removes dir if this process generated it; a context
+// carried over from another machine may name a directory that is not ours
+func removeGeneratedApp(dir string) {
+	generatedApps.Lock()
+	_, ours := generatedApps.dirs[dir]
+	delete(generatedApps.dirs, dir)
+	generatedApps.Unlock()
+
+	if ours {
+		os.RemoveAll(dir)
+	}
+}
+
+// RemoveGeneratedApps removes the apps this process generated for the
+// experiment, once it has ended
+func RemoveGeneratedApps(experimentGuid string) {
+	generatedApps.Lock()
+	defer generatedApps.Unlock()
+	for dir, guid := range generatedApps.dirs {
+		if guid == experimentGuid {
+			os.RemoveAll(dir)
+			delete(generatedApps.dirs, dir)
+		}
+	}
+}
+
+// RemoveAllGeneratedApps removes every app this process generated, e.g. when
+// a redis slave, which does not know when experiments end, stops
+func RemoveAllGeneratedApps() {
+	generatedApps.Lock()
+	defer generatedApps.Unlock()
+	for dir := range generatedApps.dirs {
+		os.RemoveAll(dir)
+		delete(generatedApps.dirs, dir)
+	}
+}
@@ -0,0 +1,133 @@
+package workloads_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App generator", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "pat-generator")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	for _, language := range AppLanguages() {
+		language := language
+		It("generates a "+language+" app with a manifest selecting its buildpack", func() {
+			err := GenerateApp(dir, language, 0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			manifest, err := ioutil.ReadFile(filepath.Join(dir, "manifest.yml"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(manifest)).Should(ContainSubstring("buildpack: " + language + "_buildpack"))
+		})
+	}
+
+	It("spreads the payload size over the requested number of files", func() {
+		err := GenerateApp(dir, "staticfile", 3, 1000)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		payload, _ := ioutil.ReadDir(filepath.Join(dir, "payload"))
+		Ω(payload).Should(HaveLen(3))
+		total := int64(0)
+		for _, f := range payload {
+			total += f.Size()
+		}
+		Ω(total).Should(BeEquivalentTo(1000))
+	})
+
+	It("generates a different app each time", func() {
+		other, _ := ioutil.TempDir("", "pat-generator")
+		defer os.RemoveAll(other)
+
+		GenerateApp(dir, "staticfile", 0, 0)
+		GenerateApp(other, "staticfile", 0, 0)
+
+		first, _ := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+		second, _ := ioutil.ReadFile(filepath.Join(other, "index.html"))
+		Ω(first).ShouldNot(Equal(second))
+	})
+
+	It("compiles binary apps into an executable which needs nothing from the stack", func() {
+		err := GenerateApp(dir, "binary", 0, 0)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		procfile, _ := ioutil.ReadFile(filepath.Join(dir, "Procfile"))
+		Ω(string(procfile)).Should(Equal("web: ./app\n"))
+		info, err := os.Stat(filepath.Join(dir, "app"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(info.Mode() & 0111).ShouldNot(BeZero())
+	})
+
+	It("rejects unknown languages", func() {
+		err := GenerateApp(dir, "cobol", 0, 0)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("the app:generate workload", func() {
+		It("points the push steps at a new app, removing the previous one", func() {
+			ctx := context.New()
+			PopulateGeneratorContext("ruby", 2, 100, ctx)
+
+			err := Generate(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			first, _ := ctx.GetString("app")
+			_, err = os.Stat(filepath.Join(first, "config.ru"))
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest, _ := ctx.GetString("app:manifest")
+			Ω(manifest).Should(Equal(filepath.Join(first, "manifest.yml")))
+
+			err = Generate(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			second, _ := ctx.GetString("app")
+			Ω(second).ShouldNot(Equal(first))
+			_, err = os.Stat(first)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+			os.RemoveAll(second)
+		})
+
+		It("does not remove a previous app it did not generate, e.g. one named in a context from another machine", func() {
+			ctx := context.New()
+			PopulateGeneratorContext("staticfile", 0, 0, ctx)
+			ctx.PutString("app:generated", dir)
+
+			Ω(Generate(ctx)).Should(BeNil())
+			generated, _ := ctx.GetString("app")
+			defer os.RemoveAll(generated)
+			_, err := os.Stat(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("removes the apps generated for an experiment once it has ended", func() {
+			ctx := context.New()
+			PopulateGeneratorContext("staticfile", 0, 0, ctx)
+			ctx.PutString("experimentGuid", "ENDED")
+			Ω(Generate(ctx)).Should(BeNil())
+			ended, _ := ctx.GetString("app")
+
+			other := context.New()
+			PopulateGeneratorContext("staticfile", 0, 0, other)
+			other.PutString("experimentGuid", "RUNNING")
+			Ω(Generate(other)).Should(BeNil())
+			running, _ := other.GetString("app")
+			defer os.RemoveAll(running)
+
+			RemoveGeneratedApps("ENDED")
+			_, err := os.Stat(ended)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+			_, err = os.Stat(running)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
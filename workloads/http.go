@@ -0,0 +1,165 @@
+package workloads
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+func PopulateHttpContext(method string, url string, headers string, body string, expectStatus int, expectBody string, expectJson string, ctx context.Context) {
+	ctx.PutString("http:method", method)
+	ctx.PutString("http:url", url)
+	ctx.PutString("http:headers", headers)
+	ctx.PutString("http:body", body)
+	ctx.PutInt("http:expect-status", expectStatus)
+	ctx.PutString("http:expect-body", expectBody)
+	ctx.PutString("http:expect-json", expectJson)
+}
+
+func (r *rest) HttpRequest(ctx context.Context) error {
+	rawUrl, _ := ctx.GetString("http:url")
+	if rawUrl == "" {
+		return errors.New("argument http:url does not exist")
+	}
+
+	method, _ := ctx.GetString("http:method")
+	if method == "" {
+		method = "GET"
+	}
+
+	url, err := expandTemplate(rawUrl, ctx)
+	if err != nil {
+		return err
+	}
+
+	rawBody, _ := ctx.GetString("http:body")
+	body, err := expandTemplate(rawBody, ctx)
+	if err != nil {
+		return err
+	}
+
+	rawHeaders, _ := ctx.GetString("http:headers")
+	headers, err := parseHeaders(rawHeaders)
+	if err != nil {
+		return err
+	}
+
+	var responseBody []byte
+	reply := r.client.Request(strings.ToUpper(method), url, headers, strings.NewReader(body), RequestTimeout, &responseBody)
+	if reply.Code == 0 {
+		return errors.New(reply.Message)
+	}
+
+	return checkHttpAssertions(ctx, reply, responseBody)
+}
+
+func checkHttpAssertions(ctx context.Context, reply Reply, responseBody []byte) error {
+	if expectStatus, _ := ctx.GetInt("http:expect-status"); expectStatus != 0 {
+		if reply.Code != expectStatus {
+			return fmt.Errorf("Expected status %d but got %s", expectStatus, reply.Message)
+		}
+	} else if err := reply.checkError(); err != nil {
+		return err
+	}
+
+	if expectBody, _ := ctx.GetString("http:expect-body"); expectBody != "" {
+		if !bytes.Contains(responseBody, []byte(expectBody)) {
+			return fmt.Errorf("Expected response body to contain '%s'", expectBody)
+		}
+	}
+
+	if expectJson, _ := ctx.GetString("http:expect-json"); expectJson != "" {
+		return checkJsonPath(responseBody, expectJson)
+	}
+
+	return nil
+}
+
+// checkJsonPath asserts that a dot-separated path (e.g. "entity.state" or
+// "resources.0.metadata.guid") exists in a JSON document, and if given as
+// "path=value", that it has the expected value
+func checkJsonPath(responseBody []byte, expectation string) error {
+	parts := strings.SplitN(expectation, "=", 2)
+	path := parts[0]
+
+	var decoded interface{}
+	if err := json.Unmarshal(responseBody, &decoded); err != nil {
+		return fmt.Errorf("Expected a JSON response body: %v", err)
+	}
+
+	current := decoded
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return fmt.Errorf("JSON path '%s' not found in response", path)
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return fmt.Errorf("JSON path '%s' not found in response", path)
+			}
+			current = node[index]
+		default:
+			return fmt.Errorf("JSON path '%s' not found in response", path)
+		}
+	}
+
+	if len(parts) == 2 && fmt.Sprintf("%v", current) != parts[1] {
+		return fmt.Errorf("Expected JSON path '%s' to be '%s' but was '%v'", path, parts[1], current)
+	}
+
+	return nil
+}
+
+func parseHeaders(headers string) (http.Header, error) {
+	parsed := make(http.Header)
+	for _, header := range strings.Split(headers, "|") {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+
+		nameAndValue := strings.SplitN(header, ":", 2)
+		if len(nameAndValue) != 2 {
+			return nil, fmt.Errorf("Invalid header '%s', expected 'Name: value'", header)
+		}
+		parsed.Add(strings.TrimSpace(nameAndValue[0]), strings.TrimSpace(nameAndValue[1]))
+	}
+
+	return parsed, nil
+}
+
+// expandTemplate fills in a text/template using the values in the workload context,
+// e.g. "{{.appNames}}" or "{{.iterationIndex}}"
+func expandTemplate(text string, ctx context.Context) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("http").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := ctx.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string]interface{})
+	json.Unmarshal(encoded, &values)
+
+	var expanded bytes.Buffer
+	if err := tmpl.Execute(&expanded, values); err != nil {
+		return "", err
+	}
+	return expanded.String(), nil
+}
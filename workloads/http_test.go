@@ -0,0 +1,206 @@
+package workloads_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP request workload", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+		err     error
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		replies["http://myapp.example.com/things"] = map[string]interface{}{
+			"state":     "STARTED",
+			"resources": []interface{}{map[string]interface{}{"name": "thing-1"}},
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = NewRestWorkloadWithClient(client).HttpRequest(ctx)
+	})
+
+	Context("When no url is configured", func() {
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When a url is configured", func() {
+		BeforeEach(func() {
+			PopulateHttpContext("", "http://myapp.example.com/things", "", "", 0, "", "", ctx)
+		})
+
+		It("sends a GET by default", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("GET", "http://myapp.example.com/things")
+		})
+	})
+
+	Context("When the url and body are templates", func() {
+		BeforeEach(func() {
+			ctx.PutString("appNames", "myapp")
+			ctx.PutInt("iterationIndex", 3)
+			PopulateHttpContext("post", "http://{{.appNames}}.example.com/things", "Content-Type: application/json|X-Trace: on", `{"n":{{.iterationIndex}}}`, 0, "", "", ctx)
+		})
+
+		It("fills them in from the workload context", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			sent := client.ShouldHaveBeenCalledWith("POST", "http://myapp.example.com/things")
+			Ω(sent.(request).body).Should(Equal(`{"n":3}`))
+		})
+
+		It("sends the configured headers", func() {
+			sent := client.ShouldHaveBeenCalledWith("POST", "http://myapp.example.com/things")
+			Ω(sent.(request).headers.Get("X-Trace")).Should(Equal("on"))
+			Ω(sent.(request).headers.Get("Content-Type")).Should(Equal("application/json"))
+		})
+	})
+
+	Context("When the response is an error", func() {
+		BeforeEach(func() {
+			PopulateHttpContext("GET", "http://myapp.example.com/missing", "", "", 0, "", "", ctx)
+		})
+
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Assertions", func() {
+		var (
+			expectStatus int
+			expectBody   string
+			expectJson   string
+		)
+
+		BeforeEach(func() {
+			expectStatus = 0
+			expectBody = ""
+			expectJson = ""
+		})
+
+		JustBeforeEach(func() {
+			PopulateHttpContext("GET", "http://myapp.example.com/things", "", "", expectStatus, expectBody, expectJson, ctx)
+			err = NewRestWorkloadWithClient(client).HttpRequest(ctx)
+		})
+
+		Context("When the status matches", func() {
+			BeforeEach(func() { expectStatus = 200 })
+
+			It("passes", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("When the status does not match", func() {
+			BeforeEach(func() { expectStatus = 201 })
+
+			It("fails", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("When the body contains the expected text", func() {
+			BeforeEach(func() { expectBody = "STARTED" })
+
+			It("passes", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("When the body does not contain the expected text", func() {
+			BeforeEach(func() { expectBody = "STOPPED" })
+
+			It("fails", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("When the JSON path has the expected value", func() {
+			BeforeEach(func() { expectJson = "resources.0.name=thing-1" })
+
+			It("passes", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("When the JSON path only needs to exist", func() {
+			BeforeEach(func() { expectJson = "state" })
+
+			It("passes", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("When the JSON path has a different value", func() {
+			BeforeEach(func() { expectJson = "state=STOPPED" })
+
+			It("fails", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("When the JSON path does not exist", func() {
+			BeforeEach(func() { expectJson = "resources.1.name" })
+
+			It("fails", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
+
+var _ = Describe("HTTP request workload against a real server", func() {
+	Context("When the server accepts the request but never responds", func() {
+		var (
+			ctx         context.Context
+			err         error
+			server      *httptest.Server
+			release     chan bool
+			oldTimeout  time.Duration
+			requestTime time.Duration
+		)
+
+		BeforeEach(func() {
+			release = make(chan bool)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+			oldTimeout = RequestTimeout
+			RequestTimeout = 100 * time.Millisecond
+			ctx = context.New()
+			PopulateHttpContext("", server.URL, "", "", 0, "", "", ctx)
+		})
+
+		JustBeforeEach(func() {
+			start := time.Now()
+			err = NewRestWorkload().HttpRequest(ctx)
+			requestTime = time.Now().Sub(start)
+		})
+
+		AfterEach(func() {
+			RequestTimeout = oldTimeout
+			close(release)
+			server.Close()
+		})
+
+		It("gives up after the request timeout", func() {
+			Ω(err).Should(HaveOccurred())
+			Ω(requestTime).Should(BeNumerically("<", 5*time.Second))
+		})
+	})
+})
@@ -0,0 +1,174 @@
+package workloads
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/logs"
+)
+
+const DefaultLedgerDir = "output/ledgers"
+
+// kinds of resource recorded in the ledger, in the order Cleanup deletes them
+const (
+	LedgerServiceBinding  = "rest:service-binding"
+	LedgerRoute           = "rest:route"
+	LedgerRestApp         = "rest:app"
+	LedgerServiceInstance = "rest:service-instance"
+	LedgerCfApp           = "cf:app"
+)
+
+// LedgerEntry is a resource created by a workload during an experiment; the
+// worker index identifies whose credentials created (and so can delete) it
+type LedgerEntry struct {
+	Kind    string `json:"kind"`
+	Id      string `json:"id"`
+	Worker  int    `json:"worker"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+var ledgerLock sync.Mutex
+
+func PopulateLedgerContext(dir string, ctx context.Context) {
+	ctx.PutString("ledger:dir", dir)
+}
+
+// recordResource adds a resource to the experiment's ledger, so that it is
+// deleted by Cleanup even if a later step that should delete it never runs
+func recordResource(ctx context.Context, kind string, id string) {
+	updateLedger(ctx, LedgerEntry{Kind: kind, Id: id})
+}
+
+func forgetResource(ctx context.Context, kind string, id string) {
+	updateLedger(ctx, LedgerEntry{Kind: kind, Id: id, Removed: true})
+}
+
+func updateLedger(ctx context.Context, entry LedgerEntry) {
+	worker, ok := ctx.GetInt("workerIndex")
+	if !ok {
+		worker, _ = ctx.GetInt("iterationIndex")
+	}
+	entry.Worker = worker
+
+	if deferred, ok := deferredEntries(ctx); ok {
+		putDeferredEntries(ctx, append(deferred, entry))
+		return
+	}
+
+	RecordLedgerEntries(ctx, []LedgerEntry{entry})
+}
+
+// RecordLedgerEntries appends entries to the ledger of the experiment in ctx,
+// e.g. ones a redis slave recorded while running a task for it
+func RecordLedgerEntries(ctx context.Context, entries []LedgerEntry) {
+	dir, _ := ctx.GetString("ledger:dir")
+	experimentGuid, _ := ctx.GetString("experimentGuid")
+	if dir == "" || experimentGuid == "" {
+		return
+	}
+
+	for _, entry := range entries {
+		if err := appendToLedger(dir, experimentGuid, entry); err != nil {
+			logs.NewLogger("workloads.ledger").Errorf("Could not record %s %s for cleanup: %v", entry.Kind, entry.Id, err)
+		}
+	}
+}
+
+// DeferLedger has the entries workloads running in ctx record kept in ctx,
+// for TakeDeferredLedger, instead of in this machine's ledger; redis slaves
+// send them back to the master, which keeps the experiment's ledger
+func DeferLedger(ctx context.Context) {
+	putDeferredEntries(ctx, []LedgerEntry{})
+}
+
+// TakeDeferredLedger returns the entries recorded in ctx since DeferLedger,
+// and stops deferring them
+func TakeDeferredLedger(ctx context.Context) []LedgerEntry {
+	deferred, _ := deferredEntries(ctx)
+	ctx.Delete("ledger:deferred")
+	return deferred
+}
+
+func deferredEntries(ctx context.Context) ([]LedgerEntry, bool) {
+	encoded, ok := ctx.GetString("ledger:deferred")
+	if !ok {
+		return nil, false
+	}
+
+	var entries []LedgerEntry
+	json.Unmarshal([]byte(encoded), &entries)
+	return entries, true
+}
+
+func putDeferredEntries(ctx context.Context, entries []LedgerEntry) {
+	encoded, _ := json.Marshal(entries)
+	ctx.PutString("ledger:deferred", string(encoded))
+}
+
+func appendToLedger(dir string, experimentGuid string, entry LedgerEntry) error {
+	ledgerLock.Lock()
+	defer ledgerLock.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(ledgerPath(dir, experimentGuid), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// LedgerEntries returns the resources of an experiment that have been
+// recorded and not yet removed, in the order they were created
+func LedgerEntries(dir string, experimentGuid string) ([]LedgerEntry, error) {
+	ledgerLock.Lock()
+	defer ledgerLock.Unlock()
+
+	entries := make([]LedgerEntry, 0)
+	f, err := os.Open(ledgerPath(dir, experimentGuid))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+
+		if entry.Removed {
+			entries = withoutEntry(entries, entry)
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+func withoutEntry(entries []LedgerEntry, removed LedgerEntry) []LedgerEntry {
+	remaining := make([]LedgerEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Kind != removed.Kind || e.Id != removed.Id {
+			remaining = append(remaining, e)
+		}
+	}
+	return remaining
+}
+
+func ledgerPath(dir string, experimentGuid string) string {
+	return path.Join(dir, experimentGuid+".ledger")
+}
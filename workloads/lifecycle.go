@@ -0,0 +1,173 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+const DefaultScaleInstances = 2
+
+func PopulateAppLifecycleContext(instances int, memory int, env string, ctx context.Context) {
+	ctx.PutInt("rest:instances", instances)
+	ctx.PutInt("rest:memory", memory)
+	ctx.PutString("rest:env", env)
+}
+
+func (r *rest) DeleteApp(ctx context.Context) error {
+	return r.withLastApp(ctx, func(r *rest, token string, appUri string) error {
+		apiEndpoint, _ := ctx.GetString("apiEndpoint")
+		return r.DeleteSuccessfully(token, fmt.Sprintf("%s%s?recursive=true", apiEndpoint, appUri), nil, nil, func(reply Reply) error {
+			removeApp(ctx, appGuidFromUri(appUri))
+			return r.deleteAppRoute(ctx, token, appGuidFromUri(appUri))
+		})
+	})
+}
+
+func (r *rest) StopApp(ctx context.Context) error {
+	return r.withLastApp(ctx, func(r *rest, token string, appUri string) error {
+		return r.stop(ctx, appUri, func() error {
+			return nil
+		})
+	})
+}
+
+func (r *rest) StartApp(ctx context.Context) error {
+	return r.withLastApp(ctx, func(r *rest, token string, appUri string) error {
+		return r.start(ctx, appUri, func() error {
+			return r.trackAppRunning(ctx, appUri)
+		})
+	})
+}
+
+func (r *rest) RestartApp(ctx context.Context) error {
+	return r.withLastApp(ctx, func(r *rest, token string, appUri string) error {
+		return r.stop(ctx, appUri, func() error {
+			return r.start(ctx, appUri, func() error {
+				return r.trackAppRunning(ctx, appUri)
+			})
+		})
+	})
+}
+
+func (r *rest) ScaleApp(ctx context.Context) error {
+	input := make(map[string]interface{})
+	instances, _ := ctx.GetInt("rest:instances")
+	if instances <= 0 {
+		instances = DefaultScaleInstances
+	}
+	input["instances"] = instances
+	if memory, _ := ctx.GetInt("rest:memory"); memory > 0 {
+		input["memory"] = memory
+	}
+
+	return r.withLastApp(ctx, func(r *rest, token string, appUri string) error {
+		return r.updateApp(ctx, appUri, input, func() error {
+			return nil
+		})
+	})
+}
+
+func (r *rest) UpdateAppEnv(ctx context.Context) error {
+	env, _ := ctx.GetString("rest:env")
+	environment, err := parseEnv(env)
+	if err != nil {
+		return err
+	}
+
+	input := make(map[string]interface{})
+	input["environment_json"] = environment
+	return r.withLastApp(ctx, func(r *rest, token string, appUri string) error {
+		return r.updateApp(ctx, appUri, input, func() error {
+			return nil
+		})
+	})
+}
+
+func (r *rest) stop(ctx context.Context, appUri string, then func() error) error {
+	input := make(map[string]interface{})
+	input["state"] = "STOPPED"
+	return r.updateApp(ctx, appUri, input, then)
+}
+
+func (r *rest) updateApp(ctx context.Context, appUri string, input map[string]interface{}, then func() error) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		return r.PutSuccessfully(token, fmt.Sprintf("%s%s", apiEndpoint, appUri), input, nil, func(reply Reply) error {
+			return then()
+		})
+	})
+}
+
+func (r *rest) withLastApp(ctx context.Context, then func(r *rest, token string, appUri string) error) error {
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		appGuid, ok := lastInList(ctx, "appGuids")
+		if !ok {
+			return errors.New("No app pushed with rest:push")
+		}
+
+		return then(r, token, "/v2/apps/"+appGuid)
+	})
+}
+
+// addApp tracks an app pushed with the REST api by name, like cf:push apps,
+// and by guid, remembering which name is which guid
+func addApp(ctx context.Context, appName string, appGuid string) {
+	addAppName(ctx, appName)
+	addAppGuid(ctx, appGuid)
+	ctx.PutString("appGuid:"+appName, appGuid)
+	ctx.PutString("appName:"+appGuid, appName)
+}
+
+// removeApp stops tracking a deleted app, by name as well as by guid, so
+// that the steps after it no longer use it
+func removeApp(ctx context.Context, appGuid string) {
+	removeAppGuid(ctx, appGuid)
+	if appName, ok := ctx.GetString("appName:" + appGuid); ok {
+		removeAppName(ctx, appName)
+		ctx.Delete("appName:" + appGuid)
+		ctx.Delete("appGuid:" + appName)
+	}
+}
+
+func addAppGuid(ctx context.Context, appGuid string) {
+	appendToList(ctx, "appGuids", appGuid)
+	recordResource(ctx, LedgerRestApp, appGuid)
+}
+
+func removeAppGuid(ctx context.Context, appGuid string) {
+	removeFromList(ctx, "appGuids", appGuid)
+	forgetResource(ctx, LedgerRestApp, appGuid)
+}
+
+func appGuidFromUri(appUri string) string {
+	return appUri[strings.LastIndex(appUri, "/")+1:]
+}
+
+// parseEnv reads a |-separated list of NAME=value pairs; when none are given a
+// timestamped variable is set so that every update changes the app
+func parseEnv(env string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, variable := range strings.Split(env, "|") {
+		if strings.TrimSpace(variable) == "" {
+			continue
+		}
+
+		nameAndValue := strings.SplitN(variable, "=", 2)
+		if len(nameAndValue) != 2 {
+			return nil, fmt.Errorf("Invalid environment variable '%s', expected 'NAME=value'", variable)
+		}
+		parsed[strings.TrimSpace(nameAndValue[0])] = nameAndValue[1]
+	}
+
+	if len(parsed) == 0 {
+		parsed["PAT_UPDATED_AT"] = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,148 @@
+package workloads_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST app lifecycle workloads", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		ctx.PutString("token", "TOKEN")
+		ctx.PutString("apiEndpoint", "APISERVER")
+		PopulateAppLifecycleContext(3, 256, "GREETING=hello|COLOR=blue", ctx)
+	})
+
+	Context("When no app has been pushed", func() {
+		It("returns an error", func() {
+			err := NewRestWorkloadWithClient(client).StopApp(ctx)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When apps have been pushed", func() {
+		BeforeEach(func() {
+			ctx.PutString("appNames", "first-app,last-app")
+			ctx.PutString("appGuids", "FIRST-GUID,LAST-GUID")
+			ctx.PutString("appGuid:last-app", "LAST-GUID")
+			ctx.PutString("appName:LAST-GUID", "last-app")
+			replies["APISERVER/v2/apps/LAST-GUID"] = ""
+			replies["APISERVER/v2/apps/LAST-GUID/instances"] = map[string]interface{}{"0": map[string]string{"state": "RUNNING"}}
+			replies["APISERVER/v2/apps/LAST-GUID?recursive=true"] = ""
+		})
+
+		It("deletes the most recently pushed app and stops tracking it", func() {
+			err := NewRestWorkloadWithClient(client).DeleteApp(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/apps/LAST-GUID?recursive=true")
+			appGuids, _ := ctx.GetString("appGuids")
+			Ω(appGuids).Should(Equal("FIRST-GUID"))
+			appNames, _ := ctx.GetString("appNames")
+			Ω(appNames).Should(Equal("first-app"))
+			_, ok := ctx.GetString("appGuid:last-app")
+			Ω(ok).Should(BeFalse())
+		})
+
+		It("stops the most recently pushed app", func() {
+			err := NewRestWorkloadWithClient(client).StopApp(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/apps/LAST-GUID"))
+			Ω(data["state"]).Should(Equal("STOPPED"))
+		})
+
+		It("starts the most recently pushed app", func() {
+			err := NewRestWorkloadWithClient(client).StartApp(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/apps/LAST-GUID"))
+			Ω(data["state"]).Should(Equal("STARTED"))
+		})
+
+		It("restarts the most recently pushed app", func() {
+			err := NewRestWorkloadWithClient(client).RestartApp(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("GET", "APISERVER/v2/apps/LAST-GUID/instances")
+		})
+
+		Context("When an instance crashes while starting", func() {
+			BeforeEach(func() {
+				replies["APISERVER/v2/apps/LAST-GUID/instances"] = map[string]interface{}{
+					"0": map[string]string{"state": "RUNNING"},
+					"1": map[string]string{"state": "CRASHED"},
+				}
+			})
+
+			It("fails the restart", func() {
+				err := NewRestWorkloadWithClient(client).RestartApp(ctx)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("When an instance never starts", func() {
+			var oldInterval time.Duration
+
+			BeforeEach(func() {
+				oldInterval = AppStartPollInterval
+				AppStartPollInterval = 10 * time.Millisecond
+				PopulateAppStartContext(1, ctx)
+				replies["APISERVER/v2/apps/LAST-GUID/instances"] = map[string]interface{}{
+					"0": map[string]string{"state": "RUNNING"},
+					"1": map[string]string{"state": "STARTING"},
+				}
+			})
+
+			AfterEach(func() {
+				AppStartPollInterval = oldInterval
+			})
+
+			It("fails the start once rest:start-timeout passes", func() {
+				err := NewRestWorkloadWithClient(client).StartApp(ctx)
+				Ω(err).Should(HaveOccurred())
+				Ω(err.Error()).Should(ContainSubstring("within 1 seconds"))
+			})
+
+			It("fails the start of an app with no instances", func() {
+				replies["APISERVER/v2/apps/LAST-GUID/instances"] = map[string]interface{}{}
+				err := NewRestWorkloadWithClient(client).StartApp(ctx)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		It("scales the most recently pushed app", func() {
+			err := NewRestWorkloadWithClient(client).ScaleApp(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/apps/LAST-GUID"))
+			Ω(data["instances"]).Should(BeEquivalentTo(3))
+			Ω(data["memory"]).Should(BeEquivalentTo(256))
+		})
+
+		It("updates the environment of the most recently pushed app", func() {
+			err := NewRestWorkloadWithClient(client).UpdateAppEnv(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/apps/LAST-GUID"))
+			Ω(data["environment_json"]).Should(Equal(map[string]interface{}{"GREETING": "hello", "COLOR": "blue"}))
+		})
+
+		Context("When the environment is malformed", func() {
+			BeforeEach(func() {
+				PopulateAppLifecycleContext(3, 256, "GREETING", ctx)
+			})
+
+			It("returns an error", func() {
+				err := NewRestWorkloadWithClient(client).UpdateAppEnv(ctx)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,194 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+const (
+	DefaultLogLines            = 10
+	DefaultLogTimeoutInSeconds = 30
+)
+
+var LogPollInterval = 500 * time.Millisecond
+
+type AppsResponse struct {
+	Resources []Resource `json:"resources"`
+}
+
+// PopulateLogsContext configures app:logs; endpoint is a template for the URL
+// the app's logs are read from, e.g. https://doppler.example.com/apps/{{.appGuid}}/recentlogs,
+// and defaults to the recent logs of the doppler endpoint the target advertises
+func PopulateLogsContext(lines int, endpoint string, timeoutInSeconds int, ctx context.Context) {
+	ctx.PutInt("logs:lines", lines)
+	ctx.PutString("logs:endpoint", endpoint)
+	ctx.PutInt("logs:timeout", timeoutInSeconds)
+}
+
+// StreamLogs has the most recently pushed app (which must serve dora's
+// /loglines endpoint) log tagged lines, then polls the log endpoint until
+// they have all arrived or logs:timeout passes, reporting their average
+// latency and the number and fraction lost as the latency-ms, lines-lost and
+// loss-rate metrics
+func (r *rest) StreamLogs(ctx context.Context) error {
+	appName, ok := lastAppName(ctx)
+	if !ok {
+		return errors.New("No pushed app to log from")
+	}
+
+	lines, _ := ctx.GetInt("logs:lines")
+	if lines <= 0 {
+		lines = DefaultLogLines
+	}
+
+	timeout, _ := ctx.GetInt("logs:timeout")
+	if timeout <= 0 {
+		timeout = DefaultLogTimeoutInSeconds
+	}
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		appGuid, err := r.lookupAppGuid(ctx, token, appName)
+		if err != nil {
+			return err
+		}
+
+		appUrl, err := r.appRouteUrl(ctx, appGuid)
+		if err != nil {
+			return err
+		}
+
+		endpoint, err := logEndpoint(ctx, appGuid)
+		if err != nil {
+			return err
+		}
+
+		tag := logTag(ctx)
+		var body []byte
+		generate := fmt.Sprintf("%sloglines/%d/%s", appUrl, lines, tag)
+		if reply := r.client.Request("GET", generate, nil, nil, RequestTimeout, &body); reply.Code != 200 {
+			return fmt.Errorf("App did not log lines from %s: %s", generate, reply.Message)
+		}
+
+		// a request above may have refreshed the token
+		token, _ = ctx.GetString("token")
+		latencies, err := r.awaitLogLines(endpoint, token, tag, lines, time.Now().Add(time.Duration(timeout)*time.Second))
+		if err != nil {
+			return err
+		}
+
+		if len(latencies) > 0 {
+			var total time.Duration
+			for _, latency := range latencies {
+				total = total + latency
+			}
+			Gauge(ctx, "latency-ms", float64(total.Nanoseconds())/float64(len(latencies))/float64(time.Millisecond))
+		}
+		Count(ctx, "lines-lost", lines-len(latencies))
+		Gauge(ctx, "loss-rate", float64(lines-len(latencies))/float64(lines))
+		return nil
+	})
+}
+
+// awaitLogLines polls the log endpoint until every tagged line has been seen
+// or the deadline passes, returning how long each line seen took to arrive
+func (r *rest) awaitLogLines(endpoint string, token string, tag string, lines int, deadline time.Time) (map[int]time.Duration, error) {
+	pattern := regexp.MustCompile(`(\d{4}-\S+) line (\d+) ` + regexp.QuoteMeta(tag) + `(?:[^\w-]|$)`)
+	headers := http.Header{"Authorization": {"bearer " + token}}
+	latencies := make(map[int]time.Duration)
+
+	for {
+		var body []byte
+		reply := r.client.Request("GET", endpoint, headers, nil, requestTimeout(deadline), &body)
+		if reply.Code != 200 {
+			return nil, fmt.Errorf("Could not read logs from %s: %s", endpoint, reply.Message)
+		}
+
+		seen := time.Now()
+		for _, match := range pattern.FindAllSubmatch(body, -1) {
+			line, err := strconv.Atoi(string(match[2]))
+			if err != nil || line >= lines {
+				continue
+			}
+			if _, ok := latencies[line]; ok {
+				continue
+			}
+
+			logged, err := time.Parse(time.RFC3339Nano, string(match[1]))
+			if err != nil {
+				continue
+			}
+			latencies[line] = seen.Sub(logged)
+		}
+
+		if len(latencies) == lines || time.Now().After(deadline) {
+			return latencies, nil
+		}
+
+		time.Sleep(LogPollInterval)
+	}
+}
+
+func logEndpoint(ctx context.Context, appGuid string) (string, error) {
+	endpoint, _ := ctx.GetString("logs:endpoint")
+	if endpoint == "" {
+		doppler, _ := ctx.GetString("dopplerEndpoint")
+		if doppler == "" {
+			return "", errors.New("argument logs:endpoint does not exist and the target has no doppler endpoint")
+		}
+		doppler = strings.Replace(strings.Replace(doppler, "wss://", "https://", 1), "ws://", "http://", 1)
+		return strings.TrimSuffix(doppler, "/") + "/apps/" + appGuid + "/recentlogs", nil
+	}
+
+	appCtx := ctx.Clone()
+	appCtx.PutString("appGuid", appGuid)
+	return expandTemplate(endpoint, appCtx)
+}
+
+// lookupAppGuid finds the guid of the app named appName: the one recorded
+// when it was pushed with the REST api, or for cf:push apps the Cloud
+// Controller's
+func (r *rest) lookupAppGuid(ctx context.Context, token string, appName string) (string, error) {
+	if appGuid, ok := ctx.GetString("appGuid:" + appName); ok {
+		return appGuid, nil
+	}
+
+	apiEndpoint, ok := ctx.GetString("apiEndpoint")
+	if !ok {
+		return "", errors.New("Error: not targetted")
+	}
+
+	apps := &AppsResponse{}
+	var appGuid string
+	err := r.GetSuccessfully(token, apiEndpoint+"/v2/apps?q="+url.QueryEscape("name:"+appName), nil, apps, func(reply Reply) error {
+		if len(apps.Resources) == 0 {
+			return fmt.Errorf("App %s not found", appName)
+		}
+		appGuid = apps.Resources[0].Metadata.Guid
+		return nil
+	})
+	return appGuid, err
+}
+
+// logTag marks the lines each run of app:logs generates, so that lines of
+// other workers, iterations and runs logging from the same app are told apart
+func logTag(ctx context.Context) string {
+	runs, _ := ctx.GetInt("logs:runs")
+	runs = runs + 1
+	ctx.PutInt("logs:runs", runs)
+
+	experimentGuid, _ := ctx.GetString("experimentGuid")
+	if len(experimentGuid) > 8 {
+		experimentGuid = experimentGuid[:8]
+	}
+	worker, _ := ctx.GetInt("workerIndex")
+	iteration, _ := ctx.GetInt("iterationIndex")
+	return fmt.Sprintf("pats-%s-%d-%d-%d", experimentGuid, worker, iteration, runs)
+}
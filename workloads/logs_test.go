@@ -0,0 +1,146 @@
+package workloads_test
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App logs workload", func() {
+	const (
+		tag       = "pats-EXPERIME-1-3-1"
+		generate  = "http://myapp.example.com/loglines/10/" + tag
+		recentlog = "https://doppler.example.com/apps/app-guid/recentlogs"
+	)
+
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+		err     error
+	)
+
+	logLines := func(tag string, lines ...int) string {
+		logged := time.Now().Add(-2 * time.Second).Format(time.RFC3339Nano)
+		output := make([]string, 0)
+		for _, line := range lines {
+			output = append(output, fmt.Sprintf("%s line %d %s", logged, line, tag))
+		}
+		return strings.Join(output, "\n")
+	}
+
+	metrics := func() map[string]float64 {
+		reported := make(map[string]float64)
+		for _, m := range TakeMetrics(ctx) {
+			reported[m.Name] = m.Value
+		}
+		return reported
+	}
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		ctx.PutString("token", "a-token")
+		ctx.PutString("apiEndpoint", "https://api.example.com")
+		ctx.PutString("dopplerEndpoint", "wss://doppler.example.com:443")
+		ctx.PutString("experimentGuid", "EXPERIMENT-GUID")
+		ctx.PutInt("workerIndex", 1)
+		ctx.PutInt("iterationIndex", 3)
+		ctx.PutString("appNames", "otherapp,myapp")
+		ctx.PutString("appGuids", "app-guid,other-app-guid")
+		ctx.PutString("appGuid:otherapp", "other-app-guid")
+		ctx.PutString("appGuid:myapp", "app-guid")
+		PopulateLogsContext(10, "", 1, ctx)
+		LogPollInterval = 10 * time.Millisecond
+
+		replies["https://api.example.com/v2/apps/app-guid/routes?inline-relations-depth=1"] = routesTo("myapp", "example.com")
+		replies[generate] = "logged"
+	})
+
+	JustBeforeEach(func() {
+		err = NewRestWorkloadWithClient(client).StreamLogs(ctx)
+	})
+
+	Context("When every line arrives", func() {
+		BeforeEach(func() {
+			replies["https://doppler.example.com:443/apps/app-guid/recentlogs"] = logLines(tag, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+		})
+
+		It("has the app log tagged lines on its route", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("GET", "https://api.example.com/v2/apps/app-guid/routes?inline-relations-depth=1")
+			client.ShouldHaveBeenCalledWith("GET", generate)
+		})
+
+		It("reads them from the target's doppler endpoint with the token", func() {
+			recent := client.ShouldHaveBeenCalledWith("GET", "https://doppler.example.com:443/apps/app-guid/recentlogs").(request)
+			Ω(recent.headers.Get("Authorization")).Should(Equal("bearer a-token"))
+		})
+
+		It("reports the latency and no loss", func() {
+			reported := metrics()
+			Ω(reported["latency-ms"]).Should(BeNumerically("~", 2000, 200))
+			Ω(reported["loss-rate"]).Should(Equal(0.0))
+		})
+	})
+
+	Context("When lines are lost", func() {
+		BeforeEach(func() {
+			PopulateLogsContext(10, "https://doppler.example.com/apps/{{.appGuid}}/recentlogs", 1, ctx)
+			replies[recentlog] = logLines(tag, 0, 1, 2, 3, 4, 5, 6, 7) + "\n" + logLines("pats-EXPERIME-1-3-10", 8, 9)
+		})
+
+		It("waits for the timeout and reports the fraction lost", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics()["loss-rate"]).Should(BeNumerically("~", 0.2, 0.0001))
+		})
+	})
+
+	Context("When the app was pushed by the CF command-line", func() {
+		BeforeEach(func() {
+			ctx.PutString("appNames", "myapp")
+			ctx.Delete("appGuid:myapp")
+			PopulateLogsContext(10, "https://doppler.example.com/apps/{{.appGuid}}/recentlogs", 1, ctx)
+			replies["https://api.example.com/v2/apps?q=name%3Amyapp"] = map[string]interface{}{}
+			replies["https://api.example.com/v2/apps/123456789/routes?inline-relations-depth=1"] = routesTo("myapp", "example.com")
+			replies["https://doppler.example.com/apps/123456789/recentlogs"] = logLines(tag, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+		})
+
+		It("looks up the app's guid by name", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("GET", "https://api.example.com/v2/apps?q=name%3Amyapp")
+		})
+	})
+
+	Context("When the log endpoint fails", func() {
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When the app has no route", func() {
+		BeforeEach(func() {
+			replies["https://api.example.com/v2/apps/app-guid/routes?inline-relations-depth=1"] = RoutesResponse{[]RouteResource{}}
+		})
+
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When the app cannot log", func() {
+		BeforeEach(func() {
+			delete(replies, generate)
+		})
+
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package workloads
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"launchpad.net/goyaml"
+)
+
+// DefaultPushMemoryInMB is the memory cf:push and rest:push give apps pushed
+// without a manifest, so that the two push the same app alike
+const DefaultPushMemoryInMB = 64
+
+type manifestApp struct {
+	Memory    string `yaml:"memory"`
+	Instances int    `yaml:"instances"`
+	Buildpack string `yaml:"buildpack"`
+}
+
+type manifest struct {
+	Applications []manifestApp `yaml:"applications"`
+	Memory       string        `yaml:"memory"`
+	Instances    int           `yaml:"instances"`
+	Buildpack    string        `yaml:"buildpack"`
+}
+
+// appSettings reads the memory, instances and buildpack of the first app in the
+// app:manifest manifest, falling back to top-level settings like the cf CLI does;
+// without a manifest apps get DefaultPushMemoryInMB
+func appSettings(ctx context.Context) (memoryInMB int, instances int, buildpack string, err error) {
+	manifestPath, _ := ctx.GetString("app:manifest")
+	if manifestPath == "" {
+		return DefaultPushMemoryInMB, 0, "", nil
+	}
+
+	contents, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	m := manifest{}
+	if err = goyaml.Unmarshal(contents, &m); err != nil {
+		return 0, 0, "", err
+	}
+
+	app := manifestApp{m.Memory, m.Instances, m.Buildpack}
+	if len(m.Applications) > 0 {
+		first := m.Applications[0]
+		if first.Memory != "" {
+			app.Memory = first.Memory
+		}
+		if first.Instances != 0 {
+			app.Instances = first.Instances
+		}
+		if first.Buildpack != "" {
+			app.Buildpack = first.Buildpack
+		}
+	}
+
+	memoryInMB, err = memoryInMegabytes(app.Memory)
+	return memoryInMB, app.Instances, app.Buildpack, err
+}
+
+func memoryInMegabytes(memory string) (int, error) {
+	if memory == "" {
+		return 0, nil
+	}
+
+	unit := 1
+	amount := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(memory)), "B")
+	switch {
+	case strings.HasSuffix(amount, "G"):
+		unit = 1024
+		amount = strings.TrimSuffix(amount, "G")
+	case strings.HasSuffix(amount, "M"):
+		amount = strings.TrimSuffix(amount, "M")
+	}
+
+	n, err := strconv.Atoi(amount)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid memory '%s' in manifest", memory)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,70 @@
+package workloads
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+// kinds of metric, which are aggregated alike but displayed differently
+const (
+	CounterMetric = "counter"
+	GaugeMetric   = "gauge"
+	TimingMetric  = "timing"
+)
+
+type Measurement struct {
+	Name  string
+	Kind  string
+	Value float64
+}
+
+// Count reports a number of things a workload step did, e.g. the bytes
+// rest:push uploaded, which is sampled as a metric of the step alongside its timings
+func Count(ctx context.Context, name string, n int) {
+	report(ctx, CounterMetric, name, float64(n))
+}
+
+// Gauge reports a value measured by a workload step, e.g. the load of a cell
+func Gauge(ctx context.Context, name string, value float64) {
+	report(ctx, GaugeMetric, name, value)
+}
+
+// Timing reports a duration measured by a workload step, other than the time
+// the step (or one of its phases) took
+func Timing(ctx context.Context, name string, duration time.Duration) {
+	report(ctx, TimingMetric, name, float64(duration.Nanoseconds()))
+}
+
+func report(ctx context.Context, kind string, name string, value float64) {
+	appendToList(ctx, "metrics", fmt.Sprintf("%s:%s=%s", kind, name, strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+// TakeMetrics returns the values reported since it was last called, and forgets them
+func TakeMetrics(ctx context.Context) []Measurement {
+	measurements := make([]Measurement, 0)
+	recorded, _ := ctx.GetString("metrics")
+	for _, m := range strings.Split(recorded, ",") {
+		kindAndRest := strings.SplitN(m, ":", 2)
+		if len(kindAndRest) != 2 {
+			continue
+		}
+
+		nameAndValue := strings.SplitN(kindAndRest[1], "=", 2)
+		if len(nameAndValue) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(nameAndValue[1], 64)
+		if err != nil {
+			continue
+		}
+		measurements = append(measurements, Measurement{nameAndValue[0], kindAndRest[0], value})
+	}
+
+	ctx.PutString("metrics", "")
+	return measurements
+}
@@ -0,0 +1,41 @@
+package workloads_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.New()
+	})
+
+	It("records the name, kind and value of each reported metric", func() {
+		Count(ctx, "bytes-uploaded", 1024)
+		Gauge(ctx, "loss-rate", 0.125)
+		Timing(ctx, "queued", 1500*time.Millisecond)
+
+		Ω(TakeMetrics(ctx)).Should(Equal([]Measurement{
+			{"bytes-uploaded", CounterMetric, 1024},
+			{"loss-rate", GaugeMetric, 0.125},
+			{"queued", TimingMetric, 1.5e9},
+		}))
+	})
+
+	It("keeps names containing colons", func() {
+		Gauge(ctx, "cell:memory", 0.5)
+		Ω(TakeMetrics(ctx)[0].Name).Should(Equal("cell:memory"))
+	})
+
+	It("forgets the metrics once they have been taken", func() {
+		Count(ctx, "bytes-uploaded", 1024)
+		TakeMetrics(ctx)
+		Ω(TakeMetrics(ctx)).Should(BeEmpty())
+	})
+})
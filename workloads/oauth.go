@@ -0,0 +1,177 @@
+package workloads
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+const DefaultClientId = "cf"
+
+// tokens are refreshed this long before they expire, rather than risk a 401 mid-step
+const TokenRefreshMarginInSeconds = 60
+
+func PopulateOAuthContext(clientId string, clientSecret string, grantType string, ctx context.Context) {
+	ctx.PutString("rest:client-id", clientId)
+	ctx.PutString("rest:client-secret", clientSecret)
+	ctx.PutString("rest:grant-type", grantType)
+}
+
+// checkLoggedIn runs then with a rest whose requests are sent again, once,
+// with a fresh token when the token is rejected as unauthorized; only the
+// rejected request is repeated, not the ones then made before it
+func (r *rest) checkLoggedIn(ctx context.Context, then func(r *rest, token string) error) error {
+	if _, exists := ctx.GetString("token"); !exists {
+		return errors.New("Error: not logged in")
+	}
+
+	if tokenExpiring(ctx) {
+		if err := r.refreshToken(ctx); err != nil {
+			return err
+		}
+	}
+
+	token, _ := ctx.GetString("token")
+	return then(r.reauthenticating(ctx), token)
+}
+
+func (r *rest) reauthenticating(ctx context.Context) *rest {
+	if c, ok := r.client.(*reauthenticatingClient); ok {
+		r = c.rest
+	}
+	return &rest{client: &reauthenticatingClient{httpclient: r.client, rest: r, ctx: ctx}}
+}
+
+// refreshToken uses the refresh token, if there is one, and otherwise, or if
+// it is rejected, gets a new token with the worker's grant
+func (r *rest) refreshToken(ctx context.Context) error {
+	return TimePhase(ctx, "token-refresh", func() error {
+		if refreshToken, _ := ctx.GetString("refreshToken"); refreshToken != "" {
+			values := make(url.Values)
+			values.Add("grant_type", "refresh_token")
+			values.Add("refresh_token", refreshToken)
+			if err := r.requestToken(ctx, values); err == nil {
+				return nil
+			}
+		}
+
+		return r.requestToken(ctx, r.grantInputs(ctx))
+	})
+}
+
+func (r *rest) requestToken(ctx context.Context, values url.Values) error {
+	loginEndpoint, _ := ctx.GetString("loginEndpoint")
+	clientId, _ := ctx.GetString("rest:client-id")
+	if clientId == "" {
+		clientId = DefaultClientId
+	}
+	clientSecret, _ := ctx.GetString("rest:client-secret")
+
+	body := &LoginResponse{}
+	return r.PostToUaaSuccessfully(fmt.Sprintf("%s/oauth/token", loginEndpoint), clientId, clientSecret, values, body, func(reply Reply) error {
+		ctx.PutString("token", body.Token)
+		ctx.PutString("refreshToken", body.RefreshToken)
+		if body.ExpiresIn > 0 {
+			ctx.PutInt("tokenExpiresAt", int(time.Now().Unix())+body.ExpiresIn)
+		} else {
+			ctx.PutInt("tokenExpiresAt", 0)
+		}
+		return nil
+	})
+}
+
+func (r *rest) grantInputs(ctx context.Context) url.Values {
+	values := make(url.Values)
+	if grantType, _ := ctx.GetString("rest:grant-type"); grantType == "client_credentials" {
+		values.Add("grant_type", "client_credentials")
+		return values
+	}
+
+	username, password := credentialsForWorker(ctx)
+	values.Add("grant_type", "password")
+	values.Add("username", username)
+	values.Add("password", password)
+	values.Add("scope", "")
+
+	return values
+}
+
+func tokenExpiring(ctx context.Context) bool {
+	expiresAt, _ := ctx.GetInt("tokenExpiresAt")
+	return expiresAt > 0 && int(time.Now().Unix())+TokenRefreshMarginInSeconds >= expiresAt
+}
+
+// reauthenticatingClient sends each request with the context's current token,
+// which an earlier request of the step may have refreshed, and sends it again
+// with a fresh token if the token is rejected
+type reauthenticatingClient struct {
+	httpclient
+	rest *rest
+	ctx  context.Context
+}
+
+func (c *reauthenticatingClient) Get(token string, url string, data interface{}, body interface{}) Reply {
+	return c.send(token, body, func(token string) Reply { return c.httpclient.Get(token, url, data, body) })
+}
+
+func (c *reauthenticatingClient) Put(token string, url string, data interface{}, body interface{}) Reply {
+	return c.send(token, body, func(token string) Reply { return c.httpclient.Put(token, url, data, body) })
+}
+
+func (c *reauthenticatingClient) Post(token string, url string, data interface{}, body interface{}) Reply {
+	return c.send(token, body, func(token string) Reply { return c.httpclient.Post(token, url, data, body) })
+}
+
+func (c *reauthenticatingClient) Delete(token string, url string, data interface{}, body interface{}) Reply {
+	return c.send(token, body, func(token string) Reply { return c.httpclient.Delete(token, url, data, body) })
+}
+
+func (c *reauthenticatingClient) Patch(token string, url string, data interface{}, body interface{}) Reply {
+	return c.send(token, body, func(token string) Reply { return c.httpclient.Patch(token, url, data, body) })
+}
+
+func (c *reauthenticatingClient) MultipartPut(token string, m *multipart.Writer, url string, data *bytes.Buffer, body interface{}) Reply {
+	bits := data.Bytes()
+	return c.send(token, body, func(token string) Reply {
+		return c.httpclient.MultipartPut(token, m, url, bytes.NewBuffer(bits), body)
+	})
+}
+
+func (c *reauthenticatingClient) MultipartPost(token string, m *multipart.Writer, url string, data *bytes.Buffer, body interface{}) Reply {
+	bits := data.Bytes()
+	return c.send(token, body, func(token string) Reply {
+		return c.httpclient.MultipartPost(token, m, url, bytes.NewBuffer(bits), body)
+	})
+}
+
+func (c *reauthenticatingClient) send(token string, body interface{}, request func(token string) Reply) Reply {
+	if token == "" {
+		return request(token)
+	}
+
+	token, _ = c.ctx.GetString("token")
+	reply := request(token)
+	if reply.Code != 401 {
+		return reply
+	}
+
+	if err := c.rest.refreshToken(c.ctx); err != nil {
+		return reply
+	}
+	token, _ = c.ctx.GetString("token")
+	resetBody(body)
+	return request(token)
+}
+
+// resetBody empties a response body the rejected request decoded its error into
+func resetBody(body interface{}) {
+	if v := reflect.ValueOf(body); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
@@ -0,0 +1,214 @@
+package workloads_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/url"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type unauthorizedOnceClient struct {
+	*dummyClient
+	rejected bool
+}
+
+func (c *unauthorizedOnceClient) Put(token string, host string, data interface{}, s interface{}) (reply Reply) {
+	if !c.rejected {
+		c.rejected = true
+		return Reply{401, "401 Unauthorized", ""}
+	}
+	return c.dummyClient.Put(token, host, data, s)
+}
+
+type unauthorizedUploadClient struct {
+	*dummyClient
+	rejected    bool
+	appsCreated int
+	uploads     []string
+}
+
+func (c *unauthorizedUploadClient) Post(token string, host string, data interface{}, s interface{}) (reply Reply) {
+	if host == "APISERVER/v2/apps" {
+		c.appsCreated++
+	}
+	return c.dummyClient.Post(token, host, data, s)
+}
+
+func (c *unauthorizedUploadClient) MultipartPut(token string, m *multipart.Writer, host string, data *bytes.Buffer, s interface{}) (reply Reply) {
+	c.uploads = append(c.uploads, token+" "+data.String())
+	if !c.rejected {
+		c.rejected = true
+		return Reply{401, "401 Unauthorized", ""}
+	}
+	return c.dummyClient.MultipartPut(token, m, host, data, s)
+}
+
+type refreshRejectingClient struct {
+	*unauthorizedOnceClient
+}
+
+func (c *refreshRejectingClient) PostToUaa(host string, clientId string, clientSecret string, data url.Values, s interface{}) (reply Reply) {
+	if data.Get("grant_type") == "refresh_token" {
+		return Reply{401, "401 Unauthorized", ""}
+	}
+	return c.unauthorizedOnceClient.PostToUaa(host, clientId, clientSecret, data, s)
+}
+
+var _ = Describe("OAuth tokens", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		ctx.PutInt("iterationIndex", 0)
+		ctx.PutString("loginEndpoint", "LOGINSERVER")
+		ctx.PutString("apiEndpoint", "APISERVER")
+		ctx.PutString("rest:space", "dev")
+
+		replies["LOGINSERVER/oauth/token"] = LoginResponse{"NEW-TOKEN", "NEW-REFRESH-TOKEN", 3600}
+		replies["APISERVER/v2/spaces?q=name:dev"] = SpaceResponse{[]Resource{Resource{Metadata{"SPACE-GUID"}}}}
+	})
+
+	Describe("Logging in", func() {
+		Context("With the password grant", func() {
+			BeforeEach(func() {
+				PopulateRestContext("APISERVER", "user", "pass", "dev", ctx)
+			})
+
+			It("uses the cf client by default", func() {
+				err := NewRestWorkloadWithClient(client).Login(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(client.ShouldHaveBeenCalledWith("POST(uaa client)", "LOGINSERVER/oauth/token")).Should(Equal("cf:"))
+			})
+
+			It("times getting the token as its own phase", func() {
+				NewRestWorkloadWithClient(client).Login(ctx)
+				phases := TakePhases(ctx)
+				Ω(phases).Should(HaveLen(1))
+				Ω(phases[0].Name).Should(Equal("token"))
+			})
+
+			It("remembers when the token expires", func() {
+				NewRestWorkloadWithClient(client).Login(ctx)
+				expiresAt, _ := ctx.GetInt("tokenExpiresAt")
+				Ω(expiresAt).Should(BeNumerically("~", time.Now().Unix()+3600, 5))
+			})
+		})
+
+		Context("With the client_credentials grant", func() {
+			BeforeEach(func() {
+				PopulateOAuthContext("pat-client", "s3cret", "client_credentials", ctx)
+			})
+
+			It("does not need a username or password", func() {
+				err := NewRestWorkloadWithClient(client).Login(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+				data := client.ShouldHaveBeenCalledWith("POST(uaa)", "LOGINSERVER/oauth/token")
+				Ω(data.(url.Values).Get("grant_type")).Should(Equal("client_credentials"))
+			})
+
+			It("authenticates as the configured client", func() {
+				NewRestWorkloadWithClient(client).Login(ctx)
+				Ω(client.ShouldHaveBeenCalledWith("POST(uaa client)", "LOGINSERVER/oauth/token")).Should(Equal("pat-client:s3cret"))
+			})
+		})
+	})
+
+	Describe("Refreshing", func() {
+		BeforeEach(func() {
+			ctx.PutString("token", "OLD-TOKEN")
+			ctx.PutString("refreshToken", "OLD-REFRESH-TOKEN")
+			ctx.PutString("appGuids", "APP-GUID")
+			replies["APISERVER/v2/apps/APP-GUID"] = ""
+		})
+
+		Context("When the token is about to expire", func() {
+			BeforeEach(func() {
+				ctx.PutInt("tokenExpiresAt", int(time.Now().Unix())+5)
+			})
+
+			It("refreshes it before making the request", func() {
+				err := NewRestWorkloadWithClient(client).StopApp(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				data := client.ShouldHaveBeenCalledWith("POST(uaa)", "LOGINSERVER/oauth/token")
+				Ω(data.(url.Values).Get("grant_type")).Should(Equal("refresh_token"))
+				Ω(data.(url.Values).Get("refresh_token")).Should(Equal("OLD-REFRESH-TOKEN"))
+				token, _ := ctx.GetString("token")
+				Ω(token).Should(Equal("NEW-TOKEN"))
+			})
+
+			It("times the refresh as its own phase", func() {
+				NewRestWorkloadWithClient(client).StopApp(ctx)
+				phases := TakePhases(ctx)
+				Ω(phases).Should(HaveLen(1))
+				Ω(phases[0].Name).Should(Equal("token-refresh"))
+			})
+		})
+
+		Context("When the token has plenty of time left", func() {
+			BeforeEach(func() {
+				ctx.PutInt("tokenExpiresAt", int(time.Now().Unix())+3600)
+			})
+
+			It("does not refresh it", func() {
+				NewRestWorkloadWithClient(client).StopApp(ctx)
+				token, _ := ctx.GetString("token")
+				Ω(token).Should(Equal("OLD-TOKEN"))
+			})
+		})
+
+		Context("When a request is rejected as unauthorized", func() {
+			It("refreshes the token and retries the request", func() {
+				err := NewRestWorkloadWithClient(&unauthorizedOnceClient{client, false}).StopApp(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+				client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/apps/APP-GUID")
+				token, _ := ctx.GetString("token")
+				Ω(token).Should(Equal("NEW-TOKEN"))
+			})
+
+			It("gets a new token with the worker's grant when the refresh token is rejected", func() {
+				PopulateRestContext("APISERVER", "user", "pass", "dev", ctx)
+				err := NewRestWorkloadWithClient(&refreshRejectingClient{&unauthorizedOnceClient{client, false}}).StopApp(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				data := client.ShouldHaveBeenCalledWith("POST(uaa)", "LOGINSERVER/oauth/token")
+				Ω(data.(url.Values).Get("grant_type")).Should(Equal("password"))
+				Ω(data.(url.Values).Get("username")).Should(Equal("user"))
+				token, _ := ctx.GetString("token")
+				Ω(token).Should(Equal("NEW-TOKEN"))
+			})
+
+			It("only sends the rejected request again, not the requests of the step before it", func() {
+				ctx.PutString("space_guid", "SPACE-GUID")
+				client.replyWithLocation["APISERVER/v2/apps"] = "/v2/apps/NEW-APP-GUID"
+				replies["APISERVER/v2/apps/NEW-APP-GUID"] = ""
+				replies["APISERVER/v2/apps/NEW-APP-GUID/bits"] = ""
+				replies["APISERVER/v2/shared_domains?results-per-page=1"] = DomainsResponse{[]Resource{Resource{Metadata{"DOMAIN-GUID"}}}}
+				replies["APISERVER/v2/routes"] = Resource{Metadata{"ROUTE-GUID"}}
+				replies["APISERVER/v2/routes/ROUTE-GUID/apps/NEW-APP-GUID"] = ""
+
+				uploading := &unauthorizedUploadClient{dummyClient: client}
+				err := NewRestWorkloadWithClient(uploading).Push(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(uploading.appsCreated).Should(Equal(1))
+				Ω(uploading.uploads).Should(HaveLen(2))
+				Ω(uploading.uploads[0]).Should(HavePrefix("OLD-TOKEN "))
+				Ω(uploading.uploads[1]).Should(Equal("NEW-TOKEN " + uploading.uploads[0][len("OLD-TOKEN "):]))
+				appGuids, _ := ctx.GetString("appGuids")
+				Ω(appGuids).Should(Equal("APP-GUID,NEW-APP-GUID"))
+			})
+		})
+	})
+})
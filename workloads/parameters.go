@@ -0,0 +1,258 @@
+package workloads
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+// Parameter is an argument a step accepts in a workload list, e.g. the memory
+// of cf:push(memory=256M); it is passed to the step as the ContextKey value,
+// which must be a whole number if the parameter is Numeric
+type Parameter struct {
+	Name        string
+	ContextKey  string
+	Description string
+	Numeric     bool
+}
+
+// StepCall is one step of a workload list, with the arguments given to it;
+// a random(...) step instead holds the flows one of which it runs, and a
+// faulty(...) step the step it wraps and the faults it injects
+type StepCall struct {
+	Text      string
+	Name      string
+	Arguments map[string]string
+	Choices   []Choice
+	Wrapped   *StepCall
+	Faults    Faults
+}
+
+// Choice is a flow of a random(...) step, run in proportion to its weight
+type Choice struct {
+	Weight int
+	Steps  []StepCall
+}
+
+// RandomStep runs one of several weighted flows, e.g.
+// random(70:cf:push,cf:delete|30:rest:scale(instances=3))
+const RandomStep = "random"
+
+func (step WorkloadStep) WithParameters(parameters ...Parameter) WorkloadStep {
+	step.Parameters = parameters
+	return step
+}
+
+func (step WorkloadStep) parameter(name string) (Parameter, bool) {
+	for _, p := range step.Parameters {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// ValidateArguments checks that the step accepts every argument of the call,
+// and that numeric arguments are numbers
+func (step WorkloadStep) ValidateArguments(call StepCall) error {
+	for name, value := range call.Arguments {
+		p, ok := step.parameter(name)
+		if !ok {
+			return fmt.Errorf("%s (unknown parameter '%s')", call.Text, name)
+		}
+		if _, err := strconv.ParseInt(value, 0, 0); p.Numeric && err != nil {
+			return fmt.Errorf("%s (parameter '%s' must be a number)", call.Text, name)
+		}
+	}
+	return nil
+}
+
+// Run runs the step with the call's arguments in place of the context values
+// they stand for, restoring those values, whatever their type, afterwards;
+// values which were not set before are removed again
+func (step WorkloadStep) Run(call StepCall, ctx context.Context) error {
+	if len(call.Arguments) == 0 {
+		return step.Fn(ctx)
+	}
+
+	previous := ctx.Clone()
+	keys := make([]string, 0)
+	for name, value := range call.Arguments {
+		if p, ok := step.parameter(name); ok {
+			ctx.PutString(p.ContextKey, value)
+			keys = append(keys, p.ContextKey)
+		}
+	}
+
+	defer func() {
+		restored := make(map[string]interface{})
+		for _, key := range keys {
+			if value, ok := previous[key]; ok {
+				restored[key] = value
+			} else {
+				ctx.Delete(key)
+			}
+		}
+
+		// the context only holds JSON values, so they survive the round trip
+		encoded, _ := json.Marshal(restored)
+		ctx.UnmarshalJSON(encoded)
+	}()
+
+	return step.Fn(ctx)
+}
+
+// Choose picks one of the flows of a random(...) step by weight
+func (call StepCall) Choose() []StepCall {
+	total := 0
+	for _, c := range call.Choices {
+		total += c.Weight
+	}
+
+	pick := rand.Intn(total)
+	for _, c := range call.Choices {
+		if pick < c.Weight {
+			return c.Steps
+		}
+		pick -= c.Weight
+	}
+	return nil
+}
+
+// ParseWorkload splits a comma-separated workload list into its steps, each
+// optionally followed by comma-separated name=value arguments in brackets
+func ParseWorkload(workload string) ([]StepCall, error) {
+	calls := make([]StepCall, 0)
+	for _, text := range splitOutsideBrackets(workload, ',') {
+		call, err := parseStep(text)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+func parseStep(text string) (StepCall, error) {
+	call := StepCall{Text: text, Name: text, Arguments: make(map[string]string)}
+	open := strings.Index(text, "(")
+	if open < 0 {
+		if strings.Contains(text, ")") {
+			return call, fmt.Errorf("%s (unbalanced brackets)", text)
+		}
+		return call, nil
+	}
+
+	if closingBracket(text, open) != len(text)-1 {
+		return call, fmt.Errorf("%s (unbalanced brackets)", text)
+	}
+
+	call.Name = text[:open]
+	arguments := text[open+1 : len(text)-1]
+	if call.Name == RandomStep {
+		return parseChoices(call, arguments)
+	}
+	if call.Name == FaultyStep {
+		return parseFaulty(call, arguments)
+	}
+	if strings.ContainsAny(arguments, "()") {
+		return call, fmt.Errorf("%s (unexpected brackets in arguments)", text)
+	}
+	if arguments == "" {
+		return call, nil
+	}
+
+	for _, argument := range strings.Split(arguments, ",") {
+		pair := strings.SplitN(argument, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return call, fmt.Errorf("%s (expected name=value, got '%s')", text, argument)
+		}
+		call.Arguments[pair[0]] = pair[1]
+	}
+	return call, nil
+}
+
+func parseChoices(call StepCall, flows string) (StepCall, error) {
+	for _, flow := range splitOutsideBrackets(flows, '|') {
+		pair := strings.SplitN(flow, ":", 2)
+		weight, err := strconv.Atoi(pair[0])
+		if len(pair) != 2 || err != nil || weight <= 0 {
+			return call, fmt.Errorf("%s (expected weight:steps, got '%s')", call.Text, flow)
+		}
+
+		steps, err := ParseWorkload(pair[1])
+		if err != nil {
+			return call, err
+		}
+		call.Choices = append(call.Choices, Choice{weight, steps})
+	}
+	return call, nil
+}
+
+func parseFaulty(call StepCall, arguments string) (StepCall, error) {
+	parts := splitOutsideBrackets(arguments, ',')
+	wrapped, err := parseStep(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return call, err
+	}
+	if wrapped.Name == "" || wrapped.Name == RandomStep || strings.Contains(wrapped.Name, "=") {
+		return call, fmt.Errorf("%s (expected a step to wrap, got '%s')", call.Text, parts[0])
+	}
+
+	for _, argument := range parts[1:] {
+		pair := strings.SplitN(argument, "=", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return call, fmt.Errorf("%s (expected name=value, got '%s')", call.Text, argument)
+		}
+		call.Arguments[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+	}
+
+	faults, err := ParseFaults(call.Arguments)
+	if err != nil {
+		return call, fmt.Errorf("%s (%v)", call.Text, err)
+	}
+	call.Wrapped = &wrapped
+	call.Faults = faults
+	return call, nil
+}
+
+// closingBracket is the index of the bracket closing the one at open, or -1
+func closingBracket(text string, open int) int {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func splitOutsideBrackets(workload string, separator rune) []string {
+	steps := make([]string, 0)
+	depth := 0
+	start := 0
+	for i, c := range workload {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case separator:
+			if depth == 0 {
+				steps = append(steps, workload[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(steps, workload[start:])
+}
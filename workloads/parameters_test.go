@@ -0,0 +1,164 @@
+package workloads_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parameterized steps", func() {
+	Describe("Parsing a workload list", func() {
+		It("splits steps on commas outside brackets", func() {
+			calls, err := ParseWorkload("rest:login,cf:push(memory=256M,instances=2),cf:delete")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls).Should(HaveLen(3))
+			Ω(calls[0]).Should(Equal(StepCall{"rest:login", "rest:login", map[string]string{}, nil, nil, Faults{}}))
+			Ω(calls[1]).Should(Equal(StepCall{"cf:push(memory=256M,instances=2)", "cf:push", map[string]string{"memory": "256M", "instances": "2"}, nil, nil, Faults{}}))
+			Ω(calls[2].Name).Should(Equal("cf:delete"))
+		})
+
+		It("allows values containing '='", func() {
+			calls, err := ParseWorkload("http:request(expect-json=entity.state=STARTED)")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls[0].Arguments).Should(Equal(map[string]string{"expect-json": "entity.state=STARTED"}))
+		})
+
+		It("accepts empty brackets", func() {
+			calls, err := ParseWorkload("cf:push()")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls[0].Name).Should(Equal("cf:push"))
+			Ω(calls[0].Arguments).Should(BeEmpty())
+		})
+
+		It("rejects unbalanced brackets", func() {
+			_, err := ParseWorkload("cf:push(memory=256M")
+			Ω(err).Should(HaveOccurred())
+			_, err = ParseWorkload("cf:push)")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects arguments without a value", func() {
+			_, err := ParseWorkload("cf:push(memory)")
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("cf:push(memory)"))
+		})
+
+		Describe("random steps", func() {
+			It("parses each weighted flow into its own steps", func() {
+				calls, err := ParseWorkload("rest:login,random(70:cf:push(memory=256M),cf:delete|30:rest:scale)")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(calls).Should(HaveLen(2))
+				Ω(calls[1].Name).Should(Equal(RandomStep))
+				Ω(calls[1].Choices).Should(HaveLen(2))
+				Ω(calls[1].Choices[0].Weight).Should(Equal(70))
+				Ω(calls[1].Choices[0].Steps).Should(HaveLen(2))
+				Ω(calls[1].Choices[0].Steps[0].Arguments).Should(Equal(map[string]string{"memory": "256M"}))
+				Ω(calls[1].Choices[1].Weight).Should(Equal(30))
+				Ω(calls[1].Choices[1].Steps[0].Name).Should(Equal("rest:scale"))
+			})
+
+			It("rejects flows without a positive weight", func() {
+				_, err := ParseWorkload("random(cf:push|30:rest:scale)")
+				Ω(err).Should(HaveOccurred())
+				_, err = ParseWorkload("random(0:cf:push)")
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("chooses flows in proportion to their weights", func() {
+				calls, _ := ParseWorkload("random(1:a|1000000:b)")
+				chosen := map[string]int{}
+				for i := 0; i < 100; i++ {
+					chosen[calls[0].Choose()[0].Name]++
+				}
+				Ω(chosen["b"]).Should(BeNumerically(">", 90))
+			})
+		})
+
+		Describe("faulty steps", func() {
+			It("parses the wrapped step and the faults to inject", func() {
+				calls, err := ParseWorkload("rest:login,faulty(cf:push(memory=256M), error=10%, delay=2s±1s)")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(calls).Should(HaveLen(2))
+				Ω(calls[1].Name).Should(Equal(FaultyStep))
+				Ω(calls[1].Wrapped.Name).Should(Equal("cf:push"))
+				Ω(calls[1].Wrapped.Arguments).Should(Equal(map[string]string{"memory": "256M"}))
+				Ω(calls[1].Faults.ErrorRate).Should(Equal(0.1))
+				Ω(calls[1].Faults.Delay).Should(Equal(Delay{2 * time.Second, 1 * time.Second, false}))
+			})
+
+			It("rejects unknown faults and invalid rates", func() {
+				_, err := ParseWorkload("faulty(cf:push,latency=2s)")
+				Ω(err).Should(HaveOccurred())
+				_, err = ParseWorkload("faulty(cf:push,error=150%)")
+				Ω(err).Should(HaveOccurred())
+				_, err = ParseWorkload("faulty(cf:push,error=60%,panic=60%)")
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("rejects anything but a step to wrap", func() {
+				_, err := ParseWorkload("faulty(error=10%)")
+				Ω(err).Should(HaveOccurred())
+				_, err = ParseWorkload("faulty(random(1:cf:push),error=10%)")
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Running a step with arguments", func() {
+		var (
+			step WorkloadStep
+			ctx  context.Context
+			seen string
+		)
+
+		BeforeEach(func() {
+			ctx = context.New()
+			ctx.PutInt("rest:instances", 1)
+			step = StepWithContext("scale", func(ctx context.Context) error {
+				instances, _ := ctx.GetInt("rest:instances")
+				memory, _ := ctx.GetString("rest:memory")
+				seen = fmt.Sprintf("%d/%s", instances, memory)
+				return nil
+			}, "").WithParameters(Parameter{"instances", "rest:instances", "", true}, Parameter{"memory", "rest:memory", "", false})
+		})
+
+		It("passes the arguments as the context values of the parameters", func() {
+			err := step.Run(StepCall{"scale(instances=3,memory=512)", "scale", map[string]string{"instances": "3", "memory": "512"}, nil, nil, Faults{}}, ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(seen).Should(Equal("3/512"))
+		})
+
+		It("restores the context values afterwards", func() {
+			step.Run(StepCall{"scale(instances=3)", "scale", map[string]string{"instances": "3"}, nil, nil, Faults{}}, ctx)
+			instances, _ := ctx.GetInt("rest:instances")
+			Ω(instances).Should(Equal(1))
+		})
+
+		It("restores values of any type and removes values which were not set", func() {
+			ctx.PutBool("rest:instances", true)
+			step.Run(StepCall{"scale(instances=3,memory=512)", "scale", map[string]string{"instances": "3", "memory": "512"}, nil, nil, Faults{}}, ctx)
+			restored, _ := ctx.GetBool("rest:instances")
+			Ω(restored).Should(BeTrue())
+			_, ok := ctx.GetString("rest:memory")
+			Ω(ok).Should(BeFalse())
+		})
+
+		It("only accepts the declared parameters", func() {
+			Ω(step.ValidateArguments(StepCall{"scale(memory=1)", "scale", map[string]string{"memory": "1"}, nil, nil, Faults{}})).Should(BeNil())
+			err := step.ValidateArguments(StepCall{"scale(disk=1)", "scale", map[string]string{"disk": "1"}, nil, nil, Faults{}})
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("disk"))
+		})
+
+		It("only accepts numbers for numeric parameters", func() {
+			Ω(step.ValidateArguments(StepCall{"scale(instances=3)", "scale", map[string]string{"instances": "3"}, nil, nil, Faults{}})).Should(BeNil())
+			err := step.ValidateArguments(StepCall{"scale(instances=abc)", "scale", map[string]string{"instances": "abc"}, nil, nil, Faults{}})
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("instances"))
+		})
+	})
+})
@@ -0,0 +1,49 @@
+package workloads
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// TimePhase times one phase of a composite workload step, e.g. the upload
+// during rest:push, so that it is reported as its own command alongside the step
+func TimePhase(ctx context.Context, name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	recordPhase(ctx, name, time.Now().Sub(start))
+	return err
+}
+
+func recordPhase(ctx context.Context, name string, duration time.Duration) {
+	appendToList(ctx, "phases", fmt.Sprintf("%s=%d", name, duration.Nanoseconds()))
+}
+
+// TakePhases returns the phases timed since it was last called, and forgets them
+func TakePhases(ctx context.Context) []Phase {
+	phases := make([]Phase, 0)
+	recorded, _ := ctx.GetString("phases")
+	for _, p := range strings.Split(recorded, ",") {
+		nameAndDuration := strings.SplitN(p, "=", 2)
+		if len(nameAndDuration) != 2 {
+			continue
+		}
+
+		nanos, err := strconv.ParseInt(nameAndDuration[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		phases = append(phases, Phase{nameAndDuration[0], time.Duration(nanos)})
+	}
+
+	ctx.PutString("phases", "")
+	return phases
+}
@@ -0,0 +1,42 @@
+package workloads_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Phases", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.New()
+	})
+
+	It("records the name and duration of each timed phase", func() {
+		TimePhase(ctx, "upload", func() error { time.Sleep(50 * time.Millisecond); return nil })
+		TimePhase(ctx, "staging", func() error { return nil })
+
+		phases := TakePhases(ctx)
+		Ω(phases).Should(HaveLen(2))
+		Ω(phases[0].Name).Should(Equal("upload"))
+		Ω(phases[0].Duration.Seconds()).Should(BeNumerically("~", 0.05, 0.02))
+		Ω(phases[1].Name).Should(Equal("staging"))
+	})
+
+	It("returns the phase's error, still recording its time", func() {
+		err := TimePhase(ctx, "upload", func() error { return errors.New("upload failed") })
+		Ω(err).Should(HaveOccurred())
+		Ω(TakePhases(ctx)).Should(HaveLen(1))
+	})
+
+	It("forgets the phases once they have been taken", func() {
+		TimePhase(ctx, "upload", func() error { return nil })
+		TakePhases(ctx)
+		Ω(TakePhases(ctx)).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,137 @@
+package workloads
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/nu7hatch/gouuid"
+)
+
+type ProvisionedUsers struct {
+	OrgGuid     string
+	UserGuids   []string
+	Credentials []Credential
+}
+
+// ProvisionUsers creates an org of its own, so that the rest:space name is
+// free in it, with that space and count users who are developers in it. It
+// authenticates as the configured OAuth client with the client_credentials
+// grant, which needs the scim.write and cloud_controller.admin scopes
+func (r *rest) ProvisionUsers(ctx context.Context, count int) (ProvisionedUsers, error) {
+	provisioned := ProvisionedUsers{UserGuids: make([]string, 0), Credentials: make([]Credential, 0)}
+	adminCtx := adminContext(ctx)
+	if err := r.Target(adminCtx); err != nil {
+		return provisioned, err
+	}
+	if err := r.requestToken(adminCtx, url.Values{"grant_type": {"client_credentials"}}); err != nil {
+		return provisioned, err
+	}
+
+	apiEndpoint, _ := adminCtx.GetString("apiEndpoint")
+	uaaEndpoint := uaaEndpointOf(adminCtx)
+	space, _ := ctx.GetString("rest:space")
+
+	return provisioned, r.checkLoggedIn(adminCtx, func(r *rest, token string) error {
+		orgName, _ := uuid.NewV4()
+		org := &Resource{}
+		err := r.PostSuccessfully(token, fmt.Sprintf("%s/v2/organizations", apiEndpoint), map[string]string{"name": "pats-org-" + orgName.String()}, org, func(reply Reply) error {
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		provisioned.OrgGuid = org.Metadata.Guid
+
+		createSpace := map[string]string{"name": space, "organization_guid": org.Metadata.Guid}
+		createdSpace := &Resource{}
+		err = r.PostSuccessfully(token, fmt.Sprintf("%s/v2/spaces", apiEndpoint), createSpace, createdSpace, func(reply Reply) error {
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < count; i++ {
+			name, _ := uuid.NewV4()
+			password, _ := uuid.NewV4()
+			credential := Credential{"pats-user-" + name.String(), password.String()}
+
+			createUser := map[string]interface{}{
+				"userName": credential.Username,
+				"password": credential.Password,
+				"emails":   []map[string]string{{"value": credential.Username + "@example.com"}},
+			}
+			user := &UaaUserResponse{}
+			err := r.PostSuccessfully(token, fmt.Sprintf("%s/Users", uaaEndpoint), createUser, user, func(reply Reply) error {
+				provisioned.UserGuids = append(provisioned.UserGuids, user.Id)
+				return r.PostSuccessfully(token, fmt.Sprintf("%s/v2/users", apiEndpoint), map[string]string{"guid": user.Id}, nil, func(reply Reply) error {
+					return r.PutSuccessfully(token, fmt.Sprintf("%s/v2/organizations/%s/users/%s", apiEndpoint, org.Metadata.Guid, user.Id), nil, nil, func(reply Reply) error {
+						return r.PutSuccessfully(token, fmt.Sprintf("%s/v2/spaces/%s/developers/%s", apiEndpoint, createdSpace.Metadata.Guid, user.Id), nil, nil, func(reply Reply) error {
+							return nil
+						})
+					})
+				})
+			})
+			if err != nil {
+				return err
+			}
+			provisioned.Credentials = append(provisioned.Credentials, credential)
+		}
+
+		return nil
+	})
+}
+
+// TeardownUsers deletes the org (with everything the workload left in it) and
+// the users created by ProvisionUsers
+func (r *rest) TeardownUsers(ctx context.Context, provisioned ProvisionedUsers) error {
+	adminCtx := adminContext(ctx)
+	if err := r.Target(adminCtx); err != nil {
+		return err
+	}
+	if err := r.requestToken(adminCtx, url.Values{"grant_type": {"client_credentials"}}); err != nil {
+		return err
+	}
+
+	apiEndpoint, _ := adminCtx.GetString("apiEndpoint")
+	uaaEndpoint := uaaEndpointOf(adminCtx)
+
+	return r.checkLoggedIn(adminCtx, func(r *rest, token string) error {
+		var lastErr error
+		if provisioned.OrgGuid != "" {
+			lastErr = r.DeleteSuccessfully(token, fmt.Sprintf("%s/v2/organizations/%s?recursive=true", apiEndpoint, provisioned.OrgGuid), nil, nil, func(reply Reply) error {
+				return nil
+			})
+		}
+
+		for _, userGuid := range provisioned.UserGuids {
+			err := r.DeleteSuccessfully(token, fmt.Sprintf("%s/v2/users/%s", apiEndpoint, userGuid), nil, nil, func(reply Reply) error {
+				return r.DeleteSuccessfully(token, fmt.Sprintf("%s/Users/%s", uaaEndpoint, userGuid), nil, nil, func(reply Reply) error {
+					return nil
+				})
+			})
+			if err != nil {
+				lastErr = err
+			}
+		}
+
+		return lastErr
+	})
+}
+
+// adminContext keeps the admin token out of the context the workers log in with
+func adminContext(ctx context.Context) context.Context {
+	adminCtx := ctx.Clone()
+	adminCtx.PutString("rest:grant-type", "client_credentials")
+	return adminCtx
+}
+
+func uaaEndpointOf(ctx context.Context) string {
+	if uaaEndpoint, _ := ctx.GetString("uaaEndpoint"); uaaEndpoint != "" {
+		return uaaEndpoint
+	}
+
+	loginEndpoint, _ := ctx.GetString("loginEndpoint")
+	return loginEndpoint
+}
@@ -0,0 +1,94 @@
+package workloads_test
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Provisioning users", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		PopulateRestContext("APISERVER", "", "", "dev", ctx)
+		PopulateOAuthContext("admin-client", "s3cret", "password", ctx)
+
+		replies["APISERVER/v2/info"] = TargetResponse{LoginEndpoint: "LOGINSERVER", UaaEndpoint: "UAASERVER"}
+		replies["LOGINSERVER/oauth/token"] = LoginResponse{Token: "ADMIN-TOKEN"}
+		replies["APISERVER/v2/organizations"] = Resource{Metadata{"ORG-GUID"}}
+		replies["UAASERVER/Users"] = UaaUserResponse{"USER-GUID"}
+		replies["APISERVER/v2/users"] = ""
+		replies["APISERVER/v2/organizations/ORG-GUID/users/USER-GUID"] = ""
+		replies["APISERVER/v2/spaces"] = Resource{Metadata{"SPACE-GUID"}}
+		replies["APISERVER/v2/spaces/SPACE-GUID/developers/USER-GUID"] = ""
+	})
+
+	It("creates users who are developers in a space of a new org", func() {
+		provisioned, err := NewRestWorkloadWithClient(client).ProvisionUsers(ctx, 2)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(provisioned.OrgGuid).Should(Equal("ORG-GUID"))
+		Ω(provisioned.Credentials).Should(HaveLen(2))
+		Ω(provisioned.Credentials[0].Username).ShouldNot(Equal(provisioned.Credentials[1].Username))
+
+		space := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/spaces"))
+		Ω(space["name"]).Should(Equal("dev"))
+		Ω(space["organization_guid"]).Should(Equal("ORG-GUID"))
+		client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/spaces/SPACE-GUID/developers/USER-GUID")
+	})
+
+	It("creates the space only once, as space names are unique within an org", func() {
+		spaces := &uniqueSpacesClient{client, make(map[string]bool)}
+		provisioned, err := NewRestWorkloadWithClient(spaces).ProvisionUsers(ctx, 3)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(provisioned.Credentials).Should(HaveLen(3))
+		Ω(spaces.created).Should(HaveLen(1))
+	})
+
+	It("authenticates as the configured client without replacing the workers' token", func() {
+		NewRestWorkloadWithClient(client).ProvisionUsers(ctx, 1)
+		Ω(client.ShouldHaveBeenCalledWith("POST(uaa client)", "LOGINSERVER/oauth/token")).Should(Equal("admin-client:s3cret"))
+		_, loggedIn := ctx.GetString("token")
+		Ω(loggedIn).Should(BeFalse())
+	})
+
+	It("deletes the org and users when tearing down", func() {
+		replies["APISERVER/v2/organizations/ORG-GUID?recursive=true"] = ""
+		replies["APISERVER/v2/users/USER-GUID"] = ""
+		replies["UAASERVER/Users/USER-GUID"] = ""
+
+		err := NewRestWorkloadWithClient(client).TeardownUsers(ctx, ProvisionedUsers{"ORG-GUID", []string{"USER-GUID"}, nil})
+		Ω(err).ShouldNot(HaveOccurred())
+		client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/organizations/ORG-GUID?recursive=true")
+		client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/users/USER-GUID")
+		client.ShouldHaveBeenCalledWith("DELETE", "UAASERVER/Users/USER-GUID")
+	})
+})
+
+// uniqueSpacesClient rejects a second space of the same name in an org, like
+// the Cloud Controller does
+type uniqueSpacesClient struct {
+	*dummyClient
+	created map[string]bool
+}
+
+func (c *uniqueSpacesClient) Post(token string, host string, data interface{}, s interface{}) (reply Reply) {
+	if host == "APISERVER/v2/spaces" {
+		space := mapOf(data)
+		key := fmt.Sprintf("%v/%v", space["organization_guid"], space["name"])
+		if c.created[key] {
+			return Reply{400, "CF-SpaceNameTaken", ""}
+		}
+		c.created[key] = true
+	}
+	return c.dummyClient.Post(token, host, data, s)
+}
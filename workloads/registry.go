@@ -0,0 +1,52 @@
+package workloads
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var registry struct {
+	sync.Mutex
+	steps []WorkloadStep
+}
+
+// Register makes workload steps available in the CLI, the server and redis
+// slaves alongside the built-in ones. Programs embedding PAT call it before
+// cmdline.Main, typically from an init function. It panics if a step's name
+// is already taken or cannot be used in a workload list.
+func Register(steps ...WorkloadStep) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, step := range steps {
+		if err := validateStepName(step.Name); err != nil {
+			panic(fmt.Sprintf("workloads: cannot register %s", err))
+		}
+		if step.Fn == nil {
+			panic(fmt.Sprintf("workloads: cannot register step %s without a function", step.Name))
+		}
+		for _, existing := range append(builtinWorkloads(), registry.steps...) {
+			if existing.Name == step.Name {
+				panic(fmt.Sprintf("workloads: Register called twice for step %s", step.Name))
+			}
+		}
+		registry.steps = append(registry.steps, step)
+	}
+}
+
+func registeredWorkloads() []WorkloadStep {
+	registry.Lock()
+	defer registry.Unlock()
+	return append([]WorkloadStep{}, registry.steps...)
+}
+
+func validateStepName(name string) error {
+	if name == "" || strings.ContainsAny(name, ",()|= \t") {
+		return fmt.Errorf("step '%s' (names cannot be empty or contain commas, brackets, '|', '=' or spaces)", name)
+	}
+	if name == RandomStep || name == FaultyStep || strings.HasPrefix(name, ExecPrefix) {
+		return fmt.Errorf("step '%s' (%s, %s and %s... are reserved)", name, RandomStep, FaultyStep, ExecPrefix)
+	}
+	return nil
+}
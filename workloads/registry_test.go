@@ -0,0 +1,36 @@
+package workloads_test
+
+import (
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registering workloads", func() {
+	noop := func(ctx context.Context) error { return nil }
+
+	It("adds registered steps to the default workload list", func() {
+		Register(StepWithContext("test:registered", noop, "a third-party step"))
+
+		names := make([]string, 0)
+		for _, step := range DefaultWorkloadList().Workloads {
+			names = append(names, step.Name)
+		}
+		Ω(names).Should(ContainElement("rest:push"))
+		Ω(names).Should(ContainElement("test:registered"))
+	})
+
+	It("refuses a step with the name of an existing one", func() {
+		Ω(func() { Register(StepWithContext("cf:push", noop, "")) }).Should(Panic())
+
+		Register(StepWithContext("test:twice", noop, ""))
+		Ω(func() { Register(StepWithContext("test:twice", noop, "")) }).Should(Panic())
+	})
+
+	It("refuses names that cannot be used in a workload list", func() {
+		for _, name := range []string{"", "test:a,b", "test:a(b)", "random", "faulty", "exec:test"} {
+			Ω(func() { Register(StepWithContext(name, noop, "")) }).Should(Panic())
+		}
+	})
+})
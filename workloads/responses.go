@@ -1,11 +1,15 @@
 package workloads
 
 type TargetResponse struct {
-	LoginEndpoint string `json:"authorization_endpoint"`
+	LoginEndpoint   string `json:"authorization_endpoint"`
+	UaaEndpoint     string `json:"token_endpoint"`
+	DopplerEndpoint string `json:"doppler_logging_endpoint"`
 }
 
 type LoginResponse struct {
-	Token string `json:"access_token"`
+	Token        string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
 }
 
 type Metadata struct {
@@ -19,3 +23,82 @@ type Resource struct {
 type SpaceResponse struct {
 	Resources []Resource `json:"resources"`
 }
+
+type ServicesResponse struct {
+	Resources []Resource `json:"resources"`
+}
+
+type NamedEntity struct {
+	Name string `json:"name"`
+}
+
+type NamedResource struct {
+	Metadata Metadata    `json:"metadata"`
+	Entity   NamedEntity `json:"entity"`
+}
+
+type ServicePlansResponse struct {
+	Resources []NamedResource `json:"resources"`
+}
+
+type LastOperation struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+type ServiceInstanceEntity struct {
+	LastOperation LastOperation `json:"last_operation"`
+}
+
+type ServiceInstanceResponse struct {
+	Metadata Metadata              `json:"metadata"`
+	Entity   ServiceInstanceEntity `json:"entity"`
+}
+
+type RouteEntity struct {
+	Host   string        `json:"host"`
+	Path   string        `json:"path"`
+	Domain NamedResource `json:"domain"`
+}
+
+type RouteResource struct {
+	Metadata Metadata    `json:"metadata"`
+	Entity   RouteEntity `json:"entity"`
+}
+
+type RoutesResponse struct {
+	Resources []RouteResource `json:"resources"`
+}
+
+type DomainsResponse struct {
+	Resources []Resource `json:"resources"`
+}
+
+type PageResponse struct {
+	TotalResults int        `json:"total_results"`
+	NextUrl      string     `json:"next_url"`
+	Resources    []Resource `json:"resources"`
+}
+
+type V3Resource struct {
+	Guid  string `json:"guid"`
+	State string `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type V3BuildResponse struct {
+	Guid    string     `json:"guid"`
+	State   string     `json:"state"`
+	Error   string     `json:"error"`
+	Droplet V3Resource `json:"droplet"`
+}
+
+type V3ProcessStatsResponse struct {
+	Resources []struct {
+		State string `json:"state"`
+	} `json:"resources"`
+}
+
+type UaaUserResponse struct {
+	Id string `json:"id"`
+}
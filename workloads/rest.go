@@ -6,14 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"mime/multipart"
-	"net/url"
-	"strings"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/nu7hatch/gouuid"
 )
 
+const DefaultAppStartTimeoutInSeconds = 60 * 5
+
+var AppStartPollInterval = 2 * time.Second
+
 type rest struct {
 	client httpclient
 }
@@ -37,6 +39,10 @@ func PopulateRestContext(target string, username string, password string, space
 	ctx.PutString("rest:space", space)
 }
 
+func PopulateAppStartContext(timeoutInSeconds int, ctx context.Context) {
+	ctx.PutInt("rest:start-timeout", timeoutInSeconds)
+}
+
 func (r *rest) Target(ctx context.Context) error {
 	var target string
 	if _, ok := ctx.GetString("rest:target"); ok {
@@ -48,36 +54,37 @@ func (r *rest) Target(ctx context.Context) error {
 	body := &TargetResponse{}
 	return r.GetSuccessfully("", target+"/v2/info", nil, body, func(reply Reply) error {
 		ctx.PutString("loginEndpoint", body.LoginEndpoint)
+		ctx.PutString("uaaEndpoint", body.UaaEndpoint)
+		ctx.PutString("dopplerEndpoint", body.DopplerEndpoint)
 		ctx.PutString("apiEndpoint", target)
 		return nil
 	})
 }
 
 func (r *rest) Login(ctx context.Context) error {
-	body := &LoginResponse{}
-
-	iterationIndex, exist := ctx.GetInt("iterationIndex")
-	if !exist {
+	if _, exist := ctx.GetInt("iterationIndex"); !exist {
 		return errors.New("Iteration Index does not exist in context map")
 	}
 
-	var userList, passList string
-	if _, ok := ctx.GetString("rest:username"); ok {
-		userList, _ = ctx.GetString("rest:username")
-	} else {
-		return errors.New("argument rest:username does not exist")
-	}
-	if _, ok := ctx.GetString("rest:password"); ok {
-		passList, _ = ctx.GetString("rest:password")
-	} else {
-		return errors.New("argument rest:password does not exist")
+	credentials, _ := ctx.GetString("rest:credentials")
+	if grantType, _ := ctx.GetString("rest:grant-type"); grantType != "client_credentials" && credentials == "" {
+		if _, ok := ctx.GetString("rest:username"); !ok {
+			return errors.New("argument rest:username does not exist")
+		}
+		if _, ok := ctx.GetString("rest:password"); !ok {
+			return errors.New("argument rest:password does not exist")
+		}
 	}
 
 	return checkTargetted(ctx, func(loginEndpoint string, apiEndpoint string) error {
-		return r.PostToUaaSuccessfully(fmt.Sprintf("%s/oauth/token", loginEndpoint), r.oauthInputs(credentialsForWorker(iterationIndex, userList, passList)), body, func(reply Reply) error {
-			ctx.PutString("token", body.Token)
-			return r.targetSpace(ctx)
+		err := TimePhase(ctx, "token", func() error {
+			return r.requestToken(ctx, r.grantInputs(ctx))
 		})
+		if err != nil {
+			return err
+		}
+
+		return r.targetSpace(ctx)
 	})
 }
 
@@ -92,7 +99,7 @@ func (r *rest) targetSpace(ctx context.Context) error {
 	}
 	replyBody := &SpaceResponse{}
 
-	return checkLoggedIn(ctx, func(token string) error {
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
 		return r.GetSuccessfully(token, fmt.Sprintf("%s/v2/spaces?q=name:%s", apiEndpoint, space), nil, replyBody, func(reply Reply) error {
 			return checkSpaceExists(replyBody, func() error {
 				ctx.PutString("space_guid", replyBody.Resources[0].Metadata.Guid)
@@ -103,12 +110,43 @@ func (r *rest) targetSpace(ctx context.Context) error {
 }
 
 func (r *rest) Push(ctx context.Context) error {
-	return checkLoggedIn(ctx, func(token string) error {
-		return r.createAppSuccessfully(ctx, func(appUri string) error {
-			return r.uploadAppBitsSuccessfully(ctx, appUri, func() error {
-				return r.start(ctx, appUri, func() error {
-					return r.trackAppStart(ctx, appUri)
-				})
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		var appName, appUri string
+		err := TimePhase(ctx, "create", func() error {
+			return r.createAppSuccessfully(ctx, func(name string, uri string) error {
+				appName, appUri = name, uri
+				addApp(ctx, appName, appGuidFromUri(appUri))
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		err = TimePhase(ctx, "route", func() error {
+			return r.mapAppRoute(ctx, appName, appGuidFromUri(appUri))
+		})
+		if err != nil {
+			return err
+		}
+
+		err = TimePhase(ctx, "upload", func() error {
+			return r.uploadAppBitsSuccessfully(ctx, appUri, func() error { return nil })
+		})
+		if err != nil {
+			return err
+		}
+
+		err = TimePhase(ctx, "start", func() error {
+			return r.start(ctx, appUri, func() error { return nil })
+		})
+		if err != nil {
+			return err
+		}
+
+		return TimePhase(ctx, "staging", func() error {
+			return r.trackAppStart(ctx, appUri, appStartDeadline(ctx), func() error {
+				return nil
 			})
 		})
 	})
@@ -117,9 +155,11 @@ func (r *rest) Push(ctx context.Context) error {
 func (r *rest) uploadAppBitsSuccessfully(ctx context.Context, appUri string, then func() error) error {
 	apiEndpoint, _ := ctx.GetString("apiEndpoint")
 
-	return checkLoggedIn(ctx, func(token string) error {
-		return withGeneratedAppBits(func(b *bytes.Buffer, m *multipart.Writer) error {
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		return r.withAppBits(ctx, token, func(b *bytes.Buffer, m *multipart.Writer) error {
+			uploaded := b.Len()
 			return r.MultipartPutSuccessfully(token, m, fmt.Sprintf("%s%s/bits", apiEndpoint, appUri), b, nil, func(reply Reply) error {
+				Count(ctx, "bytes-uploaded", uploaded)
 				return then()
 			})
 		})
@@ -131,15 +171,73 @@ func (r *rest) start(ctx context.Context, appUri string, then func() error) erro
 
 	input := make(map[string]interface{})
 	input["state"] = "STARTED"
-	return checkLoggedIn(ctx, func(token string) error {
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
 		return r.PutSuccessfully(token, fmt.Sprintf("%s%s", apiEndpoint, appUri), input, nil, func(reply Reply) error {
 			return then()
 		})
 	})
 }
 
-func (r *rest) trackAppStart(ctx context.Context, appUri string) error {
-	return checkLoggedIn(ctx, func(token string) error {
+// appStartDeadline is when an app started now must have staged, and started,
+// by: rest:start-timeout seconds from now
+func appStartDeadline(ctx context.Context) time.Time {
+	return time.Now().Add(time.Duration(appStartTimeout(ctx)) * time.Second)
+}
+
+func appStartTimeout(ctx context.Context) int {
+	timeout, _ := ctx.GetInt("rest:start-timeout")
+	if timeout <= 0 {
+		timeout = DefaultAppStartTimeoutInSeconds
+	}
+	return timeout
+}
+
+// trackAppRunning waits for a started app to stage, if it needs to, and then
+// for every instance of it to be running, failing if one crashes or the app
+// is not running within rest:start-timeout seconds; an app which has already
+// staged, e.g. when it is restarted, does not stage again
+func (r *rest) trackAppRunning(ctx context.Context, appUri string) error {
+	deadline := appStartDeadline(ctx)
+	return r.trackAppStart(ctx, appUri, deadline, func() error {
+		return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+			apiEndpoint, _ := ctx.GetString("apiEndpoint")
+			for {
+				instances := make(map[string]struct {
+					State string `json:"state"`
+				})
+				reply := r.client.Get(token, fmt.Sprintf("%s%s/instances", apiEndpoint, appUri), nil, &instances)
+				if reply.Code >= 400 {
+					return fmt.Errorf("Could not read the app's instances: %s", reply.Message)
+				}
+
+				running, starting := 0, 0
+				for _, instance := range instances {
+					switch instance.State {
+					case "RUNNING":
+						running++
+					case "CRASHED", "FLAPPING":
+						return errors.New("App instance crashed while starting")
+					case "":
+						// not an instance
+					default:
+						starting++
+					}
+				}
+				if running > 0 && starting == 0 {
+					return nil
+				}
+
+				if time.Now().After(deadline) {
+					return fmt.Errorf("App did not start within %d seconds", appStartTimeout(ctx))
+				}
+				time.Sleep(AppStartPollInterval)
+			}
+		})
+	})
+}
+
+func (r *rest) trackAppStart(ctx context.Context, appUri string, deadline time.Time, then func() error) error {
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
 		apiEndpoint, _ := ctx.GetString("apiEndpoint")
 		for {
 			decoded := make(map[string]interface{})
@@ -152,17 +250,20 @@ func (r *rest) trackAppStart(ctx context.Context, appUri string) error {
 				break
 			}
 
-			time.Sleep(2 * time.Second)
+			if time.Now().After(deadline) {
+				return fmt.Errorf("App did not stage within %d seconds", appStartTimeout(ctx))
+			}
+			time.Sleep(AppStartPollInterval)
 		}
 
-		return nil
+		return then()
 	})
 }
 
-func withGeneratedAppBits(fn func(b *bytes.Buffer, m *multipart.Writer) error) error {
+func withGeneratedAppBits(fieldName string, fn func(b *bytes.Buffer, m *multipart.Writer) error) error {
 	var b bytes.Buffer
 	multi := multipart.NewWriter(&b)
-	appbits, _ := multi.CreateFormFile("application", "app.zip")
+	appbits, _ := multi.CreateFormFile(fieldName, "app.zip")
 	zipper := zip.NewWriter(appbits)
 	configru, _ := zipper.Create("config.ru")
 	configru.Write([]byte("app = lambda do |env|\n body = 'Hello, World!'\n [200, { 'Content-Type' => 'text/plain', 'Content-Length' => body.length.to_s }, [body] ]\nend\n\nrun app"))
@@ -178,19 +279,27 @@ func withGeneratedAppBits(fn func(b *bytes.Buffer, m *multipart.Writer) error) e
 	return fn(&b, multi)
 }
 
-func (r *rest) createAppSuccessfully(ctx context.Context, thenWithLocation func(appUri string) error) error {
+func (r *rest) createAppSuccessfully(ctx context.Context, thenWithLocation func(appName string, appUri string) error) error {
 	apiEndpoint, _ := ctx.GetString("apiEndpoint")
 	space_guid, _ := ctx.GetString("space_guid")
 
+	memory, instances, buildpack, err := appSettings(ctx)
+	if err != nil {
+		return err
+	}
+
 	uuid, _ := uuid.NewV4()
 	createApp := struct {
 		Name      string `json:"name"`
 		SpaceGuid string `json:"space_guid"`
-	}{uuid.String(), space_guid}
+		Memory    int    `json:"memory,omitempty"`
+		Instances int    `json:"instances,omitempty"`
+		Buildpack string `json:"buildpack,omitempty"`
+	}{uuid.String(), space_guid, memory, instances, buildpack}
 
-	return checkLoggedIn(ctx, func(token string) error {
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
 		return r.PostSuccessfully(token, fmt.Sprintf("%s/v2/apps", apiEndpoint), createApp, nil, func(reply Reply) error {
-			return thenWithLocation(reply.Location)
+			return thenWithLocation(createApp.Name, reply.Location)
 		})
 	})
 }
@@ -203,15 +312,6 @@ func checkSpaceExists(s *SpaceResponse, then func() error) error {
 	return then()
 }
 
-func checkLoggedIn(ctx context.Context, then func(token string) error) error {
-	if _, exists := ctx.GetString("token"); !exists {
-		return errors.New("Error: not logged in")
-	}
-
-	token, _ := ctx.GetString("token")
-	return then(token)
-}
-
 func checkTargetted(ctx context.Context, then func(loginEndpoint string, apiEndpoint string) error) error {
 	if _, exists := ctx.GetString("loginEndpoint"); !exists {
 		return errors.New("Not targetted")
@@ -234,9 +334,18 @@ func checkSuccessfulReply(reply Reply, then func() error) error {
 	return then()
 }
 
+type httpError struct {
+	Code    int
+	Message string
+}
+
+func (e httpError) Error() string {
+	return e.Message
+}
+
 func (r Reply) checkError() error {
 	if r.Code > 399 {
-		return errors.New(r.Message)
+		return httpError{r.Code, r.Message}
 	}
 
 	return nil
@@ -245,20 +354,3 @@ func (r Reply) checkError() error {
 func (s SpaceResponse) SpaceExists() bool {
 	return len(s.Resources) > 0
 }
-
-func credentialsForWorker(iterationIndex int, users string, passwords string) (string, string) {
-	var userList = strings.Split(users, ",")
-	var passList = strings.Split(passwords, ",")
-	return userList[iterationIndex%len(userList)], passList[iterationIndex%len(passList)]
-}
-
-func (r *rest) oauthInputs(username string, password string) url.Values {
-
-	values := make(url.Values)
-	values.Add("grant_type", "password")
-	values.Add("username", username)
-	values.Add("password", password)
-	values.Add("scope", "")
-
-	return values
-}
@@ -1,10 +1,19 @@
 package workloads_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"mime/multipart"
+	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/context"
@@ -17,6 +26,7 @@ type workloads interface {
 	Target(ctx context.Context) error
 	Login(ctx context.Context) error
 	Push(ctx context.Context) error
+	FirstRequest(ctx context.Context) error
 }
 
 var restArgs = struct {
@@ -50,7 +60,7 @@ var _ = Describe("Rest", func() {
 			PopulateRestContext(restArgs.target, restArgs.username, restArgs.password, restArgs.space, restContext)
 			args = []string{"-rest:target", "APISERVER"}
 
-			replies["APISERVER/v2/info"] = TargetResponse{"THELOGINSERVER/PATH"}
+			replies["APISERVER/v2/info"] = TargetResponse{LoginEndpoint: "THELOGINSERVER/PATH"}
 		})
 
 		Describe("Pushing an app", func() {
@@ -63,7 +73,7 @@ var _ = Describe("Rest", func() {
 
 			Context("After logging in", func() {
 				BeforeEach(func() {
-					replies["THELOGINSERVER/PATH/oauth/token"] = LoginResponse{"blah blah"}
+					replies["THELOGINSERVER/PATH/oauth/token"] = LoginResponse{Token: "blah blah"}
 
 					spaceReply := SpaceResponse{[]Resource{Resource{Metadata{"blah blah"}}}}
 					replies["APISERVER/v2/spaces?q=name:dev"] = spaceReply
@@ -71,6 +81,9 @@ var _ = Describe("Rest", func() {
 					replyWithLocation["APISERVER/v2/apps"] = "/THE-APP-URI"
 					replies["APISERVER/THE-APP-URI"] = ""
 					replies["APISERVER/THE-APP-URI/bits"] = ""
+					replies["APISERVER/v2/shared_domains?results-per-page=1"] = DomainsResponse{[]Resource{Resource{Metadata{"DOMAIN-GUID"}}}}
+					replies["APISERVER/v2/routes"] = Resource{Metadata{"ROUTE-GUID"}}
+					replies["APISERVER/v2/routes/ROUTE-GUID/apps/THE-APP-URI"] = ""
 
 					err := rest.Target(restContext)
 					Ω(err).ShouldNot(HaveOccurred())
@@ -92,18 +105,133 @@ var _ = Describe("Rest", func() {
 					Ω(m["space_guid"]).Should(Equal("blah blah"))
 				})
 
+				It("Records the app's name in the context", func() {
+					rest.Push(restContext)
+					m := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/apps"))
+					appNames, _ := restContext.GetString("appNames")
+					Ω(appNames).Should(Equal(m["name"]))
+				})
+
+				It("Tracks the app's guid in the context", func() {
+					rest.Push(restContext)
+					appGuids, _ := restContext.GetString("appGuids")
+					Ω(appGuids).Should(Equal("THE-APP-URI"))
+				})
+
+				It("Times each phase of the push", func() {
+					TakePhases(restContext)
+					rest.Push(restContext)
+					phases := TakePhases(restContext)
+					Ω(phases).Should(HaveLen(5))
+					Ω(phases[0].Name).Should(Equal("create"))
+					Ω(phases[1].Name).Should(Equal("route"))
+					Ω(phases[2].Name).Should(Equal("upload"))
+					Ω(phases[3].Name).Should(Equal("start"))
+					Ω(phases[4].Name).Should(Equal("staging"))
+				})
+
+				It("Maps a route named after the app in the first shared domain", func() {
+					rest.Push(restContext)
+					app := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/apps"))
+					route := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/routes"))
+					Ω(route["host"]).Should(Equal(app["name"]))
+					Ω(route["domain_guid"]).Should(Equal("DOMAIN-GUID"))
+					Ω(route["space_guid"]).Should(Equal("blah blah"))
+					client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/routes/ROUTE-GUID/apps/THE-APP-URI")
+				})
+
+				It("Lets app:firstRequest request the app on its route", func() {
+					replies["APISERVER/v2/apps/THE-APP-URI/routes?inline-relations-depth=1"] = routesTo("pushed-app", "apps.example.com")
+					replies["http://pushed-app.apps.example.com/"] = ""
+
+					Ω(rest.Push(restContext)).Should(BeNil())
+					Ω(rest.FirstRequest(restContext)).Should(BeNil())
+					client.ShouldHaveBeenCalledWith("GET", "http://pushed-app.apps.example.com/")
+				})
+
 				It("Uploads app bits", func() {
 					rest.Push(restContext)
 					data := client.ShouldHaveBeenCalledWith("PUT(multipart)", "APISERVER/THE-APP-URI/bits")
 					Ω(data).ShouldNot(BeNil())
 				})
 
+				It("Counts the bytes uploaded", func() {
+					TakeMetrics(restContext)
+					rest.Push(restContext)
+					metrics := TakeMetrics(restContext)
+					Ω(metrics).Should(HaveLen(1))
+					Ω(metrics[0].Name).Should(Equal("bytes-uploaded"))
+					Ω(metrics[0].Kind).Should(Equal(CounterMetric))
+					Ω(metrics[0].Value).Should(BeNumerically(">", 0))
+				})
+
 				It("Starts the app", func() {
 					rest.Push(restContext)
 					data := mapOf(client.ShouldHaveBeenCalledWith("PUT", "APISERVER/THE-APP-URI"))
 					Ω(data["state"]).Should(Equal("STARTED"))
 				})
 
+				Context("When an app directory is configured", func() {
+					var appDir string
+
+					BeforeEach(func() {
+						appDir, _ = ioutil.TempDir("", "pat-app")
+						ioutil.WriteFile(filepath.Join(appDir, "index.html"), []byte("hello"), 0644)
+						ioutil.WriteFile(filepath.Join(appDir, "debug.log"), []byte("noise"), 0644)
+						ioutil.WriteFile(filepath.Join(appDir, ".cfignore"), []byte("*.log\n"), 0644)
+						os.Mkdir(filepath.Join(appDir, "public"), 0755)
+						ioutil.WriteFile(filepath.Join(appDir, "public", "app.js"), []byte("app"), 0644)
+						ioutil.WriteFile(filepath.Join(appDir, "manifest.yml"), []byte("---\napplications:\n- name: foo\n  memory: 1G\n  instances: 3\n  buildpack: staticfile_buildpack\n"), 0644)
+						restContext.PutString("app", appDir)
+					})
+
+					AfterEach(func() {
+						os.RemoveAll(appDir)
+					})
+
+					It("Creates the app with 64M of memory without a manifest, like cf:push", func() {
+						rest.Push(restContext)
+						m := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/apps"))
+						Ω(m["memory"]).Should(BeEquivalentTo(64))
+					})
+
+					It("Uploads the directory, respecting .cfignore", func() {
+						err := rest.Push(restContext)
+						Ω(err).ShouldNot(HaveOccurred())
+						data := client.ShouldHaveBeenCalledWith("PUT(multipart)", "APISERVER/THE-APP-URI/bits")
+						Ω(zippedFiles(data.(*bytes.Buffer))).Should(Equal([]string{"index.html", "public/app.js"}))
+					})
+
+					Context("And a manifest", func() {
+						BeforeEach(func() {
+							restContext.PutString("app:manifest", filepath.Join(appDir, "manifest.yml"))
+						})
+
+						It("Creates the app with the manifest's settings", func() {
+							rest.Push(restContext)
+							m := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/apps"))
+							Ω(m["memory"]).Should(BeEquivalentTo(1024))
+							Ω(m["instances"]).Should(BeEquivalentTo(3))
+							Ω(m["buildpack"]).Should(Equal("staticfile_buildpack"))
+						})
+					})
+
+					Context("And resource matching is enabled", func() {
+						BeforeEach(func() {
+							PopulatePushContext(true, restContext)
+							// sha1 of "hello"
+							replies["APISERVER/v2/resource_match"] = []map[string]interface{}{{"sha1": "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", "size": 5}}
+						})
+
+						It("Only uploads the files the Cloud Controller does not already have", func() {
+							err := rest.Push(restContext)
+							Ω(err).ShouldNot(HaveOccurred())
+							data := client.ShouldHaveBeenCalledWith("PUT(multipart)", "APISERVER/THE-APP-URI/bits")
+							Ω(zippedFiles(data.(*bytes.Buffer))).Should(Equal([]string{"public/app.js"}))
+						})
+					})
+				})
+
 				Context("When the app starts immediately", func() {
 					It("Doesn't return any error", func() {
 						replies["APISERVER/THE-APP-URI/instances"] = "foo" // return a 200
@@ -336,6 +464,12 @@ func (d *dummyClient) ShouldHaveBeenCalledWith(method string, path string) inter
 	return d.calls[call{method, path}]
 }
 
+func routesTo(host string, domain string) RoutesResponse {
+	return RoutesResponse{[]RouteResource{
+		RouteResource{Metadata{"ROUTE-GUID"}, RouteEntity{host, "", NamedResource{Metadata{"DOMAIN-GUID"}, NamedEntity{domain}}}},
+	}}
+}
+
 func (d *dummyClient) Req(method string, host string, data interface{}, s interface{}) (reply Reply) {
 	resp := `{"authorization_endpoint":"10.244.0.34.xip.io","access_token":"token","guid":"123456789","metadata":{"guid":"123456789"},"resources":[{"metadata":{"guid":"123456789"}}]}`
 
@@ -348,11 +482,34 @@ func (d *dummyClient) Req(method string, host string, data interface{}, s interf
 	if d.replies[host] == nil {
 		return Reply{400, "Some error", ""}
 	}
+	if reply, ok := d.replies[host].(Reply); ok {
+		return reply
+	}
 	b, _ := json.Marshal(d.replies[host])
 	json.NewDecoder(bytes.NewReader(b)).Decode(s)
 	return Reply{200, "Success", ""}
 }
 
+type request struct {
+	headers http.Header
+	body    string
+}
+
+func (d *dummyClient) Request(method string, host string, headers http.Header, data io.Reader, timeout time.Duration, s interface{}) (reply Reply) {
+	var body []byte
+	if data != nil {
+		body, _ = ioutil.ReadAll(data)
+	}
+	d.calls[call{method, host}] = request{headers, string(body)}
+	if d.replies[host] == nil {
+		return Reply{400, "400 Bad Request", ""}
+	}
+	if raw, ok := s.(*[]byte); ok {
+		*raw, _ = json.Marshal(d.replies[host])
+	}
+	return Reply{200, "200 OK", ""}
+}
+
 func (d *dummyClient) Get(token string, host string, data interface{}, s interface{}) (reply Reply) {
 	return d.Req("GET", host, data, s)
 }
@@ -369,10 +526,37 @@ func (d *dummyClient) Post(token string, host string, data interface{}, s interf
 	return d.Req("POST", host, data, s)
 }
 
-func (d *dummyClient) PostToUaa(host string, data url.Values, s interface{}) (reply Reply) {
+func (d *dummyClient) Delete(token string, host string, data interface{}, s interface{}) (reply Reply) {
+	return d.Req("DELETE", host, data, s)
+}
+
+func (d *dummyClient) Patch(token string, host string, data interface{}, s interface{}) (reply Reply) {
+	return d.Req("PATCH", host, data, s)
+}
+
+func (d *dummyClient) MultipartPost(token string, m *multipart.Writer, host string, data *bytes.Buffer, s interface{}) (reply Reply) {
+	return d.Req("POST(multipart)", host, data, s)
+}
+
+func (d *dummyClient) PostToUaa(host string, clientId string, clientSecret string, data url.Values, s interface{}) (reply Reply) {
+	d.calls[call{"POST(uaa client)", host}] = clientId + ":" + clientSecret
 	return d.Req("POST(uaa)", host, data, s)
 }
 
+func zippedFiles(b *bytes.Buffer) []string {
+	boundary := strings.TrimSpace(strings.TrimPrefix(strings.SplitN(b.String(), "\n", 2)[0], "--"))
+	part, _ := multipart.NewReader(bytes.NewReader(b.Bytes()), boundary).NextPart()
+	contents, _ := ioutil.ReadAll(part)
+	zipped, _ := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+
+	names := make([]string, 0)
+	for _, f := range zipped.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func mapOf(data interface{}) map[string]interface{} {
 	d, _ := json.Marshal(data)
 	m := make(map[string]interface{})
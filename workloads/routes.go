@@ -0,0 +1,188 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/nu7hatch/gouuid"
+)
+
+const DefaultRoutesPerPage = 50
+
+func PopulateRoutesContext(routesPerPage int, ctx context.Context) {
+	ctx.PutInt("rest:routes-per-page", routesPerPage)
+}
+
+func (r *rest) CreateRoute(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	spaceGuid, _ := ctx.GetString("space_guid")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		return r.domainGuid(ctx, token, func(domainGuid string) error {
+			host, _ := uuid.NewV4()
+			createRoute := struct {
+				Host       string `json:"host"`
+				DomainGuid string `json:"domain_guid"`
+				SpaceGuid  string `json:"space_guid"`
+			}{"pats-" + host.String(), domainGuid, spaceGuid}
+
+			created := &Resource{}
+			return r.PostSuccessfully(token, fmt.Sprintf("%s/v2/routes", apiEndpoint), createRoute, created, func(reply Reply) error {
+				appendToList(ctx, "routeGuids", created.Metadata.Guid)
+				recordResource(ctx, LedgerRoute, created.Metadata.Guid)
+				return nil
+			})
+		})
+	})
+}
+
+// mapAppRoute creates a route for an app pushed by rest:push, named after
+// the app as the CF command-line's default route is, and maps it to the app
+func (r *rest) mapAppRoute(ctx context.Context, appName string, appGuid string) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	spaceGuid, _ := ctx.GetString("space_guid")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		return r.domainGuid(ctx, token, func(domainGuid string) error {
+			createRoute := struct {
+				Host       string `json:"host"`
+				DomainGuid string `json:"domain_guid"`
+				SpaceGuid  string `json:"space_guid"`
+			}{appName, domainGuid, spaceGuid}
+
+			created := &Resource{}
+			return r.PostSuccessfully(token, fmt.Sprintf("%s/v2/routes", apiEndpoint), createRoute, created, func(reply Reply) error {
+				recordResource(ctx, LedgerRoute, created.Metadata.Guid)
+				ctx.PutString("appRoute:"+appGuid, created.Metadata.Guid)
+				return r.PutSuccessfully(token, fmt.Sprintf("%s/v2/routes/%s/apps/%s", apiEndpoint, created.Metadata.Guid, appGuid), nil, nil, func(reply Reply) error {
+					return nil
+				})
+			})
+		})
+	})
+}
+
+// deleteAppRoute deletes the route rest:push mapped to an app, if any
+func (r *rest) deleteAppRoute(ctx context.Context, token string, appGuid string) error {
+	routeGuid, ok := ctx.GetString("appRoute:" + appGuid)
+	if !ok {
+		return nil
+	}
+
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	return r.DeleteSuccessfully(token, fmt.Sprintf("%s/v2/routes/%s", apiEndpoint, routeGuid), nil, nil, func(reply Reply) error {
+		ctx.Delete("appRoute:" + appGuid)
+		forgetResource(ctx, LedgerRoute, routeGuid)
+		return nil
+	})
+}
+
+func (r *rest) MapRoute(ctx context.Context) error {
+	return r.withLastRouteAndApp(ctx, func(token string, routeAppUri string) error {
+		return r.PutSuccessfully(token, routeAppUri, nil, nil, func(reply Reply) error {
+			return nil
+		})
+	})
+}
+
+func (r *rest) UnmapRoute(ctx context.Context) error {
+	return r.withLastRouteAndApp(ctx, func(token string, routeAppUri string) error {
+		return r.DeleteSuccessfully(token, routeAppUri, nil, nil, func(reply Reply) error {
+			return nil
+		})
+	})
+}
+
+func (r *rest) DeleteRoute(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		routeGuid, ok := lastInList(ctx, "routeGuids")
+		if !ok {
+			return errors.New("No route created with rest:create-route")
+		}
+
+		return r.DeleteSuccessfully(token, fmt.Sprintf("%s/v2/routes/%s", apiEndpoint, routeGuid), nil, nil, func(reply Reply) error {
+			removeFromList(ctx, "routeGuids", routeGuid)
+			forgetResource(ctx, LedgerRoute, routeGuid)
+			return nil
+		})
+	})
+}
+
+func (r *rest) ListRoutes(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	perPage, _ := ctx.GetInt("rest:routes-per-page")
+	if perPage <= 0 {
+		perPage = DefaultRoutesPerPage
+	}
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		return r.eachPage(token, apiEndpoint, fmt.Sprintf("/v2/routes?results-per-page=%d", perPage), func(page *PageResponse) error {
+			return nil
+		})
+	})
+}
+
+// eachPage follows a Cloud Controller listing's next_url until the last page
+func (r *rest) eachPage(token string, apiEndpoint string, pageUri string, fn func(page *PageResponse) error) error {
+	for pageUri != "" {
+		page := &PageResponse{}
+		err := r.GetSuccessfully(token, apiEndpoint+pageUri, nil, page, func(reply Reply) error {
+			return fn(page)
+		})
+		if err != nil {
+			return err
+		}
+		pageUri = page.NextUrl
+	}
+
+	return nil
+}
+
+func (r *rest) withLastRouteAndApp(ctx context.Context, then func(token string, routeAppUri string) error) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		routeGuid, ok := lastInList(ctx, "routeGuids")
+		if !ok {
+			return errors.New("No route created with rest:create-route")
+		}
+		appGuid, ok := lastInList(ctx, "appGuids")
+		if !ok {
+			return errors.New("No app pushed with rest:push")
+		}
+
+		return then(token, fmt.Sprintf("%s/v2/routes/%s/apps/%s", apiEndpoint, routeGuid, appGuid))
+	})
+}
+
+// domainGuid looks up the shared domain routes are created in once per
+// worker: the app:domain, or the first shared domain, as the CF command-line
+// uses by default
+func (r *rest) domainGuid(ctx context.Context, token string, then func(domainGuid string) error) error {
+	if domainGuid, _ := ctx.GetString("domainGuid"); domainGuid != "" {
+		return then(domainGuid)
+	}
+
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	domain, _ := ctx.GetString("app:domain")
+	query := "results-per-page=1"
+	if domain != "" {
+		query = "q=name:" + domain
+	}
+
+	domains := &DomainsResponse{}
+	return r.GetSuccessfully(token, fmt.Sprintf("%s/v2/shared_domains?%s", apiEndpoint, query), nil, domains, func(reply Reply) error {
+		if len(domains.Resources) == 0 {
+			if domain == "" {
+				return errors.New("No shared domain found")
+			}
+			return fmt.Errorf("No shared domain found with name '%s'", domain)
+		}
+
+		ctx.PutString("domainGuid", domains.Resources[0].Metadata.Guid)
+		return then(domains.Resources[0].Metadata.Guid)
+	})
+}
@@ -0,0 +1,105 @@
+package workloads_test
+
+import (
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST route workloads", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		ctx.PutString("token", "TOKEN")
+		ctx.PutString("apiEndpoint", "APISERVER")
+		ctx.PutString("space_guid", "SPACE-GUID")
+		PopulateRouteContext("example.com", 1, ctx)
+	})
+
+	Describe("Creating a route", func() {
+		BeforeEach(func() {
+			replies["APISERVER/v2/shared_domains?q=name:example.com"] = DomainsResponse{[]Resource{Resource{Metadata{"DOMAIN-GUID"}}}}
+			replies["APISERVER/v2/routes"] = Resource{Metadata{"ROUTE-GUID"}}
+		})
+
+		It("creates a route in the app domain and tracks its guid", func() {
+			err := NewRestWorkloadWithClient(client).CreateRoute(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/routes"))
+			Ω(data["domain_guid"]).Should(Equal("DOMAIN-GUID"))
+			Ω(data["space_guid"]).Should(Equal("SPACE-GUID"))
+			Ω(data).Should(HaveKey("host"))
+			guids, _ := ctx.GetString("routeGuids")
+			Ω(guids).Should(Equal("ROUTE-GUID"))
+		})
+
+		Context("When the domain does not exist", func() {
+			BeforeEach(func() {
+				replies["APISERVER/v2/shared_domains?q=name:example.com"] = DomainsResponse{[]Resource{}}
+			})
+
+			It("returns an error", func() {
+				err := NewRestWorkloadWithClient(client).CreateRoute(ctx)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Mapping, unmapping and deleting routes", func() {
+		BeforeEach(func() {
+			ctx.PutString("routeGuids", "ROUTE-GUID")
+			ctx.PutString("appGuids", "APP-GUID")
+			replies["APISERVER/v2/routes/ROUTE-GUID/apps/APP-GUID"] = ""
+			replies["APISERVER/v2/routes/ROUTE-GUID"] = ""
+		})
+
+		It("maps the most recent route to the most recent app", func() {
+			err := NewRestWorkloadWithClient(client).MapRoute(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("PUT", "APISERVER/v2/routes/ROUTE-GUID/apps/APP-GUID")
+		})
+
+		It("unmaps the most recent route from the most recent app", func() {
+			err := NewRestWorkloadWithClient(client).UnmapRoute(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/routes/ROUTE-GUID/apps/APP-GUID")
+		})
+
+		It("deletes the most recent route and stops tracking it", func() {
+			err := NewRestWorkloadWithClient(client).DeleteRoute(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/routes/ROUTE-GUID")
+			guids, _ := ctx.GetString("routeGuids")
+			Ω(guids).Should(BeEmpty())
+		})
+
+		It("returns an error when no app has been pushed", func() {
+			ctx.PutString("appGuids", "")
+			err := NewRestWorkloadWithClient(client).MapRoute(ctx)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Listing routes", func() {
+		BeforeEach(func() {
+			PopulateRoutesContext(2, ctx)
+			replies["APISERVER/v2/routes?results-per-page=2"] = PageResponse{3, "/v2/routes?page=2&results-per-page=2", []Resource{Resource{Metadata{"A"}}, Resource{Metadata{"B"}}}}
+			replies["APISERVER/v2/routes?page=2&results-per-page=2"] = PageResponse{3, "", []Resource{Resource{Metadata{"C"}}}}
+		})
+
+		It("follows every page", func() {
+			err := NewRestWorkloadWithClient(client).ListRoutes(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("GET", "APISERVER/v2/routes?results-per-page=2")
+			client.ShouldHaveBeenCalledWith("GET", "APISERVER/v2/routes?page=2&results-per-page=2")
+		})
+	})
+})
@@ -0,0 +1,234 @@
+package workloads
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"launchpad.net/goyaml"
+)
+
+// Scenario is a scenario file compiled into the workload lists an experiment runs
+type Scenario struct {
+	Setup      string
+	SetupScope string
+	Workload   string
+	Teardown   string
+}
+
+type scenarioFile struct {
+	Variables  map[string]interface{} `yaml:"variables"`
+	SetupScope string                 `yaml:"setup-scope"`
+	Setup      []interface{}          `yaml:"setup"`
+	Iteration  []interface{}          `yaml:"iteration"`
+	Teardown   []interface{}          `yaml:"teardown"`
+}
+
+func LoadScenario(path string) (Scenario, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Scenario{}, err
+	}
+	return ParseScenario(contents)
+}
+
+// ParseScenario compiles the setup, iteration and teardown steps of a scenario
+// into workload lists, expanding $variables, repeats and conditions; weighted
+// choices between flows become random(...) steps, chosen on each iteration
+func ParseScenario(contents []byte) (Scenario, error) {
+	file := scenarioFile{}
+	if err := goyaml.Unmarshal(contents, &file); err != nil {
+		return Scenario{}, err
+	}
+	if len(file.Iteration) == 0 {
+		return Scenario{}, fmt.Errorf("scenario has no iteration steps")
+	}
+
+	c := scenarioCompiler{make(map[string]string)}
+	for k, v := range file.Variables {
+		c.variables[k] = fmt.Sprint(v)
+	}
+
+	var scenario Scenario
+	var err error
+	if scenario.Setup, err = c.steps(file.Setup); err != nil {
+		return scenario, err
+	}
+	if scenario.Workload, err = c.steps(file.Iteration); err != nil {
+		return scenario, err
+	}
+	if scenario.Teardown, err = c.steps(file.Teardown); err != nil {
+		return scenario, err
+	}
+	scenario.SetupScope, err = c.expand(file.SetupScope)
+	return scenario, err
+}
+
+type scenarioCompiler struct {
+	variables map[string]string
+}
+
+func (c scenarioCompiler) steps(entries []interface{}) (string, error) {
+	steps := make([]string, 0)
+	for _, entry := range entries {
+		compiled, err := c.step(entry)
+		if err != nil {
+			return "", err
+		}
+		steps = append(steps, compiled...)
+	}
+	return strings.Join(steps, ","), nil
+}
+
+func (c scenarioCompiler) step(entry interface{}) ([]string, error) {
+	if text, ok := entry.(string); ok {
+		expanded, err := c.expand(text)
+		return []string{expanded}, err
+	}
+
+	fields, err := stringKeys(entry)
+	if err != nil {
+		return nil, err
+	}
+	for k, _ := range fields {
+		if k != "step" && k != "with" && k != "repeat" && k != "if" && k != "choose" {
+			return nil, fmt.Errorf("unknown scenario step field '%s'", k)
+		}
+	}
+
+	if condition, ok := fields["if"]; ok {
+		value, err := c.expand(fmt.Sprint(condition))
+		if err != nil {
+			return nil, err
+		}
+		if value == "" || value == "false" || value == "no" || value == "0" {
+			return []string{}, nil
+		}
+	}
+
+	var text string
+	if choices, ok := fields["choose"]; ok {
+		text, err = c.choose(choices)
+	} else {
+		text, err = c.call(fields)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	repeat := 1
+	if r, ok := fields["repeat"]; ok {
+		expanded, err := c.expand(fmt.Sprint(r))
+		if err != nil {
+			return nil, err
+		}
+		if repeat, err = strconv.Atoi(expanded); err != nil {
+			return nil, fmt.Errorf("repeat of %s is not a number: %s", text, expanded)
+		}
+	}
+
+	compiled := make([]string, 0, repeat)
+	for i := 0; i < repeat; i++ {
+		compiled = append(compiled, text)
+	}
+	return compiled, nil
+}
+
+func (c scenarioCompiler) call(fields map[string]interface{}) (string, error) {
+	name, ok := fields["step"].(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("scenario step needs a 'step' name")
+	}
+	name, err := c.expand(name)
+	if err != nil {
+		return "", err
+	}
+
+	with, ok := fields["with"]
+	if !ok {
+		return name, nil
+	}
+	arguments, err := stringKeys(with)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(arguments))
+	for k, _ := range arguments {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, k := range names {
+		value, err := c.expand(fmt.Sprint(arguments[k]))
+		if err != nil {
+			return "", err
+		}
+		if strings.ContainsAny(value, ",()| ") {
+			return "", fmt.Errorf("argument %s of %s cannot contain commas, brackets, '|' or spaces: %s", k, name, value)
+		}
+		pairs = append(pairs, k+"="+value)
+	}
+	return name + "(" + strings.Join(pairs, ",") + ")", nil
+}
+
+func (c scenarioCompiler) choose(choices interface{}) (string, error) {
+	list, ok := choices.([]interface{})
+	if !ok || len(list) == 0 {
+		return "", fmt.Errorf("'choose' needs a list of weighted flows")
+	}
+
+	flows := make([]string, 0, len(list))
+	for _, choice := range list {
+		fields, err := stringKeys(choice)
+		if err != nil {
+			return "", err
+		}
+
+		weight, err := strconv.Atoi(fmt.Sprint(fields["weight"]))
+		if err != nil || weight <= 0 {
+			return "", fmt.Errorf("flow weights must be positive numbers, got %v", fields["weight"])
+		}
+
+		entries, _ := fields["steps"].([]interface{})
+		steps, err := c.steps(entries)
+		if err != nil {
+			return "", err
+		}
+		if steps == "" {
+			return "", fmt.Errorf("flow with weight %d has no steps", weight)
+		}
+		flows = append(flows, fmt.Sprintf("%d:%s", weight, steps))
+	}
+	return RandomStep + "(" + strings.Join(flows, "|") + ")", nil
+}
+
+// expand replaces $name and ${name} with the scenario's variables
+func (c scenarioCompiler) expand(text string) (string, error) {
+	var missing error
+	expanded := os.Expand(text, func(name string) string {
+		value, ok := c.variables[name]
+		if !ok {
+			missing = fmt.Errorf("undefined scenario variable '%s'", name)
+		}
+		return value
+	})
+	return expanded, missing
+}
+
+func stringKeys(entry interface{}) (map[string]interface{}, error) {
+	m, ok := entry.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map in scenario, got %v", entry)
+	}
+
+	fields := make(map[string]interface{})
+	for k, v := range m {
+		fields[fmt.Sprint(k)] = v
+	}
+	return fields, nil
+}
@@ -0,0 +1,89 @@
+package workloads_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scenario files", func() {
+	It("compiles the phases of a scenario into workload lists", func() {
+		scenario, err := ParseScenario([]byte(`
+variables:
+  memory: 256M
+  scale: true
+setup-scope: experiment
+setup:
+  - rest:target
+  - rest:login
+iteration:
+  - rest:push
+  - step: cf:push
+    with: {memory: $memory, instances: 2}
+    repeat: 2
+  - step: rest:scale
+    if: $scale
+  - choose:
+      - weight: 70
+        steps:
+          - cf:push
+          - cf:delete
+      - weight: 30
+        steps:
+          - step: rest:scale
+            with: {instances: 3}
+teardown:
+  - rest:delete
+`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(scenario.Setup).Should(Equal("rest:target,rest:login"))
+		Ω(scenario.SetupScope).Should(Equal("experiment"))
+		Ω(scenario.Workload).Should(Equal("rest:push,cf:push(instances=2,memory=256M),cf:push(instances=2,memory=256M),rest:scale,random(70:cf:push,cf:delete|30:rest:scale(instances=3))"))
+		Ω(scenario.Teardown).Should(Equal("rest:delete"))
+
+		_, err = ParseWorkload(scenario.Workload)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("leaves out steps whose condition is false", func() {
+		scenario, err := ParseScenario([]byte(`
+variables: {scale: false}
+iteration:
+  - rest:push
+  - step: rest:scale
+    if: $scale
+`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(scenario.Workload).Should(Equal("rest:push"))
+	})
+
+	It("rejects undefined variables", func() {
+		_, err := ParseScenario([]byte("iteration: [{step: 'cf:push', with: {memory: $memory}}]"))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("memory"))
+	})
+
+	It("rejects argument values that would break the workload list", func() {
+		_, err := ParseScenario([]byte("iteration: [{step: 'http:request', with: {url: 'a,b'}}]"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("rejects a scenario without iteration steps", func() {
+		_, err := ParseScenario([]byte("setup: ['rest:login']"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("loads a scenario from a file", func() {
+		f, _ := ioutil.TempFile("", "scenario")
+		defer os.Remove(f.Name())
+		f.WriteString("iteration:\n  - rest:push\n")
+		f.Close()
+
+		scenario, err := LoadScenario(f.Name())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(scenario.Workload).Should(Equal("rest:push"))
+	})
+})
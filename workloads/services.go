@@ -0,0 +1,187 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/nu7hatch/gouuid"
+)
+
+const DefaultServiceTimeoutInSeconds = 60 * 5
+
+var ServicePollInterval = 2 * time.Second
+
+func PopulateServiceContext(service string, plan string, timeoutInSeconds int, ctx context.Context) {
+	ctx.PutString("rest:service", service)
+	ctx.PutString("rest:service-plan", plan)
+	ctx.PutInt("rest:service-timeout", timeoutInSeconds)
+}
+
+func (r *rest) CreateService(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	spaceGuid, _ := ctx.GetString("space_guid")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		return r.servicePlanGuid(ctx, token, func(planGuid string) error {
+			name, _ := uuid.NewV4()
+			createService := struct {
+				Name            string `json:"name"`
+				SpaceGuid       string `json:"space_guid"`
+				ServicePlanGuid string `json:"service_plan_guid"`
+			}{"pats-" + name.String(), spaceGuid, planGuid}
+
+			created := &ServiceInstanceResponse{}
+			return r.PostSuccessfully(token, fmt.Sprintf("%s/v2/service_instances?accepts_incomplete=true", apiEndpoint), createService, created, func(reply Reply) error {
+				appendToList(ctx, "serviceInstanceGuids", created.Metadata.Guid)
+				recordResource(ctx, LedgerServiceInstance, created.Metadata.Guid)
+				return r.trackServiceOperation(ctx, token, created, false)
+			})
+		})
+	})
+}
+
+func (r *rest) BindService(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		serviceInstanceGuid, ok := lastInList(ctx, "serviceInstanceGuids")
+		if !ok {
+			return errors.New("No service created with rest:create-service")
+		}
+		appGuid, ok := lastInList(ctx, "appGuids")
+		if !ok {
+			return errors.New("No app pushed with rest:push")
+		}
+
+		bindService := struct {
+			ServiceInstanceGuid string `json:"service_instance_guid"`
+			AppGuid             string `json:"app_guid"`
+		}{serviceInstanceGuid, appGuid}
+
+		created := &Resource{}
+		return r.PostSuccessfully(token, fmt.Sprintf("%s/v2/service_bindings", apiEndpoint), bindService, created, func(reply Reply) error {
+			appendToList(ctx, "serviceBindingGuids", created.Metadata.Guid)
+			recordResource(ctx, LedgerServiceBinding, created.Metadata.Guid)
+			return nil
+		})
+	})
+}
+
+func (r *rest) UnbindService(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		bindingGuid, ok := lastInList(ctx, "serviceBindingGuids")
+		if !ok {
+			return errors.New("No service bound with rest:bind-service")
+		}
+
+		return r.DeleteSuccessfully(token, fmt.Sprintf("%s/v2/service_bindings/%s", apiEndpoint, bindingGuid), nil, nil, func(reply Reply) error {
+			removeFromList(ctx, "serviceBindingGuids", bindingGuid)
+			forgetResource(ctx, LedgerServiceBinding, bindingGuid)
+			return nil
+		})
+	})
+}
+
+func (r *rest) DeleteService(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		serviceInstanceGuid, ok := lastInList(ctx, "serviceInstanceGuids")
+		if !ok {
+			return errors.New("No service created with rest:create-service")
+		}
+
+		deleted := &ServiceInstanceResponse{}
+		return r.DeleteSuccessfully(token, fmt.Sprintf("%s/v2/service_instances/%s?accepts_incomplete=true", apiEndpoint, serviceInstanceGuid), nil, deleted, func(reply Reply) error {
+			deleted.Metadata.Guid = serviceInstanceGuid
+			if err := r.trackServiceOperation(ctx, token, deleted, true); err != nil {
+				return err
+			}
+
+			removeFromList(ctx, "serviceInstanceGuids", serviceInstanceGuid)
+			forgetResource(ctx, LedgerServiceInstance, serviceInstanceGuid)
+			return nil
+		})
+	})
+}
+
+// servicePlanGuid looks up the plan of the configured service offering once
+// per worker for each offering and plan, which steps' arguments can change
+func (r *rest) servicePlanGuid(ctx context.Context, token string, then func(planGuid string) error) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	service, _ := ctx.GetString("rest:service")
+	if service == "" {
+		return errors.New("argument rest:service does not exist")
+	}
+	plan, _ := ctx.GetString("rest:service-plan")
+	if plan == "" {
+		return errors.New("argument rest:service-plan does not exist")
+	}
+
+	cached := "servicePlanGuid:" + service + ":" + plan
+	if planGuid, _ := ctx.GetString(cached); planGuid != "" {
+		return then(planGuid)
+	}
+
+	services := &ServicesResponse{}
+	return r.GetSuccessfully(token, fmt.Sprintf("%s/v2/services?q=label:%s", apiEndpoint, service), nil, services, func(reply Reply) error {
+		if len(services.Resources) == 0 {
+			return fmt.Errorf("No service offering found with label '%s'", service)
+		}
+
+		plans := &ServicePlansResponse{}
+		return r.GetSuccessfully(token, fmt.Sprintf("%s/v2/services/%s/service_plans", apiEndpoint, services.Resources[0].Metadata.Guid), nil, plans, func(reply Reply) error {
+			for _, p := range plans.Resources {
+				if p.Entity.Name == plan {
+					ctx.PutString(cached, p.Metadata.Guid)
+					return then(p.Metadata.Guid)
+				}
+			}
+			return fmt.Errorf("No plan '%s' found for service '%s'", plan, service)
+		})
+	})
+}
+
+// trackServiceOperation waits for brokers which provision or deprovision
+// asynchronously, for at most rest:service-timeout seconds; a deprovisioned
+// instance is gone once the Cloud Controller no longer finds it
+func (r *rest) trackServiceOperation(ctx context.Context, token string, instance *ServiceInstanceResponse, deleting bool) error {
+	operation := "provision"
+	if deleting {
+		operation = "deprovision"
+	}
+
+	timeout, _ := ctx.GetInt("rest:service-timeout")
+	if timeout <= 0 {
+		timeout = DefaultServiceTimeoutInSeconds
+	}
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	instanceUri := fmt.Sprintf("%s/v2/service_instances/%s", apiEndpoint, instance.Metadata.Guid)
+	for instance.Entity.LastOperation.State == "in progress" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Service did not %s within %d seconds", operation, timeout)
+		}
+		time.Sleep(ServicePollInterval)
+
+		instance = &ServiceInstanceResponse{}
+		reply := r.client.Get(token, instanceUri, nil, instance)
+		if deleting && reply.Code == 404 {
+			return nil
+		}
+		if err := reply.checkError(); err != nil {
+			return err
+		}
+	}
+
+	if instance.Entity.LastOperation.State == "failed" {
+		return fmt.Errorf("Service failed to %s: %s", operation, instance.Entity.LastOperation.Description)
+	}
+
+	return nil
+}
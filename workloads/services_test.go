@@ -0,0 +1,169 @@
+package workloads_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST service workloads", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		ctx = context.New()
+		ctx.PutString("token", "TOKEN")
+		ctx.PutString("apiEndpoint", "APISERVER")
+		ctx.PutString("space_guid", "SPACE-GUID")
+		PopulateServiceContext("p-mysql", "100mb", 1, ctx)
+		ServicePollInterval = 10 * time.Millisecond
+	})
+
+	Describe("Creating a service", func() {
+		BeforeEach(func() {
+			replies["APISERVER/v2/services?q=label:p-mysql"] = ServicesResponse{[]Resource{Resource{Metadata{"SERVICE-GUID"}}}}
+			replies["APISERVER/v2/services/SERVICE-GUID/service_plans"] = ServicePlansResponse{[]NamedResource{
+				NamedResource{Metadata{"SMALL-PLAN-GUID"}, NamedEntity{"10mb"}},
+				NamedResource{Metadata{"PLAN-GUID"}, NamedEntity{"100mb"}},
+			}}
+			replies["APISERVER/v2/service_instances?accepts_incomplete=true"] = Resource{Metadata{"INSTANCE-GUID"}}
+		})
+
+		It("creates an instance of the configured plan in the targetted space", func() {
+			err := NewRestWorkloadWithClient(client).CreateService(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/service_instances?accepts_incomplete=true"))
+			Ω(data["service_plan_guid"]).Should(Equal("PLAN-GUID"))
+			Ω(data["space_guid"]).Should(Equal("SPACE-GUID"))
+		})
+
+		It("tracks the instance's guid in the context", func() {
+			NewRestWorkloadWithClient(client).CreateService(ctx)
+			guids, _ := ctx.GetString("serviceInstanceGuids")
+			Ω(guids).Should(Equal("INSTANCE-GUID"))
+		})
+
+		It("looks up the plan again when a step asks for another one", func() {
+			rest := NewRestWorkloadWithClient(client)
+			Ω(rest.CreateService(ctx)).Should(BeNil())
+			PopulateServiceContext("p-mysql", "10mb", 1, ctx)
+			Ω(rest.CreateService(ctx)).Should(BeNil())
+			data := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/service_instances?accepts_incomplete=true"))
+			Ω(data["service_plan_guid"]).Should(Equal("SMALL-PLAN-GUID"))
+		})
+
+		Context("When the plan does not exist", func() {
+			BeforeEach(func() {
+				PopulateServiceContext("p-mysql", "1gb", 1, ctx)
+			})
+
+			It("returns an error", func() {
+				err := NewRestWorkloadWithClient(client).CreateService(ctx)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("When the broker fails to provision", func() {
+			BeforeEach(func() {
+				replies["APISERVER/v2/service_instances?accepts_incomplete=true"] = ServiceInstanceResponse{Metadata{"INSTANCE-GUID"}, ServiceInstanceEntity{LastOperation{"failed", "out of capacity"}}}
+			})
+
+			It("returns an error", func() {
+				err := NewRestWorkloadWithClient(client).CreateService(ctx)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("When the broker never finishes provisioning", func() {
+			BeforeEach(func() {
+				inProgress := ServiceInstanceResponse{Metadata{"INSTANCE-GUID"}, ServiceInstanceEntity{LastOperation{"in progress", ""}}}
+				replies["APISERVER/v2/service_instances?accepts_incomplete=true"] = inProgress
+				replies["APISERVER/v2/service_instances/INSTANCE-GUID"] = inProgress
+			})
+
+			It("returns an error once rest:service-timeout passes", func() {
+				err := NewRestWorkloadWithClient(client).CreateService(ctx)
+				Ω(err).Should(HaveOccurred())
+				Ω(err.Error()).Should(ContainSubstring("1 seconds"))
+			})
+		})
+	})
+
+	Describe("Binding a service", func() {
+		It("returns an error when no service has been created", func() {
+			ctx.PutString("appGuids", "APP-GUID")
+			err := NewRestWorkloadWithClient(client).BindService(ctx)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("binds the most recent service instance to the most recent app", func() {
+			ctx.PutString("appGuids", "APP-GUID")
+			ctx.PutString("serviceInstanceGuids", "INSTANCE-GUID")
+			replies["APISERVER/v2/service_bindings"] = Resource{Metadata{"BINDING-GUID"}}
+
+			err := NewRestWorkloadWithClient(client).BindService(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			data := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v2/service_bindings"))
+			Ω(data["service_instance_guid"]).Should(Equal("INSTANCE-GUID"))
+			Ω(data["app_guid"]).Should(Equal("APP-GUID"))
+			guids, _ := ctx.GetString("serviceBindingGuids")
+			Ω(guids).Should(Equal("BINDING-GUID"))
+		})
+	})
+
+	Describe("Unbinding and deleting a service", func() {
+		BeforeEach(func() {
+			ctx.PutString("serviceInstanceGuids", "INSTANCE-GUID")
+			ctx.PutString("serviceBindingGuids", "BINDING-GUID")
+			replies["APISERVER/v2/service_bindings/BINDING-GUID"] = ""
+			replies["APISERVER/v2/service_instances/INSTANCE-GUID?accepts_incomplete=true"] = ""
+		})
+
+		It("deletes the most recent binding and stops tracking it", func() {
+			err := NewRestWorkloadWithClient(client).UnbindService(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/service_bindings/BINDING-GUID")
+			guids, _ := ctx.GetString("serviceBindingGuids")
+			Ω(guids).Should(BeEmpty())
+		})
+
+		It("deletes the most recent service instance and stops tracking it", func() {
+			err := NewRestWorkloadWithClient(client).DeleteService(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.ShouldHaveBeenCalledWith("DELETE", "APISERVER/v2/service_instances/INSTANCE-GUID?accepts_incomplete=true")
+			guids, _ := ctx.GetString("serviceInstanceGuids")
+			Ω(guids).Should(BeEmpty())
+		})
+
+		Context("When the broker deprovisions asynchronously", func() {
+			BeforeEach(func() {
+				replies["APISERVER/v2/service_instances/INSTANCE-GUID?accepts_incomplete=true"] = ServiceInstanceResponse{Metadata{"INSTANCE-GUID"}, ServiceInstanceEntity{LastOperation{"in progress", ""}}}
+			})
+
+			It("waits until the instance is gone", func() {
+				replies["APISERVER/v2/service_instances/INSTANCE-GUID"] = Reply{404, "Not Found", ""}
+				err := NewRestWorkloadWithClient(client).DeleteService(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+				client.ShouldHaveBeenCalledWith("GET", "APISERVER/v2/service_instances/INSTANCE-GUID")
+				guids, _ := ctx.GetString("serviceInstanceGuids")
+				Ω(guids).Should(BeEmpty())
+			})
+
+			It("keeps tracking the instance if deprovisioning fails", func() {
+				replies["APISERVER/v2/service_instances/INSTANCE-GUID"] = ServiceInstanceResponse{Metadata{"INSTANCE-GUID"}, ServiceInstanceEntity{LastOperation{"failed", "broker unavailable"}}}
+				err := NewRestWorkloadWithClient(client).DeleteService(ctx)
+				Ω(err).Should(HaveOccurred())
+				guids, _ := ctx.GetString("serviceInstanceGuids")
+				Ω(guids).Should(Equal("INSTANCE-GUID"))
+			})
+		})
+	})
+})
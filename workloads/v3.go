@@ -0,0 +1,226 @@
+package workloads
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/nu7hatch/gouuid"
+)
+
+const DefaultV3TimeoutInSeconds = 60 * 5
+
+var V3PollInterval = 2 * time.Second
+
+func PopulateV3Context(timeoutInSeconds int, ctx context.Context) {
+	ctx.PutInt("rest:v3-timeout", timeoutInSeconds)
+}
+
+type v3Relationship struct {
+	Data struct {
+		Guid string `json:"guid"`
+	} `json:"data"`
+}
+
+func relationshipTo(guid string) v3Relationship {
+	r := v3Relationship{}
+	r.Data.Guid = guid
+	return r
+}
+
+func (r *rest) V3CreateApp(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+	spaceGuid, _ := ctx.GetString("space_guid")
+
+	name, _ := uuid.NewV4()
+	createApp := struct {
+		Name          string                    `json:"name"`
+		Relationships map[string]v3Relationship `json:"relationships"`
+	}{"pats-" + name.String(), map[string]v3Relationship{"space": relationshipTo(spaceGuid)}}
+
+	return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+		created := &V3Resource{}
+		return r.PostSuccessfully(token, fmt.Sprintf("%s/v3/apps", apiEndpoint), createApp, created, func(reply Reply) error {
+			ctx.PutString("v3AppGuid", created.Guid)
+			addApp(ctx, createApp.Name, created.Guid)
+			return nil
+		})
+	})
+}
+
+func (r *rest) V3CreatePackage(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return withV3Guid(ctx, "v3AppGuid", "rest:v3:create-app", func(appGuid string) error {
+		createPackage := struct {
+			Type          string                    `json:"type"`
+			Relationships map[string]v3Relationship `json:"relationships"`
+		}{"bits", map[string]v3Relationship{"app": relationshipTo(appGuid)}}
+
+		return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+			created := &V3Resource{}
+			return r.PostSuccessfully(token, fmt.Sprintf("%s/v3/packages", apiEndpoint), createPackage, created, func(reply Reply) error {
+				ctx.PutString("v3PackageGuid", created.Guid)
+				return nil
+			})
+		})
+	})
+}
+
+func (r *rest) V3Upload(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return withV3Guid(ctx, "v3PackageGuid", "rest:v3:create-package", func(packageGuid string) error {
+		return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+			return withV3AppBits(ctx, func(b *bytes.Buffer, m *multipart.Writer) error {
+				uploaded := &V3Resource{}
+				return r.MultipartPostSuccessfully(token, m, fmt.Sprintf("%s/v3/packages/%s/upload", apiEndpoint, packageGuid), b, uploaded, func(reply Reply) error {
+					return r.pollV3(ctx, token, fmt.Sprintf("%s/v3/packages/%s", apiEndpoint, packageGuid), uploaded, "READY", "Package failed to upload")
+				})
+			})
+		})
+	})
+}
+
+func (r *rest) V3Stage(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return withV3Guid(ctx, "v3PackageGuid", "rest:v3:create-package", func(packageGuid string) error {
+		createBuild := struct {
+			Package V3Resource `json:"package"`
+		}{V3Resource{Guid: packageGuid}}
+
+		return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+			build := &V3BuildResponse{}
+			return r.PostSuccessfully(token, fmt.Sprintf("%s/v3/builds", apiEndpoint), createBuild, build, func(reply Reply) error {
+				err := r.pollV3(ctx, token, fmt.Sprintf("%s/v3/builds/%s", apiEndpoint, build.Guid), build, "STAGED", "App failed to stage")
+				if err != nil {
+					return err
+				}
+
+				ctx.PutString("v3DropletGuid", build.Droplet.Guid)
+				return nil
+			})
+		})
+	})
+}
+
+func (r *rest) V3SetDroplet(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return withV3Guid(ctx, "v3AppGuid", "rest:v3:create-app", func(appGuid string) error {
+		return withV3Guid(ctx, "v3DropletGuid", "rest:v3:stage", func(dropletGuid string) error {
+			return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+				return r.PatchSuccessfully(token, fmt.Sprintf("%s/v3/apps/%s/relationships/current_droplet", apiEndpoint, appGuid), relationshipTo(dropletGuid), nil, func(reply Reply) error {
+					return nil
+				})
+			})
+		})
+	})
+}
+
+func (r *rest) V3Start(ctx context.Context) error {
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	return withV3Guid(ctx, "v3AppGuid", "rest:v3:create-app", func(appGuid string) error {
+		return r.checkLoggedIn(ctx, func(r *rest, token string) error {
+			return r.PostSuccessfully(token, fmt.Sprintf("%s/v3/apps/%s/actions/start", apiEndpoint, appGuid), nil, nil, func(reply Reply) error {
+				return r.trackV3AppRunning(ctx, token, appGuid)
+			})
+		})
+	})
+}
+
+// v3Processed is a v3 resource which is processed asynchronously, like a
+// package or a build
+type v3Processed interface {
+	v3State() (state string, reason string)
+}
+
+func (resource *V3Resource) v3State() (string, string) {
+	return resource.State, resource.Error
+}
+
+func (build *V3BuildResponse) v3State() (string, string) {
+	return build.State, build.Error
+}
+
+// pollV3 waits for a v3 resource which is processed asynchronously to reach
+// the expected state, failing if it fails or expires, or is still processing
+// after rest:v3-timeout seconds
+func (r *rest) pollV3(ctx context.Context, token string, resourceUri string, resource v3Processed, expectedState string, failure string) error {
+	timeout := v3Timeout(ctx)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for {
+		state, reason := resource.v3State()
+		switch {
+		case state == expectedState:
+			return nil
+		case state == "FAILED" || state == "EXPIRED":
+			return fmt.Errorf("%s (%s): %s", failure, state, reason)
+		case time.Now().After(deadline):
+			return fmt.Errorf("%s: still %s after %d seconds", failure, state, timeout)
+		}
+
+		time.Sleep(V3PollInterval)
+		if err := r.client.Get(token, resourceUri, nil, resource).checkError(); err != nil {
+			return err
+		}
+	}
+}
+
+// trackV3AppRunning waits for every instance of a started app's web process
+// to be running, failing if one crashes or after rest:v3-timeout seconds
+func (r *rest) trackV3AppRunning(ctx context.Context, token string, appGuid string) error {
+	timeout := v3Timeout(ctx)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	apiEndpoint, _ := ctx.GetString("apiEndpoint")
+
+	for {
+		stats := &V3ProcessStatsResponse{}
+		if err := r.client.Get(token, fmt.Sprintf("%s/v3/apps/%s/processes/web/stats", apiEndpoint, appGuid), nil, stats).checkError(); err != nil {
+			return err
+		}
+
+		running, starting := 0, 0
+		for _, instance := range stats.Resources {
+			switch instance.State {
+			case "RUNNING":
+				running++
+			case "CRASHED":
+				return errors.New("App instance crashed while starting")
+			default:
+				starting++
+			}
+		}
+		if running > 0 && starting == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("App did not start within %d seconds", timeout)
+		}
+		time.Sleep(V3PollInterval)
+	}
+}
+
+func v3Timeout(ctx context.Context) int {
+	timeout, _ := ctx.GetInt("rest:v3-timeout")
+	if timeout <= 0 {
+		timeout = DefaultV3TimeoutInSeconds
+	}
+	return timeout
+}
+
+func withV3Guid(ctx context.Context, key string, step string, then func(guid string) error) error {
+	guid, _ := ctx.GetString(key)
+	if guid == "" {
+		return errors.New("Missing " + key + ", " + step + " must be included earlier in the list of workloads")
+	}
+
+	return then(guid)
+}
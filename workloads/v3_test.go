@@ -0,0 +1,164 @@
+package workloads_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST v3 push workloads", func() {
+	var (
+		client  *dummyClient
+		replies map[string]interface{}
+		ctx     context.Context
+		rest    interface {
+			V3CreateApp(ctx context.Context) error
+			V3CreatePackage(ctx context.Context) error
+			V3Upload(ctx context.Context) error
+			V3Stage(ctx context.Context) error
+			V3SetDroplet(ctx context.Context) error
+			V3Start(ctx context.Context) error
+		}
+	)
+
+	BeforeEach(func() {
+		replies = make(map[string]interface{})
+		client = &dummyClient{replies, make(map[string]string), make(map[call]interface{})}
+		rest = NewRestWorkloadWithClient(client)
+		ctx = context.New()
+		ctx.PutString("token", "TOKEN")
+		ctx.PutString("apiEndpoint", "APISERVER")
+		ctx.PutString("space_guid", "SPACE-GUID")
+		V3PollInterval = 10 * time.Millisecond
+
+		replies["APISERVER/v3/apps"] = V3Resource{Guid: "APP-GUID"}
+		replies["APISERVER/v3/packages"] = V3Resource{Guid: "PACKAGE-GUID", State: "AWAITING_UPLOAD"}
+		replies["APISERVER/v3/packages/PACKAGE-GUID/upload"] = V3Resource{Guid: "PACKAGE-GUID", State: "READY"}
+		replies["APISERVER/v3/builds"] = V3BuildResponse{"BUILD-GUID", "STAGED", "", V3Resource{Guid: "DROPLET-GUID"}}
+		replies["APISERVER/v3/apps/APP-GUID/relationships/current_droplet"] = ""
+		replies["APISERVER/v3/apps/APP-GUID/actions/start"] = ""
+		replies["APISERVER/v3/apps/APP-GUID/processes/web/stats"] = processStates("RUNNING", "RUNNING")
+	})
+
+	It("pushes an app one phase at a time", func() {
+		Ω(rest.V3CreateApp(ctx)).ShouldNot(HaveOccurred())
+		data := mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v3/apps"))
+		Ω(data["relationships"]).Should(Equal(map[string]interface{}{"space": map[string]interface{}{"data": map[string]interface{}{"guid": "SPACE-GUID"}}}))
+
+		Ω(rest.V3CreatePackage(ctx)).ShouldNot(HaveOccurred())
+		data = mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v3/packages"))
+		Ω(data["type"]).Should(Equal("bits"))
+
+		Ω(rest.V3Upload(ctx)).ShouldNot(HaveOccurred())
+		client.ShouldHaveBeenCalledWith("POST(multipart)", "APISERVER/v3/packages/PACKAGE-GUID/upload")
+
+		Ω(rest.V3Stage(ctx)).ShouldNot(HaveOccurred())
+		data = mapOf(client.ShouldHaveBeenCalledWith("POST", "APISERVER/v3/builds"))
+		Ω(data["package"]).Should(Equal(map[string]interface{}{"guid": "PACKAGE-GUID"}))
+
+		Ω(rest.V3SetDroplet(ctx)).ShouldNot(HaveOccurred())
+		data = mapOf(client.ShouldHaveBeenCalledWith("PATCH", "APISERVER/v3/apps/APP-GUID/relationships/current_droplet"))
+		Ω(data["data"]).Should(Equal(map[string]interface{}{"guid": "DROPLET-GUID"}))
+
+		Ω(rest.V3Start(ctx)).ShouldNot(HaveOccurred())
+		client.ShouldHaveBeenCalledWith("POST", "APISERVER/v3/apps/APP-GUID/actions/start")
+		client.ShouldHaveBeenCalledWith("GET", "APISERVER/v3/apps/APP-GUID/processes/web/stats")
+	})
+
+	It("uploads the same app as rest:push", func() {
+		dir, _ := ioutil.TempDir("", "v3-app")
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("hello"), 0644)
+		PopulateAppContext(dir, "", ctx)
+		ctx.PutString("v3PackageGuid", "PACKAGE-GUID")
+
+		Ω(rest.V3Upload(ctx)).ShouldNot(HaveOccurred())
+		data := client.ShouldHaveBeenCalledWith("POST(multipart)", "APISERVER/v3/packages/PACKAGE-GUID/upload")
+		Ω(data.(*bytes.Buffer).String()).Should(ContainSubstring(`name="bits"`))
+		Ω(zippedFiles(data.(*bytes.Buffer))).Should(Equal([]string{"index.html"}))
+	})
+
+	It("tracks the created app so that it can be deleted later", func() {
+		rest.V3CreateApp(ctx)
+		appGuids, _ := ctx.GetString("appGuids")
+		Ω(appGuids).Should(Equal("APP-GUID"))
+	})
+
+	It("returns an error when a phase runs before the one it depends on", func() {
+		Ω(rest.V3CreatePackage(ctx)).Should(HaveOccurred())
+	})
+
+	Context("When staging fails", func() {
+		BeforeEach(func() {
+			ctx.PutString("v3PackageGuid", "PACKAGE-GUID")
+			replies["APISERVER/v3/builds"] = V3BuildResponse{"BUILD-GUID", "FAILED", "NoAppDetectedError", V3Resource{}}
+		})
+
+		It("returns an error", func() {
+			Ω(rest.V3Stage(ctx)).Should(HaveOccurred())
+		})
+	})
+
+	Context("When the uploaded package expires", func() {
+		BeforeEach(func() {
+			ctx.PutString("v3PackageGuid", "PACKAGE-GUID")
+			replies["APISERVER/v3/packages/PACKAGE-GUID/upload"] = V3Resource{Guid: "PACKAGE-GUID", State: "PROCESSING_UPLOAD"}
+			replies["APISERVER/v3/packages/PACKAGE-GUID"] = V3Resource{Guid: "PACKAGE-GUID", State: "EXPIRED"}
+		})
+
+		It("returns an error", func() {
+			err := rest.V3Upload(ctx)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("EXPIRED"))
+		})
+	})
+
+	Context("When the app is started", func() {
+		BeforeEach(func() {
+			ctx.PutString("v3AppGuid", "APP-GUID")
+			PopulateV3Context(1, ctx)
+		})
+
+		It("fails when an instance crashes", func() {
+			replies["APISERVER/v3/apps/APP-GUID/processes/web/stats"] = processStates("RUNNING", "CRASHED")
+			Ω(rest.V3Start(ctx)).Should(HaveOccurred())
+		})
+
+		It("returns an error once rest:v3-timeout passes with an instance still starting", func() {
+			replies["APISERVER/v3/apps/APP-GUID/processes/web/stats"] = processStates("RUNNING", "STARTING")
+			err := rest.V3Start(ctx)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("1 seconds"))
+		})
+	})
+
+	Context("When staging never finishes", func() {
+		BeforeEach(func() {
+			ctx.PutString("v3PackageGuid", "PACKAGE-GUID")
+			PopulateV3Context(1, ctx)
+			replies["APISERVER/v3/builds"] = V3BuildResponse{"BUILD-GUID", "STAGING", "", V3Resource{}}
+			replies["APISERVER/v3/builds/BUILD-GUID"] = V3BuildResponse{"BUILD-GUID", "STAGING", "", V3Resource{}}
+		})
+
+		It("returns an error once rest:v3-timeout passes", func() {
+			err := rest.V3Stage(ctx)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("1 seconds"))
+		})
+	})
+})
+
+func processStates(states ...string) map[string]interface{} {
+	resources := make([]map[string]string, len(states))
+	for i, state := range states {
+		resources[i] = map[string]string{"state": state}
+	}
+	return map[string]interface{}{"resources": resources}
+}
@@ -16,6 +16,7 @@ type WorkloadStep struct {
 	Name        string
 	Fn          func(context context.Context) error
 	Description string
+	Parameters  []Parameter
 }
 
 type WorkloadList struct {
@@ -24,26 +25,82 @@ type WorkloadList struct {
 
 var restContext = NewRestWorkload()
 
+// DefaultWorkloadList is the built-in workloads followed by any registered with Register
 func DefaultWorkloadList() *WorkloadList {
-	return &WorkloadList{[]WorkloadStep{
+	return &WorkloadList{append(builtinWorkloads(), registeredWorkloads()...)}
+}
+
+func builtinWorkloads() []WorkloadStep {
+	return []WorkloadStep{
 		StepWithContext("rest:target", restContext.Target, "Sets the CF target"),
 		StepWithContext("rest:login", restContext.Login, "Performs a login to the REST api. This option requires rest:target to be included in the list of workloads"),
-		StepWithContext("rest:push", restContext.Push, "Pushes an application using the REST api. This option requires both rest:target and rest:login to be included in the list of workloads"),
-		StepWithContext("cf:push", Push, "Pushes an application using the CF command-line"),
+		StepWithContext("rest:push", restContext.Push, "Pushes an application using the REST api. This option requires both rest:target and rest:login to be included in the list of workloads").WithParameters(
+			Parameter{"timeout", "rest:start-timeout", "seconds to wait for the app to stage", true}),
+		StepWithContext("rest:delete", restContext.DeleteApp, "Deletes the most recently pushed app using the REST api. This option requires rest:push to be included in the list of workloads"),
+		StepWithContext("rest:stop", restContext.StopApp, "Stops the most recently pushed app using the REST api"),
+		StepWithContext("rest:start", restContext.StartApp, "Starts the most recently pushed app using the REST api and waits for all its instances to be running").WithParameters(
+			Parameter{"timeout", "rest:start-timeout", "seconds to wait for the app to start", true}),
+		StepWithContext("rest:restart", restContext.RestartApp, "Stops and starts the most recently pushed app using the REST api and waits for all its instances to be running").WithParameters(
+			Parameter{"timeout", "rest:start-timeout", "seconds to wait for the app to start", true}),
+		StepWithContext("rest:scale", restContext.ScaleApp, "Scales the most recently pushed app to rest:instances instances (and rest:memory MB, if set) using the REST api").WithParameters(
+			Parameter{"instances", "rest:instances", "number of instances", true},
+			Parameter{"memory", "rest:memory", "memory in MB", true}),
+		StepWithContext("rest:update-env", restContext.UpdateAppEnv, "Sets the rest:env environment variables on the most recently pushed app using the REST api").WithParameters(
+			Parameter{"env", "rest:env", "|-separated NAME=value pairs", false}),
+		StepWithContext("rest:create-service", restContext.CreateService, "Creates an instance of the rest:service offering's rest:service-plan plan using the REST api, waiting for asynchronous brokers to finish").WithParameters(
+			Parameter{"service", "rest:service", "label of the service offering", false},
+			Parameter{"plan", "rest:service-plan", "name of the service plan", false},
+			Parameter{"timeout", "rest:service-timeout", "seconds to wait for the broker", true}),
+		StepWithContext("rest:bind-service", restContext.BindService, "Binds the most recently created service instance to the most recently pushed app using the REST api"),
+		StepWithContext("rest:unbind-service", restContext.UnbindService, "Removes the most recently created service binding using the REST api"),
+		StepWithContext("rest:delete-service", restContext.DeleteService, "Deletes the most recently created service instance using the REST api, waiting for asynchronous brokers to finish").WithParameters(
+			Parameter{"timeout", "rest:service-timeout", "seconds to wait for the broker", true}),
+		StepWithContext("rest:create-route", restContext.CreateRoute, "Creates a route with a random host in the app:domain domain using the REST api"),
+		StepWithContext("rest:map-route", restContext.MapRoute, "Maps the most recently created route to the most recently pushed app using the REST api"),
+		StepWithContext("rest:unmap-route", restContext.UnmapRoute, "Unmaps the most recently created route from the most recently pushed app using the REST api"),
+		StepWithContext("rest:delete-route", restContext.DeleteRoute, "Deletes the most recently created route using the REST api"),
+		StepWithContext("rest:list-routes", restContext.ListRoutes, "Lists every page of routes, rest:routes-per-page at a time, using the REST api").WithParameters(
+			Parameter{"per-page", "rest:routes-per-page", "routes per page", true}),
+		StepWithContext("rest:v3:create-app", restContext.V3CreateApp, "Creates an app using the v3 REST api. This option requires both rest:target and rest:login to be included in the list of workloads"),
+		StepWithContext("rest:v3:create-package", restContext.V3CreatePackage, "Creates a bits package for the app created by rest:v3:create-app"),
+		StepWithContext("rest:v3:upload", restContext.V3Upload, "Uploads the app (like rest:push) to the package created by rest:v3:create-package and waits for it to be ready"),
+		StepWithContext("rest:v3:stage", restContext.V3Stage, "Creates a build of the package created by rest:v3:create-package and waits for it to stage"),
+		StepWithContext("rest:v3:set-droplet", restContext.V3SetDroplet, "Sets the droplet staged by rest:v3:stage as the app's current droplet"),
+		StepWithContext("rest:v3:start", restContext.V3Start, "Starts the app created by rest:v3:create-app and waits for all its instances to be running"),
+		StepWithContext("http:request", restContext.HttpRequest, "Sends an HTTP request configured by the http:* arguments and checks the response against any http:expect-* assertions").WithParameters(
+			Parameter{"method", "http:method", "HTTP method", false},
+			Parameter{"url", "http:url", "URL template", false},
+			Parameter{"body", "http:body", "request body template", false},
+			Parameter{"expect-status", "http:expect-status", "expected status code", true},
+			Parameter{"expect-body", "http:expect-body", "text the response body should contain", false},
+			Parameter{"expect-json", "http:expect-json", "JSON path (optionally path=value) the response body should contain", false}),
+		StepWithContext("app:firstRequest", restContext.FirstRequest, "Polls the route of the most recently pushed app until it responds with 200, timing the first successful request").WithParameters(
+			Parameter{"timeout", "app:routeTimeout", "seconds to wait for a 200", true}),
+		StepWithContext("app:logs", restContext.StreamLogs, "Has the most recently pushed app (e.g. assets/dora) log logs:lines tagged lines and reads them back from logs:endpoint, reporting their latency-ms and loss-rate as metrics. This option requires rest:target and rest:login").WithParameters(
+			Parameter{"lines", "logs:lines", "number of lines to log", true},
+			Parameter{"timeout", "logs:timeout", "seconds to wait for the lines to arrive", true}),
+		StepWithContext("app:generate", Generate, "Generates a unique app of app:language with app:files payload files totalling app:bytes, which the cf:push and rest:push steps after it push").WithParameters(
+			Parameter{"language", "app:language", "buildpack of the app", false},
+			Parameter{"files", "app:files", "number of payload files", true},
+			Parameter{"bytes", "app:bytes", "total size of the payload", true}),
+		StepWithContext("cf:push", Push, "Pushes an application using the CF command-line").WithParameters(
+			Parameter{"memory", "cf:memory", "memory limit, e.g. 256M (defaults to 64M without an app:manifest)", false},
+			Parameter{"instances", "cf:instances", "number of instances", true}),
+		StepWithContext("cf:login", CfLogin, "Logs the CF command-line in as the worker's user (like rest:login) with a CF_HOME of its own, which the worker's later cf steps use. Best used in -setup"),
+		StepWithContext("cf:logout", CfLogout, "Logs out of and removes the CF_HOME created by cf:login. Best used in -teardown"),
 		StepWithContext("cf:delete", Delete, "Deletes the most recently pushed app."),
 		StepWithContext("cf:generateAndPush", GenerateAndPush, "Generates and pushes a unique application using the CF command-line"),
 		StepWithContext("dummy", Dummy, "An empty workload that can be used when a CF environment is not available"),
 		StepWithContext("dummyDelete", DummyDelete, "An empty workload that simulates Delete"),
-		StepWithContext("dummyWithErrors", DummyWithErrors, "An empty workload that generates errors. This can be used when a CF environment is not available"),
-	}}
+	}
 }
 
 func Step(name string, fn func() error, description string) WorkloadStep {
-	return WorkloadStep{name, func(ctx context.Context) error { return fn() }, description}
+	return WorkloadStep{name, func(ctx context.Context) error { return fn() }, description, nil}
 }
 
 func StepWithContext(name string, fn func(context.Context) error, description string) WorkloadStep {
-	return WorkloadStep{name, fn, description}
+	return WorkloadStep{name, fn, description, nil}
 }
 
 func (self *WorkloadList) DescribeWorkloads(to WorkloadAdder) {